@@ -1,13 +1,13 @@
 package auth
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"time"
@@ -140,16 +140,24 @@ func cleanupDBs(databases ...*sql.DB) {
 	}
 }
 
+// SiteAuthRouteHandler serves the public files and rendered pages of the site of the request host with the user of its session.
+//
+// Deprecated: use a wispy.Server with its sessions stage replaced by Sessions
 func SiteAuthRouteHandler(engine *structure.TemplateEngine, SessionsDB *sql.DB, UserDB *sql.DB, w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 	domain := r.Host
 
 	// Look up the site structure for the domain
-	site, exists := engine.SiteMap[domain]
+	site, exists := engine.Sites.Lookup(domain)
 	if !exists {
 		http.Error(w, fmt.Sprintf("domain %s not found", domain), http.StatusNotFound)
 		return
 	}
+	// Pages rendered while sites are watched listen here for rebuilds
+	if r.URL.Path == template.LiveReloadPath && template.LiveReload.Active() {
+		template.LiveReload.ServeSite(w, r, site.Domain)
+		return
+	}
 
 	scopedDirectory := filepath.Join(engine.SITES_DIR, site.Domain)
 	// Handle public content
@@ -157,7 +165,7 @@ func SiteAuthRouteHandler(engine *structure.TemplateEngine, SessionsDB *sql.DB,
 	// if file extension check if there is a valid file in public directory to serve
 	if filepath.Ext(path) != "" {
 		// Serve public content if available
-		target := filepath.Join(scopedDirectory, "public", path)
+		target := filepath.Join(scopedDirectory, site.Config.Assets.PublicDir, path)
 		_, err := os.Stat(target)
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -166,13 +174,16 @@ func SiteAuthRouteHandler(engine *structure.TemplateEngine, SessionsDB *sql.DB,
 			}
 		} else {
 			// File exists and is not a directory - serve it
+			if site.Config.Cache.Public != "" {
+				w.Header().Set("Cache-Control", site.Config.Cache.Public)
+			}
 			http.ServeFile(w, r, target)
 			return
 		}
 	}
 	//
 	data := map[string]any{}
-	ctx := engine.InitCtx(scopedDirectory, &site, data)
+	ctx := engine.InitCtx(scopedDirectory, site, data)
 
 	// -------- Auth code here --------
 	validSession, userID, _, getSessionErr := VerifyAndGetSession(SessionsDB, r)
@@ -181,26 +192,36 @@ func SiteAuthRouteHandler(engine *structure.TemplateEngine, SessionsDB *sql.DB,
 		return
 	}
 
+	// Sites with [auth] required send visitors without a session to the login page
+	if site.Config.Auth.Required && !validSession && r.URL.Path != site.Config.Auth.LoginPath &&
+		!template.RouteMatches(site.Config.Auth.Public, r.URL.Path) {
+		http.Redirect(w, r, site.Config.Auth.LoginPath+"?redirect="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		return
+	}
+
 	// Render the route
 	// Set up the rendering context using NewRenderCtx (which initializes Internal automatically).
 	ctx.UsersDB = UserDB
 	if validSession {
 		ctx.UserID = userID
+		// pages cached per role need the roles of the user for their key
+		if rule, ok := template.MatchPageCacheRule(site, r.URL.Path); ok && rule.Role && rule.Shareable {
+			roles, err := GetUserRoles(UserDB, userID)
+			if err != nil {
+				slog.Error("GetUserRoles failed!" + err.Error())
+			}
+			ctx.UserRoles = roles
+		}
 	}
 	// -------- ------------- --------
 
 	//
-	page, err := template.RenderRoute(engine, ctx, r.URL.Path, data, w, r)
+	err := template.ServeRoute(engine, ctx, data, w, r)
 	if err != nil {
 		slog.Error("Rendering Route using \"RenderRoute()\"" + err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	// Measure rendering and styling times
 	renderTime := time.Now()
-	var results bytes.Buffer
-	results.WriteString(page)
 
 	// Log performance metrics
 	colorize := func(dur time.Duration) string {
@@ -213,9 +234,4 @@ func SiteAuthRouteHandler(engine *structure.TemplateEngine, SessionsDB *sql.DB,
 		colorize(time.Since(startTime)),
 		colorReset,
 	)
-
-	// Write the final HTML to the response
-	w.Header().Set("Content-Type", "text/html")
-	w.WriteHeader(http.StatusOK)
-	w.Write(results.Bytes())
 }
@@ -56,7 +56,8 @@ func CheckUserRoles(db *sql.DB, userID string, requiredRoles []string) (bool, er
 	// check if user is missing required role
 	for _, reqRole := range requiredRoles {
 		if slices.Contains(roles, reqRole) == false {
-			return false, fmt.Errorf("user: [%s] is missing role (%s)  \n", userID, reqRole)
+			// a missing role is a denied check, not a failure
+			return false, nil
 		}
 	}
 
@@ -14,12 +14,14 @@ require (
 
 require (
 	github.com/kato-studio/wispy/template v0.0.0-00010101000000-000000000000
+	github.com/segmentio/ksuid v1.0.4
 	golang.org/x/oauth2 v0.30.0
 )
 
 require (
 	github.com/BurntSushi/toml v1.5.0 // indirect
-	github.com/segmentio/ksuid v1.0.4 // indirect
+	github.com/yuin/goldmark v1.8.6 // indirect
 	golang.org/x/net v0.21.0 // indirect
 	golang.org/x/text v0.25.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
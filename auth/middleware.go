@@ -1 +1,50 @@
 package auth
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/kato-studio/wispy/template"
+	"github.com/kato-studio/wispy/template/wispy"
+)
+
+// Sessions is the sessions stage of a wispy.Server backed by the auth databases.
+// Requests with a valid session carry its user, sites with [auth] required send visitors without one to their login page
+func Sessions(SessionsDB *sql.DB, UsersDB *sql.DB) wispy.Stage {
+	return wispy.Stage{
+		Name: wispy.StageSessions,
+		Middleware: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				validSession, userID, _, err := VerifyAndGetSession(SessionsDB, r)
+				if err != nil {
+					slog.Error("VerifyAndGetSession failed!" + err.Error())
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+
+				site, ok := wispy.RequestSite(r)
+				if ok && site.Config.Auth.Required && !validSession && r.URL.Path != site.Config.Auth.LoginPath &&
+					!template.RouteMatches(site.Config.Auth.Public, r.URL.Path) {
+					http.Redirect(w, r, site.Config.Auth.LoginPath+"?redirect="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+					return
+				}
+
+				session := wispy.Session{UsersDB: UsersDB}
+				if validSession {
+					session.UserID = userID
+					// pages cached per role need the roles of the user for their key
+					if ok {
+						if rule, cached := template.MatchPageCacheRule(site, r.URL.Path); cached && rule.Role && rule.Shareable {
+							if session.Roles, err = GetUserRoles(UsersDB, userID); err != nil {
+								slog.Error("GetUserRoles failed!" + err.Error())
+							}
+						}
+					}
+				}
+				next.ServeHTTP(w, wispy.WithSession(r, session))
+			})
+		},
+	}
+}
@@ -2,6 +2,7 @@ package tags
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 
@@ -12,12 +13,12 @@ import (
 
 var RestrictedByRole = structure.TemplateTag{
 	Name: "restricted-by-role",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (int, []error) {
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) []error {
 		var errs []error
 		UserID := ctx.UserID
 
 		// Parse tag options
-		options := wispy_common.SplitRespectQuotes(tag_contents)
+		options := wispy_common.SplitRespectQuotes(node.Content)
 		optionsMap := wispy_common.ParseKeyValuePairs(options)
 
 		if UserID == "" {
@@ -26,20 +27,26 @@ var RestrictedByRole = structure.TemplateTag{
 				fmt.Println("redirected to -> ", url)
 				http.Redirect(*ctx.ResponseWriter, ctx.Request, url, http.StatusSeeOther)
 			} else {
-				fmt.Println(":( no redirect url found!")
+				// without a redirect the site's 401 error page is served in place
+				ctx.Status = http.StatusUnauthorized
 			}
-			return len(raw), errs
+			ctx.Halted = true
+			return errs
 		}
-		if err := ctx.UsersDB.Ping(); err != nil {
+		if ctx.UsersDB == nil || ctx.UsersDB.Ping() != nil {
 			errs = append(errs, fmt.Errorf("ctx.UsersDB was nil \"restricted-by-role\" failed no content rendered"))
-			return len(raw), errs
+			ctx.Status = http.StatusInternalServerError
+			ctx.Halted = true
+			return errs
 		}
 
 		// Check for required roles parameter
 		rolesString, exists := optionsMap["roles"]
 		if !exists {
 			errs = append(errs, fmt.Errorf("'roles' parameter is required for role-access tag"))
-			return len(raw), errs
+			ctx.Status = http.StatusInternalServerError
+			ctx.Halted = true
+			return errs
 		}
 
 		// Check user roles against required roles using UsersDB
@@ -47,17 +54,19 @@ var RestrictedByRole = structure.TemplateTag{
 		hasAccess, err := auth.CheckUserRoles(ctx.UsersDB, UserID, requiredRoles)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("failed to check user roles: %w", err))
-			return len(raw), errs
+			ctx.Status = http.StatusInternalServerError
+			ctx.Halted = true
+			return errs
 		}
 
 		// If user has access, render the content
 		if hasAccess {
-			return pos, nil
+			return nil
 		}
 
-		http.Redirect(*ctx.ResponseWriter, ctx.Request, "/error?code=401&source="+ctx.Request.URL.Path+"&error=failed access check", http.StatusSeeOther)
-
-		// If no access, don't render anything
-		return len(raw), errs
+		// If no access, don't render anything, the site's 401 error page is served in place
+		ctx.Status = http.StatusUnauthorized
+		ctx.Halted = true
+		return errs
 	},
 }
@@ -2,48 +2,32 @@ package tags
 
 import (
 	"fmt"
-	"strings"
+	"io"
 
 	template_core "github.com/kato-studio/wispy/template/core"
 	"github.com/kato-studio/wispy/wispy_common"
 	"github.com/kato-studio/wispy/wispy_common/structure"
 )
 
-func delimWrap(ctx *structure.RenderCtx, value string) string {
-	return strings.Join([]string{ctx.Engine.DelimStart, value, ctx.Engine.DelimEnd}, " ")
-}
-
 var UserTag = structure.TemplateTag{
 	Name: "user",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (int, []error) {
+	Kind: structure.KindBlock,
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) []error {
 		var errs []error
 
 		// Parse tag options
-		options := wispy_common.SplitRespectQuotes(tag_contents)
-
-		// Find end tag
-		endTag := delimWrap(ctx, "end-user")
-		endTagStart, endTagLength := template_core.SeekIndexAndLength(raw, endTag, pos)
-		if endTagStart == -1 {
-			errs = append(errs, fmt.Errorf("could not find end tag for %s", endTag))
-			return pos, errs
-		}
-
-		content := raw[pos:endTagStart]
-		newEndPos := endTagStart + endTagLength
+		options := wispy_common.SplitRespectQuotes(node.Content)
 
 		// Check authentication state requirements
 		if len(options) > 0 {
 			switch options[0] {
 			case "logged-in":
 				if ctx.UserID != "" {
-					sb.WriteString(content)
-					return newEndPos, nil
+					return template_core.Execute(ctx, w, node.Children)
 				}
 			case "logged-out":
 				if ctx.UserID == "" {
-					sb.WriteString(content)
-					return newEndPos, nil
+					return template_core.Execute(ctx, w, node.Children)
 				}
 			default:
 				errs = append(errs, fmt.Errorf("invalid props for 'user' - try setting 'logged-in' or 'logged-out'"))
@@ -68,6 +52,6 @@ var UserTag = structure.TemplateTag{
 		// 	}
 		// }
 
-		return newEndPos, errs
+		return errs
 	},
 }
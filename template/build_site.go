@@ -9,7 +9,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/BurntSushi/toml"
+	"github.com/kato-studio/wispy/template/core"
 	"github.com/kato-studio/wispy/wispy_common/structure"
 )
 
@@ -35,119 +35,160 @@ func BuildSiteMap(engine *structure.TemplateEngine) {
 	// Process each site (directory)
 	for _, entry := range entries {
 		if entry.IsDir() {
-			domain := entry.Name()
-			siteFolderPath := filepath.Join(engine.SITES_DIR, domain)
-			configFilePath := filepath.Join(siteFolderPath, engine.SITE_CONFIG_NAME)
-
-			// Read and decode the site config.
-			configBytes, err := os.ReadFile(configFilePath)
-			if err != nil {
-				fmt.Println(err)
-				slog.Error("Could not find config for ", domain, " at ", configFilePath, ": ", err)
-				continue
+			if siteStructure, ok := buildSite(engine, entry.Name()); ok {
+				engine.Sites.Set(siteStructure)
 			}
+		}
+	}
+	//
+	fmt.Println("SiteMap Build Time: ", time.Since(buildStart))
+	// Log the list of sites for confirmation.
+	fmt.Println("Sites: ", engine.Sites.Domains())
+}
 
-			siteStructure := NewSiteStructure(domain)
-			if _, err := toml.Decode(string(configBytes), &siteStructure); err != nil {
-				fmt.Println(err)
-				slog.Error("Failed to load config for ", domain, " at ", configFilePath, ": ", err)
-			}
+// buildSite reads the config, pages, content, layouts and partials of a site folder and parses its templates into the cache.
+// Folders without a config are not sites
+func buildSite(engine *structure.TemplateEngine, domain string) (siteStructure structure.SiteStructure, ok bool) {
+	siteStructure = NewSiteStructure(domain)
+	siteFolderPath := filepath.Join(engine.SITES_DIR, domain)
+	configFilePath := filepath.Join(siteFolderPath, engine.SITE_CONFIG_NAME)
+
+	// Read and decode the site config.
+	if _, err := os.Stat(configFilePath); err != nil {
+		fmt.Println(err)
+		slog.Error("Could not find site config", "domain", domain, "path", configFilePath, "error", err)
+		return siteStructure, false
+	}
 
-			// Build pages, layouts, and partials paths.
-			pagesPath := filepath.Join(siteFolderPath, "pages")
-			layoutsPath := filepath.Join(siteFolderPath, "layouts")
-			partialsPath := filepath.Join(siteFolderPath, "partials")
+	siteStructure.Config, siteStructure.ConfigErrors = LoadSiteConfig(engine, siteFolderPath)
+	for _, err := range siteStructure.ConfigErrors {
+		slog.Error("Invalid site config", "domain", domain, "error", err)
+	}
+
+	// Build pages, layouts, and partials paths.
+	pagesPath := filepath.Join(siteFolderPath, "pages")
+	layoutsPath := filepath.Join(siteFolderPath, "layouts")
+	partialsPath := filepath.Join(siteFolderPath, "partials")
 
-			// Handle Pages: walk through the pages directory.
-			filepath.Walk(pagesPath, func(path string, info fs.FileInfo, err error) error {
+	// Handle Pages: walk through the pages directory.
+	filepath.Walk(pagesPath, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			fmt.Println(err)
+			slog.Error("Error accessing page path", "path", path, "error", err)
+			return err
+		}
+		// Error pages are rendered in place of failed routes, not served at their own path
+		if info.IsDir() && path == filepath.Join(pagesPath, ErrorPagesDir) {
+			return filepath.SkipDir
+		}
+		// Only process files with the configured extension.
+		if !info.IsDir() && filepath.Ext(path) == engine.FILE_EXT {
+			// Check if file name (without extension) matches the page file name.
+			baseName := strings.TrimSuffix(filepath.Base(path), engine.FILE_EXT)
+			if baseName == engine.PAGE_FILE_NAME {
+				// Determine the page name as the relative directory from the pages folder.
+				relDir, err := filepath.Rel(pagesPath, filepath.Dir(path))
 				if err != nil {
 					fmt.Println(err)
-					slog.Error("Error accessing path ", path, ": ", err)
+					slog.Error("Error computing relative page path", "path", path, "error", err)
 					return err
 				}
-				// Only process files with the configured extension.
-				if !info.IsDir() && filepath.Ext(path) == engine.FILE_EXT {
-					// Check if file name (without extension) matches the page file name.
-					baseName := strings.TrimSuffix(filepath.Base(path), engine.FILE_EXT)
-					if baseName == engine.PAGE_FILE_NAME {
-						// Determine the page name as the relative directory from the pages folder.
-						relDir, err := filepath.Rel(pagesPath, filepath.Dir(path))
-						if err != nil {
-							fmt.Println(err)
-							slog.Error("Error computing relative path for ", path, ": ", err)
-							return err
-						}
-						pageName := relDir
-						if pageName == "." {
-							pageName = ""
-						}
-						// Use a key combining the domain and the pageName.
-						routeKey := domain + "/" + pageName
-						siteStructure.Routes[routeKey] = structure.PageRoutes{
-							Name:   pageName,
-							Title:  domain,
-							Layout: "",
-							Path:   path,
-							// Template: string(templateData),
-							MetaTags: structure.MetaTags{
-								Title:         domain + " title",
-								Description:   "Page description here",
-								OgTitle:       domain + " title",
-								OgDescription: "Page description here",
-								OgType:        "text",
-								OgUrl:         domain,
-							},
-						}
-					}
+				pageName := relDir
+				if pageName == "." {
+					pageName = ""
 				}
-				return nil
-			})
-
-			// Handle Partials: walk through the partials directory.
-			filepath.WalkDir(partialsPath, func(path string, d fs.DirEntry, err error) error {
+				// Directories such as "blog/[slug]" become dynamic routes
+				pattern, err := routePattern(filepath.ToSlash(pageName))
 				if err != nil {
-					slog.Error("Error accessing component path ", path, ": ", err)
-					return err
+					slog.Error("Invalid dynamic route", "path", path, "error", err)
+					return nil
 				}
-				if !d.IsDir() && filepath.Ext(path) == structure.Wispy.FILE_EXT {
-					// templateData, err := os.ReadFile(path)
-					// if err != nil {
-					// 	slog.Error("Failed to read component file at ", path, ": ", err)
-					// 	return err
-					// }
-					componentName := strings.TrimSuffix(filepath.Base(path), structure.Wispy.FILE_EXT)
-					siteStructure.Partials[componentName] = path //string(templateData)
+				// Use a key combining the domain and the pageName.
+				routeKey := domain + "/" + pageName
+				siteStructure.Routes[routeKey] = structure.PageRoutes{
+					Name:   pageName,
+					Title:  domain,
+					Layout: "",
+					Path:   path,
+					// Template: string(templateData),
+					MetaTags: structure.MetaTags{
+						Title:         domain + " title",
+						Description:   "Page description here",
+						OgTitle:       domain + " title",
+						OgDescription: "Page description here",
+						OgType:        "text",
+						OgUrl:         domain,
+					},
+					Pattern: pattern,
 				}
-				return nil
-			})
+			}
+		}
+		return nil
+	})
+	siteStructure.DynamicRoutes = sortDynamicRoutes(siteStructure.Routes)
 
-			// Handle Layouts: walk through the layouts directory.
-			filepath.Walk(layoutsPath, func(path string, info fs.FileInfo, err error) error {
-				if err != nil {
-					slog.Error("Error accessing layout path ", path, ": ", err)
-					return err
-				}
-				if !info.IsDir() && filepath.Ext(path) == structure.Wispy.FILE_EXT {
-					templateData, err := os.ReadFile(path)
-					if err != nil {
-						slog.Error("Failed to read layout file at ", path, ": ", err)
-						return err
-					}
-					layoutName := strings.TrimSuffix(filepath.Base(path), structure.Wispy.FILE_EXT)
-					siteStructure.Layouts[layoutName] = string(templateData)
-				}
-				return nil
-			})
+	// Markdown of content/ becomes collections, with routes rendered through their layout, data/ becomes .Site.Data
+	siteStructure.Collections, siteStructure.ContentErrors = LoadCollections(engine, siteFolderPath, siteStructure.Config)
+	dataErrs := []error(nil)
+	siteStructure.Data, dataErrs = LoadSiteData(siteFolderPath, siteStructure.Config)
+	siteStructure.ContentErrors = append(siteStructure.ContentErrors, dataErrs...)
+	for _, err := range siteStructure.ContentErrors {
+		slog.Error("Invalid content", "domain", domain, "error", err)
+	}
 
-			engine.SiteMap[domain] = siteStructure
+	// Handle Partials: walk through the partials directory.
+	filepath.WalkDir(partialsPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			slog.Error("Error accessing partial path", "path", path, "error", err)
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(path) == structure.Wispy.FILE_EXT {
+			// templateData, err := os.ReadFile(path)
+			// if err != nil {
+			// 	slog.Error("Failed to read component file at ", path, ": ", err)
+			// 	return err
+			// }
+			componentName := strings.TrimSuffix(filepath.Base(path), structure.Wispy.FILE_EXT)
+			siteStructure.Partials[componentName] = path //string(templateData)
 		}
+		return nil
+	})
+
+	// Handle Layouts: walk through the layouts directory.
+	filepath.Walk(layoutsPath, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			slog.Error("Error accessing layout path", "path", path, "error", err)
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(path) == structure.Wispy.FILE_EXT {
+			layoutName := strings.TrimSuffix(filepath.Base(path), structure.Wispy.FILE_EXT)
+			siteStructure.Layouts[layoutName] = path
+		}
+		return nil
+	})
+
+	// Parse every template of the site up front so the first requests are served from the cache
+	engine.Templates.InvalidateSite(domain)
+	warmTemplateCache(engine, siteStructure)
+
+	return siteStructure, true
+}
+
+// warmTemplateCache parses the pages, layouts and partials of a site into engine.Templates
+func warmTemplateCache(engine *structure.TemplateEngine, site structure.SiteStructure) {
+	var paths []string
+	for _, route := range site.Routes {
+		paths = append(paths, route.Path)
 	}
-	//
-	fmt.Println("SiteMap Build Time: ", time.Since(buildStart))
-	// Log the list of sites for confirmation.
-	var domains []string
-	for domain := range engine.SiteMap {
-		domains = append(domains, domain)
+	for _, path := range site.Layouts {
+		paths = append(paths, path)
+	}
+	for _, path := range site.Partials {
+		paths = append(paths, path)
+	}
+	for _, path := range paths {
+		if _, err := core.LoadTemplate(engine, site.Domain, path); err != nil {
+			slog.Error("Failed to parse template", "domain", site.Domain, "path", path, "error", err)
+		}
 	}
-	fmt.Println("Sites: ", domains)
 }
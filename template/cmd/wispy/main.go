@@ -0,0 +1,102 @@
+// Command wispy runs site tooling from the command line.
+//
+//	wispy check [-sites ./sites]                          parse every template and report problems, exits 1 when there are any
+//	wispy export [-sites ./sites] [-out ./dist] [-v] DOMAIN  render every route of a site to static files, exits 1 when a route fails or has template errors
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/kato-studio/wispy/template"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "check":
+		os.Exit(check(os.Args[2:]))
+	case "export":
+		os.Exit(export(os.Args[2:]))
+	case "help", "-h", "--help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: wispy <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "commands:")
+	fmt.Fprintln(os.Stderr, "  check    parse every page, layout and partial and report template problems")
+	fmt.Fprintln(os.Stderr, "  export   render every route of a site to static files")
+}
+
+// check lints every site and returns the exit code, 1 when problems were found
+func check(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	sitesDir := flags.String("sites", "./sites", "directory holding one folder per site")
+	flags.Parse(args)
+
+	engine := template.StartDefaultEngine()
+	engine.SITES_DIR = *sitesDir
+	template.BuildSiteMap(engine)
+
+	errs := template.Lint(engine)
+	for _, err := range errs {
+		if te, ok := err.(*structure.TemplateError); ok {
+			fmt.Fprintln(os.Stderr, te.Detail())
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problem(s) found in %s\n", len(errs), *sitesDir)
+		return 1
+	}
+	fmt.Printf("no problems found in %s\n", *sitesDir)
+	return 0
+}
+
+// export writes a site as static files and returns the exit code, 1 when a route could not be exported or has template errors
+func export(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	sitesDir := flags.String("sites", "./sites", "directory holding one folder per site")
+	outDir := flags.String("out", "./dist", "directory the site is written to")
+	verbose := flags.Bool("v", false, "log every exported and skipped route")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: wispy export [-sites ./sites] [-out ./dist] [-v] DOMAIN")
+		return 2
+	}
+	domain := flags.Arg(0)
+	if *verbose {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	}
+
+	engine := template.StartDefaultEngine()
+	engine.SITES_DIR = *sitesDir
+	template.BuildSiteMap(engine)
+
+	errs := template.ExportSite(engine, domain, *outDir)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "%d route(s) of %s could not be exported or have template errors\n", len(errs), domain)
+		return 1
+	}
+	fmt.Printf("exported %s to %s\n", domain, *outDir)
+	return 0
+}
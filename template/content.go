@@ -0,0 +1,474 @@
+package template
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/kato-studio/wispy/template/core"
+	"github.com/kato-studio/wispy/template/markdown"
+	common "github.com/kato-studio/wispy/wispy_common"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// ContentDir is the folder of a site holding its content collections, "content/blog/hello.md" is an entry of "blog".
+// Files starting with "_" are left out
+const ContentDir = "content"
+
+// Marker in the Markdown of an entry ending its summary
+const summaryMarker = "<!--more-->"
+
+// Layouts tried in order for dates of front matter given as strings
+var contentDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// LoadCollections reads every folder of a site's content/ folder into a collection, see structure.SiteCollection.
+// Entries with invalid front matter are reported and left out
+func LoadCollections(engine *structure.TemplateEngine, siteFolderPath string, config structure.SiteConfig) (collections map[string]*structure.ContentCollection, errs []error) {
+	collections = make(map[string]*structure.ContentCollection)
+	contentPath := filepath.Join(siteFolderPath, ContentDir)
+	folders, err := os.ReadDir(contentPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+		return collections, errs
+	}
+
+	for _, folder := range folders {
+		if !folder.IsDir() || strings.HasPrefix(folder.Name(), "_") || strings.HasPrefix(folder.Name(), ".") {
+			continue
+		}
+		name := folder.Name()
+		collectionConfig, configured := config.Collections[name]
+		var entries []*structure.SiteContent
+		root := filepath.Join(contentPath, name)
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				errs = append(errs, err)
+				return nil
+			}
+			if strings.HasPrefix(d.Name(), "_") || strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() && path != root {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || (filepath.Ext(path) != ".md" && filepath.Ext(path) != ".markdown") {
+				return nil
+			}
+			entry, err := loadContentEntry(name, root, path)
+			if err != nil {
+				errs = append(errs, err)
+				return nil
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+		sortContent(entries, collectionConfig)
+
+		collection, duplicates := structure.NewContentCollection(name, entries)
+		for _, entry := range duplicates {
+			existing, _ := collection.Entry(entry.Slug)
+			errs = append(errs, fmt.Errorf("%s: slug %q is already used by %s", entry.Path, entry.Slug, existing.Path))
+		}
+
+		// Entries get routes when the layout of the collection exists
+		layout := collectionConfig.Layout
+		if layout == "" {
+			layout = name
+		}
+		// like other layouts, "layouts/blog.hstm" or "layouts/blog/index.hstm"
+		layoutPath := ""
+		for _, candidate := range []string{
+			filepath.Join(siteFolderPath, "layouts", layout+engine.FILE_EXT),
+			filepath.Join(siteFolderPath, "layouts", layout, "index"+engine.FILE_EXT),
+		} {
+			if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+				layoutPath = candidate
+				break
+			}
+		}
+		if layoutPath != "" {
+			route := collectionConfig.Route
+			if route == "" {
+				route = "/" + name + "/[...slug]"
+			}
+			if pattern, err := routePattern(strings.Trim(route, "/")); err != nil {
+				errs = append(errs, fmt.Errorf("collections.%s.route: %w", name, err))
+			} else {
+				collection.Pattern, collection.Layout = pattern, layoutPath
+			}
+		} else if configured && (collectionConfig.Layout != "" || collectionConfig.Route != "") {
+			errs = append(errs, fmt.Errorf("collections.%s: layout %q not found in %s", name, layout, filepath.Join(siteFolderPath, "layouts")))
+		}
+
+		for _, entry := range collection.Entries {
+			if collection.Pattern != nil {
+				entry.URL = contentURL(collection.Pattern, entry.Slug)
+			}
+			entry.Values = contentValues(entry)
+		}
+		collections[name] = collection
+	}
+	return collections, errs
+}
+
+// loadContentEntry reads a Markdown file of a collection with its front matter
+func loadContentEntry(collection, root, filePath string) (*structure.SiteContent, error) {
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	front, body, err := SplitFrontMatter(source)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	rel, _ := filepath.Rel(root, filePath)
+	name := strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel))
+	// "guides/index.md" is the entry "guides"
+	if base := path.Base(name); base == "index" && path.Dir(name) != "." {
+		name = path.Dir(name)
+	}
+	entry := &structure.SiteContent{
+		Collection: collection,
+		Name:       name,
+		Title:      path.Base(name),
+		Slug:       name,
+		Params:     front,
+		Path:       filePath,
+	}
+
+	var fieldErrs []error
+	text := func(key string) string {
+		value, ok := front[key]
+		if !ok || value == nil {
+			return ""
+		}
+		if s, ok := value.(string); ok {
+			return s
+		}
+		fieldErrs = append(fieldErrs, fmt.Errorf("%s must be a string", key))
+		return ""
+	}
+	if title := text("title"); title != "" {
+		entry.Title = title
+	}
+	if slug := strings.Trim(text("slug"), "/"); slug != "" {
+		entry.Slug = slug
+	}
+	entry.Description = text("description")
+	entry.Author = text("author")
+
+	if draft, ok := front["draft"]; ok {
+		if entry.Draft, ok = draft.(bool); !ok {
+			fieldErrs = append(fieldErrs, fmt.Errorf("draft must be true or false"))
+		}
+	}
+	switch weight := front["weight"].(type) {
+	case nil:
+	case int:
+		entry.Weight = weight
+	case int64:
+		entry.Weight = int(weight)
+	default:
+		fieldErrs = append(fieldErrs, fmt.Errorf("weight must be a whole number"))
+	}
+	if entry.Date, err = contentDate(front["date"]); err != nil {
+		fieldErrs = append(fieldErrs, fmt.Errorf("date: %w", err))
+	}
+	lastUpdate := front["lastmod"]
+	if lastUpdate == nil {
+		lastUpdate = front["updated"]
+	}
+	if entry.LastUpdate, err = contentDate(lastUpdate); err != nil {
+		fieldErrs = append(fieldErrs, fmt.Errorf("lastmod: %w", err))
+	}
+	if entry.Tags, err = contentTerms(front["tags"]); err != nil {
+		fieldErrs = append(fieldErrs, fmt.Errorf("tags: %w", err))
+	}
+	categories := front["categories"]
+	if categories == nil {
+		categories = front["category"]
+	}
+	if entry.Categories, err = contentTerms(categories); err != nil {
+		fieldErrs = append(fieldErrs, fmt.Errorf("categories: %w", err))
+	}
+	if entry.Changes, err = contentChanges(front["changes"]); err != nil {
+		fieldErrs = append(fieldErrs, fmt.Errorf("changes: %w", err))
+	}
+	if len(fieldErrs) > 0 {
+		return nil, fmt.Errorf("%s: front matter %w", filePath, fieldErrs[0])
+	}
+
+	summary, _, hasMore := strings.Cut(body, summaryMarker)
+	entry.Body = structure.SafeHTML(markdown.ToHTML(strings.Replace(body, summaryMarker, "", 1)))
+	switch {
+	case text("summary") != "":
+		entry.Summary = structure.SafeHTML(markdown.ToHTML(text("summary")))
+	case hasMore:
+		entry.Summary = structure.SafeHTML(markdown.ToHTML(summary))
+	default:
+		// the first paragraph
+		if end := strings.Index(string(entry.Body), "</p>"); end >= 0 {
+			if start := strings.Index(string(entry.Body), "<p>"); start >= 0 && start < end {
+				entry.Summary = entry.Body[start : end+len("</p>")]
+			}
+		}
+	}
+	return entry, nil
+}
+
+// SplitFrontMatter separates the front matter of a file from its body, YAML between "---" lines or
+// TOML between "+++" lines. Files without front matter have an empty one
+func SplitFrontMatter(source []byte) (front map[string]any, body string, err error) {
+	text := strings.ReplaceAll(strings.TrimPrefix(string(source), "\uFEFF"), "\r\n", "\n")
+	for _, fence := range []string{"---", "+++"} {
+		if !strings.HasPrefix(text, fence+"\n") {
+			continue
+		}
+		after := text[len(fence)+1:]
+		matter, rest, found := strings.Cut("\n"+after, "\n"+fence+"\n")
+		if !found {
+			// the front matter ends the file
+			if matter, found = strings.CutSuffix("\n"+after, "\n"+fence); !found {
+				return nil, "", fmt.Errorf("front matter is not closed with %q", fence)
+			}
+		}
+		if fence == "---" {
+			front, err = decodeYAML([]byte(matter))
+		} else {
+			front = map[string]any{}
+			_, err = toml.Decode(matter, &front)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("front matter: %w", err)
+		}
+		return front, rest, nil
+	}
+	return map[string]any{}, text, nil
+}
+
+// contentDate reads a date of front matter, TOML and YAML dates decode to time.Time and quoted dates are strings
+func contentDate(value any) (time.Time, error) {
+	switch value := value.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return value, nil
+	case string:
+		for _, layout := range contentDateLayouts {
+			if date, err := time.Parse(layout, value); err == nil {
+				return date, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("%v is not a date such as 2006-01-02", value)
+}
+
+// contentTerms reads tags or categories given as a list or a single string
+func contentTerms(value any) ([]string, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{value}, nil
+	case []any:
+		terms := make([]string, 0, len(value))
+		for _, term := range value {
+			s, ok := term.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v is not a string", term)
+			}
+			terms = append(terms, s)
+		}
+		return terms, nil
+	}
+	return nil, fmt.Errorf("must be a list of strings")
+}
+
+// contentChanges reads the changes of an entry keyed by version or date, "1.1: {author: Ann, date: ..., changes: {...}}"
+func contentChanges(value any) (map[string]structure.ContentChange, error) {
+	if value == nil {
+		return nil, nil
+	}
+	entries, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("must be a table keyed by version or date")
+	}
+	changes := make(map[string]structure.ContentChange, len(entries))
+	for key, entry := range entries {
+		fields, ok := entry.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a table", key)
+		}
+		change := structure.ContentChange{Changes: map[string]string{}}
+		change.Author, _ = fields["author"].(string)
+		change.Date = core.Stringify(fields["date"])
+		if described, ok := fields["changes"].(map[string]any); ok {
+			for field, description := range described {
+				change.Changes[field] = core.Stringify(description)
+			}
+		}
+		changes[key] = change
+	}
+	return changes, nil
+}
+
+// sortContent orders the entries of a collection by its sort_by key, ties go by title
+func sortContent(entries []*structure.SiteContent, config structure.SiteCollection) {
+	slices.SortStableFunc(entries, func(a, b *structure.SiteContent) int {
+		order := 0
+		switch config.SortBy {
+		case "", "date":
+			order = b.Date.Compare(a.Date)
+		case "title":
+		case "weight":
+			order = a.Weight - b.Weight
+		case "slug":
+			order = strings.Compare(a.Slug, b.Slug)
+		default:
+			order = core.Compare(a.Params[config.SortBy], b.Params[config.SortBy])
+		}
+		if order == 0 {
+			order = strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+		}
+		if config.Reverse {
+			return -order
+		}
+		return order
+	})
+}
+
+// contentURL fills the slug segment of a collection route
+func contentURL(pattern []string, slug string) string {
+	segments := make([]string, len(pattern))
+	for i, segment := range pattern {
+		if kind, name := parseSegment(segment); kind != segmentStatic && name == "slug" {
+			segment = slug
+		}
+		segments[i] = segment
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// contentValues exposes an entry to templates
+func contentValues(entry *structure.SiteContent) map[string]any {
+	values := map[string]any{
+		"Collection":  entry.Collection,
+		"Name":        entry.Name,
+		"Title":       entry.Title,
+		"Description": entry.Description,
+		"Slug":        entry.Slug,
+		"URL":         entry.URL,
+		"Author":      entry.Author,
+		"Draft":       entry.Draft,
+		"Weight":      entry.Weight,
+		"Summary":     entry.Summary,
+		"Content":     entry.Body,
+		"Tags":        contentList(entry.Tags),
+		"Categories":  contentList(entry.Categories),
+		"Params":      entry.Params,
+	}
+	// undated entries have empty dates so templates can test for them
+	for key, date := range map[string]time.Time{"Date": entry.Date, "LastUpdate": entry.LastUpdate} {
+		values[key] = ""
+		if !date.IsZero() {
+			values[key] = date
+		}
+	}
+	if len(entry.Changes) > 0 {
+		changes := make(map[string]any, len(entry.Changes))
+		for key, change := range entry.Changes {
+			changes[key] = map[string]any{"Author": change.Author, "Date": change.Date, "Changes": maps.Clone(change.Changes)}
+		}
+		values["Changes"] = changes
+	}
+	return values
+}
+
+func contentList(terms []string) []any {
+	list := make([]any, len(terms))
+	for i, term := range terms {
+		list[i] = term
+	}
+	return list
+}
+
+// showUnpublished reports whether drafts and entries dated later are shown, which they are while developing
+func showUnpublished() bool {
+	return !common.IsProduction()
+}
+
+// contentVisible reports whether an entry is served now
+func contentVisible(entry *structure.SiteContent, now time.Time) bool {
+	return showUnpublished() || entry.Published(now)
+}
+
+// collectionsData exposes the visible entries of the collections of a site as .Collections.<name>,
+// and the entries by tag and category as .Taxonomies.<name>.tags.<tag> and .Taxonomies.<name>.categories.<category>
+func collectionsData(site *structure.SiteStructure, now time.Time) (collections, taxonomies map[string]any) {
+	collections = make(map[string]any, len(site.Collections))
+	taxonomies = make(map[string]any, len(site.Collections))
+	for name, collection := range site.Collections {
+		entries := make([]any, 0, len(collection.Entries))
+		tags, categories := map[string]any{}, map[string]any{}
+		for _, entry := range collection.Entries {
+			if !contentVisible(entry, now) {
+				continue
+			}
+			entries = append(entries, entry.Values)
+			for _, tag := range entry.Tags {
+				tagged, _ := tags[tag].([]any)
+				tags[tag] = append(tagged, entry.Values)
+			}
+			for _, category := range entry.Categories {
+				listed, _ := categories[category].([]any)
+				categories[category] = append(listed, entry.Values)
+			}
+		}
+		collections[name] = entries
+		taxonomies[name] = map[string]any{"tags": tags, "categories": categories}
+	}
+	return collections, taxonomies
+}
+
+// matchContentRoute finds the visible entry of a collection route
+func matchContentRoute(site *structure.SiteStructure, parts []string) (structure.PageRoutes, map[string]any, bool) {
+	for _, name := range slices.Sorted(maps.Keys(site.Collections)) {
+		collection := site.Collections[name]
+		if collection.Pattern == nil {
+			continue
+		}
+		params, ok := matchPattern(collection.Pattern, parts)
+		if !ok {
+			continue
+		}
+		slug, _ := params["slug"].(string)
+		entry, ok := collection.Entry(slug)
+		if !ok || !contentVisible(entry, time.Now()) {
+			continue
+		}
+		return structure.PageRoutes{
+			Name:    strings.Trim(entry.URL, "/"),
+			Title:   entry.Title,
+			Path:    collection.Layout,
+			Pattern: collection.Pattern,
+			Entry:   entry,
+		}, params, true
+	}
+	return structure.PageRoutes{}, nil, false
+}
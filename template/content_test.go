@@ -0,0 +1,225 @@
+package template
+
+import (
+	"maps"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		front  map[string]any
+		body   string
+		err    string
+	}{
+		{
+			name:   "yaml",
+			source: "---\ntitle: Hello\ntags: [a, b]\n---\n# Body\n",
+			front:  map[string]any{"title": "Hello", "tags": []any{"a", "b"}},
+			body:   "# Body\n",
+		},
+		{
+			name:   "toml",
+			source: "+++\ntitle = \"Hello\"\ndraft = true\n+++\nbody",
+			front:  map[string]any{"title": "Hello", "draft": true},
+			body:   "body",
+		},
+		{
+			name:   "bom and crlf",
+			source: "\uFEFF---\r\ntitle: Hello\r\n---\r\nbody\r\n",
+			front:  map[string]any{"title": "Hello"},
+			body:   "body\n",
+		},
+		{
+			name:   "no front matter",
+			source: "# Body",
+			front:  map[string]any{},
+			body:   "# Body",
+		},
+		{
+			name:   "empty front matter",
+			source: "---\n# only a comment\n---\nbody",
+			front:  map[string]any{},
+			body:   "body",
+		},
+		{
+			name:   "front matter ends the file",
+			source: "---\ntitle: Hello\n---",
+			front:  map[string]any{"title": "Hello"},
+			body:   "",
+		},
+		{
+			name:   "not closed",
+			source: "---\ntitle: Hello\nbody",
+			err:    `front matter is not closed with "---"`,
+		},
+		{
+			name:   "invalid yaml",
+			source: "---\ntitle: [Hello\n---\nbody",
+			err:    "front matter: yaml:",
+		},
+		{
+			name:   "invalid toml",
+			source: "+++\ntitle = \n+++\nbody",
+			err:    "front matter: toml:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			front, body, err := SplitFrontMatter([]byte(tt.source))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(front, tt.front) {
+				t.Errorf("front = %#v, want %#v", front, tt.front)
+			}
+			if body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestDecodeYAML(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   map[string]any
+		err    string
+	}{
+		{
+			name:   "scalars",
+			source: "count: 3\nratio: 0.5\ndraft: false\nanswer: yes\nempty: ~\nquoted: \"2024-01-02\"",
+			want:   map[string]any{"count": 3, "ratio": 0.5, "draft": false, "answer": "yes", "empty": nil, "quoted": "2024-01-02"},
+		},
+		{
+			name:   "dates",
+			source: "date: 2024-01-02",
+			want:   map[string]any{"date": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:   "nested keys are strings",
+			source: "years:\n  2024: current\n  2023:\n    - old\n    - 1: one",
+			want: map[string]any{"years": map[string]any{
+				"2024": "current",
+				"2023": []any{"old", map[string]any{"1": "one"}},
+			}},
+		},
+		{
+			name:   "block text",
+			source: "summary: |\n  line one\n  line two\n",
+			want:   map[string]any{"summary": "line one\nline two\n"},
+		},
+		{
+			name:   "empty document",
+			source: "",
+			want:   map[string]any{},
+		},
+		{
+			name:   "top level sequence",
+			source: "- a\n- b",
+			err:    "cannot unmarshal !!seq",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeYAML([]byte(tt.source))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeYAML = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Entries are shared by every request, assignments of a render only change its own copy
+func TestAssignLeavesEntriesUnchanged(t *testing.T) {
+	engine := buildTestSite(t, "example.com", map[string]string{
+		"config.toml":           `domain = "example.com"`,
+		"layouts/root.hstm":     `{% passed %}`,
+		"layouts/blog.hstm":     `{% .Entry.Title %}{% assign .Entry.Title = "changed" %}{% assign .Entry.Params.x = 1 %}`,
+		"pages/page.hstm":       `{% each post in .Collections.blog %}{% .post.Title %}{% assign .post.Title = "changed" %}{% end-each %}`,
+		"content/blog/hello.md": "---\ntitle: Hello\n---\nbody",
+	})
+	for _, path := range []string{"/", "/blog/hello", "/", "/blog/hello"} {
+		var out strings.Builder
+		if _, err := renderTestRoute(t, engine, "example.com", path, &out); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if out.String() != "Hello" {
+			t.Errorf("%s = %q, want the title of the entry", path, out.String())
+		}
+	}
+	site, _ := engine.Sites.Get("example.com")
+	if params := site.Collections["blog"].Entries[0].Values["Params"].(map[string]any); params["x"] != nil {
+		t.Errorf("entry params were modified: %v", params)
+	}
+}
+
+func TestCollectionLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		layout string
+		err    string
+	}{
+		{"flat", map[string]string{"layouts/blog.hstm": `flat {% .Entry.Title %}`}, "flat Hello", ""},
+		{"index", map[string]string{"layouts/blog/index.hstm": `index {% .Entry.Title %}`}, "index Hello", ""},
+		{"flat wins", map[string]string{"layouts/blog.hstm": `flat`, "layouts/blog/index.hstm": `index`}, "flat", ""},
+		{"configured index", map[string]string{
+			"config.toml":             "domain = \"example.com\"\n[collections.blog]\nlayout = \"post\"\n",
+			"layouts/post/index.hstm": `post {% .Entry.Title %}`,
+		}, "post Hello", ""},
+		{"none", map[string]string{}, "", ""},
+		{"configured missing", map[string]string{
+			"config.toml": "domain = \"example.com\"\n[collections.blog]\nlayout = \"post\"\n",
+		}, "", `collections.blog: layout "post" not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{
+				"config.toml":           `domain = "example.com"`,
+				"layouts/root.hstm":     `{% passed %}`,
+				"content/blog/hello.md": "---\ntitle: Hello\n---\nbody",
+			}
+			maps.Copy(files, tt.files)
+			engine := buildTestSite(t, "example.com", files)
+			site, _ := engine.Sites.Get("example.com")
+			if tt.err != "" {
+				if len(site.ContentErrors) != 1 || !strings.Contains(site.ContentErrors[0].Error(), tt.err) {
+					t.Errorf("content errors = %v, want %q", site.ContentErrors, tt.err)
+				}
+				return
+			}
+			var out strings.Builder
+			_, err := renderTestRoute(t, engine, "example.com", "/blog/hello", &out)
+			if tt.layout == "" {
+				if err == nil {
+					t.Errorf("/blog/hello rendered %q without a layout", out.String())
+				}
+				return
+			}
+			if err != nil || out.String() != tt.layout {
+				t.Errorf("/blog/hello = %q, %v, want %q", out.String(), err, tt.layout)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// TagArgs are the arguments of tags such as partial and component, "card" title=.post.title only
+type TagArgs struct {
+	// Arguments without a name in order, quotes are kept
+	Positional []string
+	// name=expression pairs in order
+	Named []NamedArg
+}
+
+// NamedArg is a single name=expression argument
+type NamedArg struct {
+	Name string
+	Expr string
+}
+
+var namedArg = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_-]*)=([^=].*)?$`)
+
+// ParseTagArgs splits tag contents on whitespace outside of quotes and parentheses.
+// Values containing spaces such as filters need parentheses: title=(.post.title | upcase)
+func ParseTagArgs(contents string) (args TagArgs, err error) {
+	fields, err := splitArgs(contents)
+	if err != nil {
+		return args, err
+	}
+	for _, field := range fields {
+		m := namedArg.FindStringSubmatch(field)
+		if m == nil {
+			args.Positional = append(args.Positional, field)
+			continue
+		}
+		if m[2] == "" {
+			return args, fmt.Errorf("missing value for argument %q", m[1])
+		}
+		args.Named = append(args.Named, NamedArg{Name: m[1], Expr: m[2]})
+	}
+	return args, nil
+}
+
+// Name returns the first positional argument without quotes, the template name of partials and components
+func (args TagArgs) Name() string {
+	if len(args.Positional) == 0 {
+		return ""
+	}
+	return strings.Trim(args.Positional[0], "\"'`")
+}
+
+// Has reports whether a bare keyword such as "only" was given after the name
+func (args TagArgs) Has(keyword string) bool {
+	return len(args.Positional) > 1 && slices.Contains(args.Positional[1:], keyword)
+}
+
+// Props evaluates the named arguments in the current context
+func (args TagArgs) Props(ctx *structure.RenderCtx) (props map[string]any, errs []error) {
+	props = make(map[string]any, len(args.Named))
+	for _, arg := range args.Named {
+		value, evalErrs := EvaluateExpression(ctx, arg.Expr)
+		if len(evalErrs) > 0 {
+			errs = append(errs, evalErrs...)
+		}
+		props[arg.Name] = value
+	}
+	return props, errs
+}
+
+func splitArgs(contents string) (fields []string, err error) {
+	var current strings.Builder
+	var quote rune
+	depth := 0
+	escaped := false
+	for _, r := range contents {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case r == '(' || r == '[':
+			depth++
+		case r == ')' || r == ']':
+			depth--
+		case depth == 0 && (r == ' ' || r == '\t' || r == '\n' || r == '\r'):
+			if current.Len() > 0 {
+				fields = append(fields, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		current.WriteRune(r)
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string in %q", contents)
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses in %q", contents)
+	}
+	if current.Len() > 0 {
+		fields = append(fields, current.String())
+	}
+	return fields, nil
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"cmp"
 	"fmt"
 	"reflect"
 	"strings"
@@ -8,57 +9,13 @@ import (
 	"github.com/kato-studio/wispy/wispy_common/structure"
 )
 
-// ResolveCondition evaluates a condition string (e.g., "x > 5").
+// ResolveCondition evaluates a condition expression (e.g., ".x > 5 and not .hidden") to a boolean.
 func ResolveCondition(ctx *structure.RenderCtx, condition string) (val bool, errs []error) {
-	values := SplitRespectQuotes(condition)
-	vlen := len(values)
-	if vlen == 0 {
+	if strings.TrimSpace(condition) == "" {
 		return false, []error{fmt.Errorf("no conditions within \"%s\" statement:", condition)}
 	}
-
-	fv := values[0]
-	if strings.HasPrefix(fv, ".") && vlen == 1 {
-		value, err := ResolveVariable(ctx, fv)
-		if err != nil {
-			errs = append(errs, err)
-			return false, errs
-		}
-
-		// this if statement should work.. but doesn't?
-		if value == nil || value == "" || value == false {
-			return false, errs
-		}
-	}
-
-	//
-	if vlen == 3 {
-		left := values[0]
-		op := values[1]
-		right := values[2]
-		//
-		lhsVal, lhsErr := ResolveValue(ctx, left)
-		rhsVal, rhsErr := ResolveValue(ctx, right)
-		if lhsErr != nil {
-			errs = append(errs, fmt.Errorf("left operand error: %v", lhsErr))
-		}
-		if rhsErr != nil {
-			errs = append(errs, fmt.Errorf("right operand error: %v", rhsErr))
-		}
-
-		result, compareErr := compareValues(op, lhsVal, rhsVal)
-		if compareErr != nil {
-			errs = append(errs, fmt.Errorf("right operand error: %v", rhsErr))
-		}
-		return result, errs
-	}
-	//
-	// Handle truthy check
-	value, err := ResolveTruthy(ctx, condition)
-	if err != nil {
-		errs = append(errs, err)
-		return false, errs
-	}
-	return value, nil
+	value, errs := EvaluateExpression(ctx, condition)
+	return isTruthy(value), errs
 }
 
 func ResolveTruthy(ctx *structure.RenderCtx, expr string) (bool, error) {
@@ -100,6 +57,35 @@ func isTruthy(val any) bool {
 	}
 }
 
+// IsTruthy reports whether a value counts as true in conditions: false, nil, zero, "" and empty collections do not
+func IsTruthy(val any) bool {
+	return isTruthy(val)
+}
+
+// Equal reports whether two values are equal, numbers are compared by value
+func Equal(a, b any) bool {
+	return equal(a, b)
+}
+
+// Compare orders two values for sorting, numbers numerically and anything else by its string form.
+// nil sorts before any other value
+func Compare(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	af, aErr := toFloat(a)
+	bf, bErr := toFloat(b)
+	if aErr == nil && bErr == nil {
+		return cmp.Compare(af, bf)
+	}
+	return strings.Compare(Stringify(a), Stringify(b))
+}
+
 func compareValues(op string, lhs, rhs any) (bool, error) {
 	switch op {
 	case "==":
@@ -107,16 +93,73 @@ func compareValues(op string, lhs, rhs any) (bool, error) {
 	case "!=":
 		return !equal(lhs, rhs), nil
 	case ">", "<", ">=", "<=":
+		ls, lIsString := lhs.(string)
+		rs, rIsString := rhs.(string)
+		if lIsString && rIsString {
+			return compareStrings(op, ls, rs), nil
+		}
 		return compareNumbers(op, lhs, rhs)
+	case "in":
+		return contains(rhs, lhs)
+	case "contains":
+		return contains(lhs, rhs)
 	default:
 		return false, fmt.Errorf("unsupported operator %q", op)
 	}
 }
 
+// equal compares numbers by value so JSON floats match integer literals
 func equal(a, b any) bool {
+	af, aErr := toFloat(a)
+	bf, bErr := toFloat(b)
+	if aErr == nil && bErr == nil {
+		return af == bf
+	}
 	return reflect.DeepEqual(a, b)
 }
 
+func compareStrings(op string, a, b string) bool {
+	switch op {
+	case ">":
+		return a > b
+	case "<":
+		return a < b
+	case ">=":
+		return a >= b
+	default:
+		return a <= b
+	}
+}
+
+// contains reports whether collection holds item: list elements, map keys or substrings
+func contains(collection, item any) (bool, error) {
+	if collection == nil {
+		return false, nil
+	}
+	if s, ok := collection.(string); ok {
+		return strings.Contains(s, Stringify(item)), nil
+	}
+	rv := reflect.ValueOf(collection)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if equal(rv.Index(i).Interface(), item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case reflect.Map:
+		key := Stringify(item)
+		for _, k := range rv.MapKeys() {
+			if Stringify(k.Interface()) == key {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("cannot check membership in %T", collection)
+}
+
 func compareNumbers(op string, a, b any) (bool, error) {
 	af, err := toFloat(a)
 	if err != nil {
@@ -142,11 +185,10 @@ func compareNumbers(op string, a, b any) (bool, error) {
 }
 
 func toFloat(val any) (float64, error) {
+	if i, ok := toInt(val); ok {
+		return float64(i), nil
+	}
 	switch v := val.(type) {
-	case int:
-		return float64(v), nil
-	case int64:
-		return float64(v), nil
 	case float64:
 		return v, nil
 	case float32:
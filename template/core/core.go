@@ -1,8 +1,8 @@
 package core
 
 import (
-	"fmt"
-	"strings"
+	"io"
+	"slices"
 
 	"github.com/kato-studio/wispy/wispy_common/structure"
 )
@@ -22,47 +22,62 @@ import (
 //		FilterMap map[string]core.TemplateFilter
 //	}
 //
-// Render processes the raw template string and writes the rendered output to sb (String Builder)
-func Render(ctx *structure.RenderCtx, sb *strings.Builder, raw string) (errs []error) {
-	// Starting/Opening Delimiter
-	// var ds = ctx.Engine.DelimStart
-	var de = ctx.Engine.DelimEnd
-	pos := 0
-	length := len(raw)
+// Render parses the raw template string and writes the rendered output to w
+// templates rendered more than once should be loaded with LoadTemplate and run with ExecuteTemplate instead
+func Render(ctx *structure.RenderCtx, w io.Writer, raw string) (errs []error) {
+	return ExecuteTemplate(ctx, w, Parse(ctx.Engine, ctx.CurrentTemplatePath, raw))
+}
 
-	for pos < length {
-		startDelim, endDelim := FindDelim(ctx, raw, pos)
-		// If no more delimiters found, append the remaining text and break.
-		if startDelim >= len(raw) || startDelim == -1 {
-			sb.WriteString(raw[pos:])
-			break
-		}
-		// Append literal text between the current position and the next delimiter.
-		sb.WriteString(raw[pos:startDelim])
-		pos = startDelim
-		//
-		//* Core tag logic -----------
-		if endDelim == -1 {
-			errs = append(errs, fmt.Errorf("missing closing delimit not found %d", pos))
+// ExecuteTemplate writes a parsed template to w, including any errors found while parsing it
+func ExecuteTemplate(ctx *structure.RenderCtx, w io.Writer, tmpl *structure.Template) (errs []error) {
+	errs = append(errs, tmpl.Errors...)
+	return append(errs, Execute(ctx, w, tmpl.Nodes)...)
+}
+
+// Execute walks a list of parsed nodes and writes the rendered output to w
+func Execute(ctx *structure.RenderCtx, w io.Writer, nodes []*structure.Node) (errs []error) {
+	for _, node := range nodes {
+		if ctx.Halted || ctx.LoopSignal != structure.LoopNone {
 			break
-		} else {
-			endDelim = endDelim + len(de)
 		}
-		// Extract the contents of the variable.
-		tag_contents := strings.Trim(raw[pos:endDelim], ctx.Engine.CutSet)
-		if strings.HasPrefix(tag_contents, ".") {
-			if err := ResolveFiltersIfAny(ctx, sb, tag_contents); err != nil {
-				errs = append(errs, err)
+		switch node.Type {
+		case structure.TextNode:
+			io.WriteString(w, node.Content)
+		case structure.OutputNode:
+			if err := ResolveOutput(ctx, w, node); err != nil {
+				errs = append(errs, locateError(node, err))
 			}
-			pos = endDelim
-		} else {
-			var tagErrs []error
-			pos = endDelim
-			pos, tagErrs = ResolveTag(ctx, sb, pos, tag_contents, raw)
-			if len(tagErrs) > 0 {
-				errs = append(errs, tagErrs...)
+		case structure.TagNode:
+			for _, err := range ResolveTag(ctx, w, node) {
+				errs = append(errs, locateError(node, err))
 			}
 		}
 	}
 	return errs
 }
+
+// locateError turns an error raised by a node into a structure.TemplateError pointing at the node.
+// Errors already located in a template included by the node, such as a partial, get the node added to their chain.
+// Content placed by "passed" belongs to the template wrapped by the layout, so "passed" is left out of chains
+func locateError(node *structure.Node, err error) error {
+	te, located := err.(*structure.TemplateError)
+	if !located {
+		return structure.NewTemplateError(node.Template, node.Pos, node.Name, err)
+	}
+	if node.Name == "passed" {
+		return te
+	}
+	innermost := te.Path
+	if len(te.Chain) > 0 {
+		innermost = te.Chain[len(te.Chain)-1].Path
+	}
+	if node.Template == nil || innermost == node.Template.Path {
+		return te
+	}
+	// parse errors are cached with the template, so the chain is added to a copy
+	included := *te
+	included.Chain = slices.Clone(te.Chain)
+	line, column := node.Template.Location(node.Pos)
+	included.IncludedFrom(structure.TemplateFrame{Path: node.Template.Path, Line: line, Column: column, Tag: node.Name})
+	return &included
+}
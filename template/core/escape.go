@@ -0,0 +1,396 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// ----------------------
+//  HTML context tracking
+// ----------------------
+
+type htmlState int
+
+const (
+	stateText htmlState = iota
+	stateComment
+	stateTagName
+	stateTag
+	stateAttrName
+	stateAfterAttrName
+	stateBeforeValue
+	stateAttrValue
+	stateScript
+	stateStyle
+)
+
+// attributes holding URLs, values at their start are checked for unsafe schemes
+var urlAttributes = map[string]struct{}{
+	"href":       {},
+	"src":        {},
+	"action":     {},
+	"formaction": {},
+	"poster":     {},
+	"cite":       {},
+	"background": {},
+	"xlink:href": {},
+	"hx-get":     {},
+	"hx-post":    {},
+	"hx-put":     {},
+	"hx-patch":   {},
+	"hx-delete":  {},
+}
+
+// htmlContext follows the template text in source order so the parser knows where each output lands.
+// It is deliberately small, it only needs to tell text, attributes, scripts and styles apart.
+type htmlContext struct {
+	state    htmlState
+	tagName  strings.Builder
+	attrName strings.Builder
+	// quote of the current attribute value, 0 when unquoted
+	quote byte
+	// attribute value written so far, used to find the start and query of URLs
+	value strings.Builder
+	// quote of the current string inside a script
+	jsQuote byte
+}
+
+// feed advances the context over literal template text
+func (h *htmlContext) feed(text string) {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch h.state {
+		case stateText:
+			if c != '<' {
+				continue
+			}
+			if strings.HasPrefix(text[i:], "<!--") {
+				h.state = stateComment
+				i += 3
+			} else if i+1 < len(text) && (isLetter(text[i+1]) || text[i+1] == '/') {
+				h.state = stateTagName
+				h.tagName.Reset()
+			}
+		case stateComment:
+			if strings.HasPrefix(text[i:], "-->") {
+				h.state = stateText
+				i += 2
+			}
+		case stateTagName:
+			switch {
+			case c == '>':
+				h.endTag()
+			case isSpace(c):
+				h.state = stateTag
+			default:
+				h.tagName.WriteByte(c)
+			}
+		case stateTag:
+			switch {
+			case c == '>':
+				h.endTag()
+			case isSpace(c) || c == '/':
+			default:
+				h.state = stateAttrName
+				h.attrName.Reset()
+				h.attrName.WriteByte(c)
+			}
+		case stateAttrName:
+			switch {
+			case c == '>':
+				h.endTag()
+			case c == '=':
+				h.state = stateBeforeValue
+			case isSpace(c):
+				h.state = stateAfterAttrName
+			default:
+				h.attrName.WriteByte(c)
+			}
+		case stateAfterAttrName:
+			switch {
+			case c == '>':
+				h.endTag()
+			case c == '=':
+				h.state = stateBeforeValue
+			case isSpace(c) || c == '/':
+			default:
+				h.state = stateAttrName
+				h.attrName.Reset()
+				h.attrName.WriteByte(c)
+			}
+		case stateBeforeValue:
+			switch {
+			case isSpace(c):
+			case c == '>':
+				h.endTag()
+			case c == '"' || c == '\'':
+				h.state = stateAttrValue
+				h.quote = c
+				h.value.Reset()
+			default:
+				h.state = stateAttrValue
+				h.quote = 0
+				h.value.Reset()
+				h.value.WriteByte(c)
+			}
+		case stateAttrValue:
+			switch {
+			case h.quote != 0 && c == h.quote:
+				h.state = stateTag
+			case h.quote == 0 && isSpace(c):
+				h.state = stateTag
+			case h.quote == 0 && c == '>':
+				h.endTag()
+			default:
+				h.value.WriteByte(c)
+			}
+		case stateScript:
+			if h.jsQuote == 0 && hasPrefixFold(text[i:], "</script") {
+				h.state = stateTagName
+				h.tagName.Reset()
+				continue
+			}
+			switch {
+			case h.jsQuote == 0 && (c == '"' || c == '\'' || c == '`'):
+				h.jsQuote = c
+			case h.jsQuote != 0 && c == '\\':
+				i++
+			case h.jsQuote != 0 && c == h.jsQuote:
+				h.jsQuote = 0
+			}
+		case stateStyle:
+			if hasPrefixFold(text[i:], "</style") {
+				h.state = stateTagName
+				h.tagName.Reset()
+			}
+		}
+	}
+}
+
+// feedOutput marks that an output value was written at the current position
+func (h *htmlContext) feedOutput() {
+	switch h.state {
+	case stateBeforeValue:
+		// an output directly after "=" is an unquoted value
+		h.state = stateAttrValue
+		h.quote = 0
+		h.value.Reset()
+		h.value.WriteByte('x')
+	case stateAttrValue:
+		h.value.WriteByte('x')
+	}
+}
+
+func (h *htmlContext) endTag() {
+	switch strings.ToLower(h.tagName.String()) {
+	case "script":
+		h.state = stateScript
+		h.jsQuote = 0
+	case "style":
+		h.state = stateStyle
+	default:
+		h.state = stateText
+	}
+}
+
+// context returns how an output at the current position should be escaped
+func (h *htmlContext) context() structure.EscapeContext {
+	switch h.state {
+	case stateScript:
+		if h.jsQuote != 0 {
+			return structure.EscapeJSString
+		}
+		return structure.EscapeJSValue
+	case stateStyle:
+		return structure.EscapeCSS
+	case stateTagName, stateTag, stateAttrName, stateAfterAttrName:
+		return structure.EscapeAttrUnquoted
+	case stateBeforeValue, stateAttrValue:
+		attr := strings.ToLower(h.attrName.String())
+		quoted := h.state == stateAttrValue && h.quote != 0
+		switch {
+		case strings.HasPrefix(attr, "on"):
+			return structure.EscapeJSString
+		case isURLAttribute(attr):
+			if strings.ContainsAny(h.value.String(), "?#") {
+				return structure.EscapeURLQuery
+			}
+			if h.state == stateBeforeValue || h.value.Len() == 0 {
+				return structure.EscapeURL
+			}
+		}
+		if quoted {
+			return structure.EscapeAttr
+		}
+		return structure.EscapeAttrUnquoted
+	}
+	return structure.EscapeHTML
+}
+
+func isURLAttribute(attr string) bool {
+	_, ok := urlAttributes[attr]
+	return ok
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// ----------------------
+//  Escaping
+// ----------------------
+
+// replaces URLs with schemes that can run code, matching the approach of html/template
+const unsafeURL = "about:invalid#wispy-unsafe-url"
+
+// AutoEscapeEnabled reports whether output is escaped for the site being rendered
+func AutoEscapeEnabled(ctx *structure.RenderCtx) bool {
+	if ctx.Site != nil && ctx.Site.Config.AutoEscape != nil {
+		return *ctx.Site.Config.AutoEscape
+	}
+	return ctx.Engine.AutoEscape
+}
+
+// EscapeValue formats a value for the given context, structure.SafeHTML values are written as-is and
+// structure.EscapedHTML values are unescaped first
+func EscapeValue(context structure.EscapeContext, value any) string {
+	if safe, ok := value.(structure.SafeHTML); ok {
+		return string(safe)
+	}
+	if escaped, ok := value.(structure.EscapedHTML); ok {
+		value = html.UnescapeString(string(escaped))
+	}
+	switch context {
+	case structure.EscapeAttr:
+		return html.EscapeString(Stringify(value))
+	case structure.EscapeAttrUnquoted:
+		return escapeUnquoted(html.EscapeString(Stringify(value)))
+	case structure.EscapeURL:
+		return html.EscapeString(escapeURL(Stringify(value)))
+	case structure.EscapeURLQuery:
+		return url.QueryEscape(Stringify(value))
+	case structure.EscapeJSString:
+		return escapeJSString(Stringify(value))
+	case structure.EscapeJSValue:
+		return escapeJSValue(value)
+	case structure.EscapeCSS:
+		return escapeCSS(Stringify(value))
+	default:
+		return html.EscapeString(Stringify(value))
+	}
+}
+
+var unquotedReplacer = strings.NewReplacer(
+	" ", "&#32;",
+	"\t", "&#9;",
+	"\n", "&#10;",
+	"\r", "&#13;",
+	"=", "&#61;",
+	"`", "&#96;",
+)
+
+func escapeUnquoted(s string) string {
+	return unquotedReplacer.Replace(s)
+}
+
+// escapeURL rejects schemes other than http, https, mailto and tel and encodes characters that are invalid in URLs
+func escapeURL(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if i := strings.IndexAny(trimmed, ":/?#"); i > 0 && trimmed[i] == ':' {
+		switch strings.ToLower(trimmed[:i]) {
+		case "http", "https", "mailto", "tel":
+		default:
+			return unsafeURL
+		}
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c == '"' || c == '\'' || c == '<' || c == '>' || c == '`' || c >= 0x7f {
+			fmt.Fprintf(&sb, "%%%02X", c)
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// escapeJSString escapes a value for use inside a quoted JS string, the result is also safe in HTML attributes
+func escapeJSString(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\'':
+			sb.WriteString(`\x27`)
+		case '"':
+			sb.WriteString(`\x22`)
+		case '`':
+			sb.WriteString(`\x60`)
+		case '$':
+			// "${" would start a substitution in a template literal
+			sb.WriteString(`\x24`)
+		case '<':
+			sb.WriteString(`\x3C`)
+		case '>':
+			sb.WriteString(`\x3E`)
+		case '&':
+			sb.WriteString(`\x26`)
+		case '=':
+			sb.WriteString(`\x3D`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\u2028':
+			sb.WriteString(`\u2028`)
+		case '\u2029':
+			sb.WriteString(`\u2029`)
+		default:
+			if r < ' ' {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+				continue
+			}
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// escapeJSValue writes a value as a JS literal, json.Marshal already escapes <, > and &
+func escapeJSValue(value any) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return `"` + escapeJSString(Stringify(value)) + `"`
+	}
+	return strings.NewReplacer("\u2028", `\u2028`, "\u2029", `\u2029`).Replace(string(encoded))
+}
+
+// escapeCSS escapes anything that could end a declaration, string or the style element
+func escapeCSS(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if r < 0x80 && !(isLetter(byte(r)) || isDigit(byte(r)) || strings.ContainsRune(" #%,.-_", r)) {
+			fmt.Fprintf(&sb, `\%X `, r)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,118 @@
+package core_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kato-studio/wispy/template/core"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+const unsafeURL = "about:invalid#wispy-unsafe-url"
+
+func TestEscapeValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		context structure.EscapeContext
+		value   any
+		want    string
+	}{
+		{"html", structure.EscapeHTML, `<b>"Tom" & 'Jerry'</b>`, `&lt;b&gt;&#34;Tom&#34; &amp; &#39;Jerry&#39;&lt;/b&gt;`},
+		{"html safe", structure.EscapeHTML, structure.SafeHTML("<b>bold</b>"), "<b>bold</b>"},
+		{"html number", structure.EscapeHTML, 42, "42"},
+		{"attr", structure.EscapeAttr, `a" onclick="x`, `a&#34; onclick=&#34;x`},
+		{"attr unquoted", structure.EscapeAttrUnquoted, "a b=c`", "a&#32;b&#61;c&#96;"},
+		{"url http", structure.EscapeURL, "https://example.com/a?b=1&c=2", "https://example.com/a?b=1&amp;c=2"},
+		{"url relative", structure.EscapeURL, "/blog/post one", "/blog/post%20one"},
+		{"url quotes", structure.EscapeURL, `/a"b'c<d>`, "/a%22b%27c%3Cd%3E"},
+		{"url mailto", structure.EscapeURL, "mailto:ann@example.com", "mailto:ann@example.com"},
+		{"url tel", structure.EscapeURL, "tel:+123", "tel:+123"},
+		{"url javascript", structure.EscapeURL, "javascript:alert(1)", unsafeURL},
+		{"url javascript case", structure.EscapeURL, "JavaScript:alert(1)", unsafeURL},
+		{"url javascript space", structure.EscapeURL, "  javascript:alert(1)", unsafeURL},
+		{"url data", structure.EscapeURL, "data:text/html,<script>", unsafeURL},
+		{"url vbscript", structure.EscapeURL, "vbscript:msgbox", unsafeURL},
+		{"url colon in path", structure.EscapeURL, "/a:b", "/a:b"},
+		{"url colon in query", structure.EscapeURL, "?next=javascript:x", "?next=javascript:x"},
+		{"url query", structure.EscapeURLQuery, "a b&c=d", "a+b%26c%3Dd"},
+		{"js string", structure.EscapeJSString, "it's \"</script>\"\n", `it\x27s \x22\x3C/script\x3E\x22\n`},
+		{"js string backslash", structure.EscapeJSString, `a\b`, `a\\b`},
+		{"js string substitution", structure.EscapeJSString, "${alert(1)}", `\x24{alert(1)}`},
+		{"js string separators", structure.EscapeJSString, "a\u2028b", `a\u2028b`},
+		{"js value string", structure.EscapeJSValue, "</script>", `"\u003c/script\u003e"`},
+		{"js value number", structure.EscapeJSValue, 1.5, "1.5"},
+		{"js value list", structure.EscapeJSValue, []any{"a", 1}, `["a",1]`},
+		{"css", structure.EscapeCSS, "red; background: url(x)", `red\3B  background\3A  url\28 x\29 `},
+		{"css plain", structure.EscapeCSS, "#fff", "#fff"},
+		{"css style end", structure.EscapeCSS, "</style>", `\3C \2F style\3E `},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := core.EscapeValue(tt.context, tt.value); got != tt.want {
+				t.Errorf("EscapeValue(%v, %q) = %q, want %q", tt.context, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// Outputs are escaped by where they land in the HTML around them
+func TestAutoEscapeContexts(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"text", `<p>{% .v %}</p>`, `<p>&lt;x&gt; &#34;q&#34;</p>`},
+		{"raw", `<p>{% .v | raw %}</p>`, `<p><x> "q"</p>`},
+		{"quoted attr", `<p title="{% .v %}">`, `<p title="&lt;x&gt; &#34;q&#34;">`},
+		{"single quoted attr", `<p title='{% .v %}'>`, `<p title='&lt;x&gt; &#34;q&#34;'>`},
+		{"unquoted attr", `<p title={% .v %}>`, `<p title=&lt;x&gt;&#32;&#34;q&#34;>`},
+		{"href", `<a href="{% .js %}">`, `<a href="` + unsafeURL + `">`},
+		{"href unquoted", `<a href={% .js %}>`, `<a href=` + unsafeURL + `>`},
+		{"href upper", `<A HREF="{% .js %}">`, `<A HREF="` + unsafeURL + `">`},
+		{"hx-get", `<div hx-get="{% .js %}">`, `<div hx-get="` + unsafeURL + `">`},
+		{"href after prefix", `<a href="/search/{% .v %}">`, `<a href="/search/&lt;x&gt; &#34;q&#34;">`},
+		{"href query", `<a href="/search?q={% .v %}">`, `<a href="/search?q=%3Cx%3E+%22q%22">`},
+		{"href safe", `<a href="{% .url %}">`, `<a href="https://example.com/?a=1&amp;b=2">`},
+		{"event handler", `<button onclick="go('{% .v %}')">`, `<button onclick="go('\x3Cx\x3E \x22q\x22')">`},
+		{"script value", `<script>var v = {% .v %};</script>`, `<script>var v = "\u003cx\u003e \"q\"";</script>`},
+		{"script string", `<script>var v = "{% .v %}";</script>`, `<script>var v = "\x3Cx\x3E \x22q\x22";</script>`},
+		{"script template literal", "<script>let s = `{% .tpl %}`;</script>", "<script>let s = `\\x24{alert(1)}\\x60`;</script>"},
+		{"style", `<style>p { color: {% .v %} }</style>`, `<style>p { color: \3C x\3E  \22 q\22  }</style>`},
+		{"after script", `<script>1</script><p>{% .v %}</p>`, `<script>1</script><p>&lt;x&gt; &#34;q&#34;</p>`},
+		{"escape filter", `<p title="{% .v | escape %}">{% .v | escape %}</p>`, `<p title="&lt;x&gt; &#34;q&#34;">&lt;x&gt; &#34;q&#34;</p>`},
+		{"escape filter href", `<a href="{% .js | escape %}">`, `<a href="` + unsafeURL + `">`},
+		{"escape filter event handler", `<button onclick="go('{% .quote | escape %}')">`, `<button onclick="go('\x27);alert(1);//')">`},
+		{"escape filter script", `<script>var v = "{% .quote | escape %}";</script>`, `<script>var v = "\x27);alert(1);//";</script>`},
+		{"comment", `<!-- <a href=" -->{% .v %}`, `<!-- <a href=" -->&lt;x&gt; &#34;q&#34;`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string]any{"v": `<x> "q"`, "js": "javascript:alert(1)", "url": "https://example.com/?a=1&b=2", "tpl": "${alert(1)}`", "quote": "');alert(1);//"}
+			var out strings.Builder
+			if errs := core.Render(newCtx(data), &out, tt.src); len(errs) > 0 {
+				t.Fatalf("Render(%q) errors: %v", tt.src, errs)
+			}
+			if out.String() != tt.want {
+				t.Errorf("Render(%q)\n got %s\nwant %s", tt.src, out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAutoEscapeDisabled(t *testing.T) {
+	ctx := newCtx(map[string]any{"v": "<b>"})
+	ctx.Engine.AutoEscape = false
+	var out strings.Builder
+	core.Render(ctx, &out, `<p>{% .v %}</p>`)
+	if out.String() != "<p><b></p>" {
+		t.Errorf("Render with auto escape off = %q", out.String())
+	}
+
+	// without auto-escaping the escape filter is the only escaping
+	out.Reset()
+	core.Render(ctx, &out, `<p>{% .v | escape %}</p>`)
+	if out.String() != "<p>&lt;b&gt;</p>" {
+		t.Errorf("escape filter with auto escape off = %q", out.String())
+	}
+}
@@ -0,0 +1,708 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+/*
+Expressions are used by output tags "{% .a + 1 %}", "if" conditions and "assign" values.
+
+	or, and, not          boolean logic, "or" & "and" return the deciding operand
+	== != > < >= <=       comparisons
+	in, contains          membership in lists, map keys and substrings
+	+ - * / %             arithmetic, "+" concatenates when either side is a string
+	( )                   grouping
+	.a.b .list.0 .m["k"]  variables from Props and Data
+	"str" 'str' 1 2.5     literals, plus true, false and nil
+	value | filter arg    filter pipelines, arguments may be any value including "(.a | upcase)"
+*/
+
+// Expression is a compiled template expression that can be evaluated against any render context
+type Expression struct {
+	Source string
+	root   exprNode
+}
+
+// compiled expressions are shared by every template that uses the same source
+var expressionCache sync.Map
+
+// CompileExpression parses an expression, compiled expressions are cached by their source
+func CompileExpression(src string) (*Expression, error) {
+	if cached, ok := expressionCache.Load(src); ok {
+		return cached.(*Expression), nil
+	}
+	tokens, err := tokenizeExpression(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", src, err)
+	}
+	p := exprParser{tokens: tokens}
+	root, err := p.parsePipe()
+	if err == nil && p.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", src, err)
+	}
+	expr := &Expression{Source: src, root: root}
+	expressionCache.Store(src, expr)
+	return expr, nil
+}
+
+// Evaluate resolves the expression, errors such as undefined variables are collected
+// while evaluation continues so "or" and "and" still work with missing values
+func (e *Expression) Evaluate(ctx *structure.RenderCtx) (any, []error) {
+	ev := evaluator{ctx: ctx}
+	value, err := ev.eval(e.root)
+	if err != nil {
+		ev.errs = append(ev.errs, fmt.Errorf("%w in %q", err, e.Source))
+	}
+	return value, ev.errs
+}
+
+// EvaluateExpression compiles (or loads from cache) and evaluates an expression
+func EvaluateExpression(ctx *structure.RenderCtx, src string) (any, []error) {
+	expr, err := CompileExpression(src)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return expr.Evaluate(ctx)
+}
+
+// PipedFilters returns the names of the filters piped in src, "| name", skipping quoted strings.
+// It works on any tag contents, including arguments such as title=(.title | upcase) that are not a single expression
+func PipedFilters(src string) (names []string) {
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == '"' || c == '\'' || c == '`':
+			for i++; i < len(src) && src[i] != c; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+		case c == '|':
+			if i+1 < len(src) && src[i+1] == '|' {
+				i++
+				continue
+			}
+			start := i + 1
+			for start < len(src) && (src[start] == ' ' || src[start] == '\t' || src[start] == '\n' || src[start] == '\r') {
+				start++
+			}
+			end := start
+			for end < len(src) && isIdentChar(src[end]) {
+				end++
+			}
+			if end > start {
+				names = append(names, src[start:end])
+			}
+		}
+	}
+	return names
+}
+
+// ----------------------
+//  Tokenizer
+// ----------------------
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokVariable
+	tokIdent
+	tokOperator
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokPipe
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// parsed literal for numbers and strings
+	value any
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func tokenizeExpression(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			var sb strings.Builder
+			for end < len(src) && src[end] != c {
+				if src[end] == '\\' && end+1 < len(src) {
+					end++
+				}
+				sb.WriteByte(src[end])
+				end++
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("unterminated string starting at %d", i)
+			}
+			tokens = append(tokens, token{kind: tokString, text: src[i : end+1], value: sb.String()})
+			i = end + 1
+		case isDigit(c):
+			end := i
+			isFloat := false
+			for end < len(src) && (isDigit(src[end]) || (src[end] == '.' && !isFloat && end+1 < len(src) && isDigit(src[end+1]))) {
+				if src[end] == '.' {
+					isFloat = true
+				}
+				end++
+			}
+			text := src[i:end]
+			var value any
+			if isFloat {
+				f, _ := strconv.ParseFloat(text, 64)
+				value = f
+			} else {
+				n, err := strconv.Atoi(text)
+				if err != nil {
+					return nil, fmt.Errorf("invalid number %q", text)
+				}
+				value = n
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: text, value: value})
+			i = end
+		case c == '.':
+			end := i
+			for end < len(src) && (src[end] == '.' || isIdentChar(src[end])) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokVariable, text: src[i:end]})
+			i = end
+		case isIdentChar(c):
+			end := i
+			for end < len(src) && isIdentChar(src[end]) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[i:end]})
+			i = end
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")"})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{kind: tokLBracket, text: "["})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{kind: tokRBracket, text: "]"})
+			i++
+		case c == '|' && !strings.HasPrefix(src[i:], "||"):
+			tokens = append(tokens, token{kind: tokPipe, text: "|"})
+			i++
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", ">=", "<=", "&&", "||", ">", "<", "+", "-", "*", "/", "%", "!"} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			tokens = append(tokens, token{kind: tokOperator, text: op})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+// ----------------------
+//  Parser
+// ----------------------
+
+type exprNode interface{}
+
+type literalExpr struct{ value any }
+
+type variableExpr struct{ path string }
+
+type indexExpr struct{ target, index exprNode }
+
+type unaryExpr struct {
+	op      string
+	operand exprNode
+}
+
+type binaryExpr struct {
+	op          string
+	left, right exprNode
+}
+
+type filterExpr struct {
+	input exprNode
+	name  string
+	args  []exprNode
+}
+
+type exprParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isKeyword reports whether the next token is the given operator or keyword
+func (p *exprParser) isKeyword(words ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOperator && t.kind != tokIdent {
+		return "", false
+	}
+	for _, word := range words {
+		if t.text == word {
+			return word, true
+		}
+	}
+	return "", false
+}
+
+// pipe := or ("|" filterName primary*)*
+func (p *exprParser) parsePipe() (exprNode, error) {
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokPipe {
+		p.next()
+		name := p.next()
+		if name.kind != tokIdent {
+			return nil, fmt.Errorf("expected filter name after \"|\", got %q", name.text)
+		}
+		filter := &filterExpr{input: node, name: name.text}
+		for p.startsArgument() {
+			arg, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			filter.args = append(filter.args, arg)
+		}
+		node = filter
+	}
+	return node, nil
+}
+
+// startsArgument reports whether the next token can begin a filter argument
+func (p *exprParser) startsArgument() bool {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber, tokString, tokVariable, tokLParen:
+		return true
+	case tokIdent:
+		return t.text == "true" || t.text == "false" || t.text == "nil"
+	case tokOperator:
+		return t.text == "-"
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.isKeyword("or", "||"); !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "or", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.isKeyword("and", "&&"); !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "and", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if _, ok := p.isKeyword("not", "!"); ok {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "not", operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.isKeyword("==", "!=", ">", "<", ">=", "<=", "in", "contains")
+	if !ok {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryExpr{op: op, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.isKeyword("+", "-")
+		if !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.isKeyword("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if _, ok := p.isKeyword("-"); ok {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "-", operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+// postfix := primary ("[" pipe "]")*
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokLBracket {
+		p.next()
+		index, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRBracket {
+			return nil, fmt.Errorf("missing closing \"]\"")
+		}
+		node = &indexExpr{target: node, index: index}
+	}
+	return node, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber, tokString:
+		return &literalExpr{value: t.value}, nil
+	case tokVariable:
+		return &variableExpr{path: t.text}, nil
+	case tokLParen:
+		node, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRParen {
+			return nil, fmt.Errorf("missing closing \")\"")
+		}
+		return node, nil
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return &literalExpr{value: true}, nil
+		case "false":
+			return &literalExpr{value: false}, nil
+		case "nil", "null":
+			return &literalExpr{value: nil}, nil
+		}
+		return nil, fmt.Errorf("unknown identifier %q, variables start with \".\"", t.text)
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+// ----------------------
+//  Evaluator
+// ----------------------
+
+type evaluator struct {
+	ctx  *structure.RenderCtx
+	errs []error
+	// above zero while evaluating operands of boolean operators, where undefined values are expected
+	guarded int
+}
+
+func (ev *evaluator) eval(node exprNode) (any, error) {
+	switch n := node.(type) {
+	case *literalExpr:
+		return n.value, nil
+	case *variableExpr:
+		value, err := ResolveVariable(ev.ctx, n.path)
+		if err != nil {
+			// undefined values are nil so boolean logic can carry on
+			if ev.guarded == 0 {
+				if err = Undefined(ev.ctx, err); err != nil {
+					ev.errs = append(ev.errs, err)
+				}
+			}
+			return nil, nil
+		}
+		return value, nil
+	case *indexExpr:
+		target, err := ev.eval(n.target)
+		if err != nil {
+			return nil, err
+		}
+		index, err := ev.eval(n.index)
+		if err != nil {
+			return nil, err
+		}
+		return ParseDataPath([]string{Stringify(index)}, target), nil
+	case *unaryExpr:
+		if n.op == "not" {
+			ev.guarded++
+			operand, err := ev.eval(n.operand)
+			ev.guarded--
+			if err != nil {
+				return nil, err
+			}
+			return !isTruthy(operand), nil
+		}
+		operand, err := ev.eval(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		return arithmetic("-", 0, operand)
+	case *binaryExpr:
+		// short circuit boolean operators, "{% .title or "Untitled" %}" is not an undefined variable error
+		if n.op == "or" || n.op == "and" {
+			ev.guarded++
+			left, err := ev.eval(n.left)
+			ev.guarded--
+			if err != nil {
+				return nil, err
+			}
+			if isTruthy(left) == (n.op == "or") {
+				return left, nil
+			}
+			return ev.eval(n.right)
+		}
+		left, err := ev.eval(n.left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := ev.eval(n.right)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "+", "-", "*", "/", "%":
+			return arithmetic(n.op, left, right)
+		}
+		return compareValues(n.op, left, right)
+	case *filterExpr:
+		filter, ok := ev.ctx.Engine.FilterMap[n.name]
+		if !ok {
+			if err := Undefined(ev.ctx, fmt.Errorf("%w %q", structure.ErrUnknownFilter, n.name)); err != nil {
+				return nil, err
+			}
+			// silently skipped, the value passes through unchanged
+			return ev.eval(n.input)
+		}
+		if filter.AllowUndefined {
+			ev.guarded++
+		}
+		input, err := ev.eval(n.input)
+		if filter.AllowUndefined {
+			ev.guarded--
+		}
+		if err != nil {
+			return nil, err
+		}
+		args := make([]any, 0, len(n.args))
+		for _, argNode := range n.args {
+			arg, err := ev.eval(argNode)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		return CallFilter(filter, input, args)
+	}
+	return nil, fmt.Errorf("unknown expression node %T", node)
+}
+
+// isText reports whether "+" should concatenate, concatenated SafeHTML is escaped again unless piped through "raw"
+func isText(value any) bool {
+	switch value.(type) {
+	case string, structure.SafeHTML, structure.EscapedHTML:
+		return true
+	}
+	return false
+}
+
+// arithmetic applies a math operator, integers stay integers unless either side is a float
+func arithmetic(op string, left, right any) (any, error) {
+	if op == "+" {
+		if isText(left) || isText(right) {
+			return Stringify(left) + Stringify(right), nil
+		}
+	}
+
+	li, lIsInt := toInt(left)
+	ri, rIsInt := toInt(right)
+	if lIsInt && rIsInt {
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "/", "%":
+			if ri == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			if op == "%" {
+				return li % ri, nil
+			}
+			if li%ri == 0 {
+				return li / ri, nil
+			}
+			return float64(li) / float64(ri), nil
+		}
+	}
+
+	lf, err := toFloat(left)
+	if err != nil {
+		return nil, fmt.Errorf("left operand of %q is not a number: %v", op, Stringify(left))
+	}
+	rf, err := toFloat(right)
+	if err != nil {
+		return nil, fmt.Errorf("right operand of %q is not a number: %v", op, Stringify(right))
+	}
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(lf, rf), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %q", op)
+}
+
+// toInt reports whether val is an integer type and returns it as an int
+func toInt(val any) (int, bool) {
+	switch v := val.(type) {
+	case int:
+		return v, true
+	case int8:
+		return int(v), true
+	case int16:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case uint:
+		return int(v), true
+	case uint8:
+		return int(v), true
+	case uint16:
+		return int(v), true
+	case uint32:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	}
+	return 0, false
+}
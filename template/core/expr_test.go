@@ -0,0 +1,135 @@
+package core_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kato-studio/wispy/template"
+	"github.com/kato-studio/wispy/template/core"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// newCtx returns a render context of the default engine over data
+func newCtx(data map[string]any) *structure.RenderCtx {
+	engine := template.StartDefaultEngine()
+	return engine.InitCtx("", &structure.SiteStructure{}, data)
+}
+
+func testData() map[string]any {
+	return map[string]any{
+		"name":   "Ann",
+		"count":  3,
+		"price":  2.5,
+		"empty":  "",
+		"hidden": true,
+		"tags":   []any{"go", "web"},
+		"user":   map[string]any{"name": "Bob", "roles": []any{"admin"}},
+		"key":    "name",
+	}
+}
+
+func TestEvaluateExpression(t *testing.T) {
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{`.name`, "Ann"},
+		{`.user.name`, "Bob"},
+		{`.user["name"]`, "Bob"},
+		{`.user[.key]`, "Bob"},
+		{`.tags.1`, "web"},
+		{`"a" + "b"`, "ab"},
+		{`.name + 1`, "Ann1"},
+		{`1 + 2 * 3`, 7},
+		{`(1 + 2) * 3`, 9},
+		{`-3 + 1`, -2},
+		{`7 % 4`, 3},
+		{`7 / 2`, 3.5},
+		{`.price * 2`, 5.0},
+		{`.count > 2`, true},
+		{`.count >= 4`, false},
+		{`.count == 3 and .name == "Ann"`, true},
+		{`.empty or "fallback"`, "fallback"},
+		{`.name and .count`, 3},
+		{`not .hidden`, false},
+		{`!.hidden`, false},
+		{`not not .name`, true},
+		{`"go" in .tags`, true},
+		{`.tags contains "rust"`, false},
+		{`"admin" in .user.roles`, true},
+		{`"name" in .user`, true},
+		{`.name contains "nn"`, true},
+		{`true`, true},
+		{`false or nil`, nil},
+		{`nil | default "x"`, "x"},
+		{`.name | upcase`, "ANN"},
+		{`.missing | default (.name | downcase)`, "ann"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			got, errs := core.EvaluateExpression(newCtx(testData()), tt.src)
+			if len(errs) > 0 {
+				t.Fatalf("EvaluateExpression(%q) errors: %v", tt.src, errs)
+			}
+			if got != tt.want {
+				t.Errorf("EvaluateExpression(%q) = %#v, want %#v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileExpressionErrors(t *testing.T) {
+	tests := []string{
+		`.a +`,
+		`(.a`,
+		`.a )`,
+		`"unterminated`,
+		`title`,
+		`.a ==`,
+		`.a | `,
+	}
+	for _, src := range tests {
+		if _, err := core.CompileExpression(src); err == nil {
+			t.Errorf("CompileExpression(%q) succeeded, want an error", src)
+		}
+	}
+}
+
+func TestEvaluateExpressionUndefined(t *testing.T) {
+	_, errs := core.EvaluateExpression(newCtx(testData()), `.missing.value`)
+	if len(errs) == 0 {
+		t.Errorf("undefined variable reported no error")
+	}
+}
+
+func TestOutputExpressions(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`{% .name %}`, "Ann"},
+		{`{% "hi" | upcase %}`, "HI"},
+		{`{% 'hi' %}`, "hi"},
+		{`{% 42 %}`, "42"},
+		{`{% -3 | abs %}`, "3"},
+		{`{% (.count + 1) %}`, "4"},
+		{`{% not .hidden %}`, "False"},
+		{`{% !.hidden %}`, "False"},
+		{`{% true %}`, "True"},
+		{`{% false %}`, "False"},
+		{`{% nil | default "x" %}`, "x"},
+		{`{% nil|default "y" %}`, "y"},
+		{`{% if not .hidden %}shown{% else %}hidden{% end-if %}`, "hidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			var out strings.Builder
+			if errs := core.Render(newCtx(testData()), &out, tt.src); len(errs) > 0 {
+				t.Fatalf("Render(%q) errors: %v", tt.src, errs)
+			}
+			if out.String() != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.src, out.String(), tt.want)
+			}
+		})
+	}
+}
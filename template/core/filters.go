@@ -0,0 +1,182 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// CallFilter checks the arguments against the filter's declared Args, converts them and runs the handler
+func CallFilter(filter structure.TemplateFilter, input any, args []any) (any, error) {
+	converted, err := convertFilterArgs(filter, args)
+	if err != nil {
+		return nil, err
+	}
+	value, err := filter.Handler(input, converted)
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", filter.Name, err)
+	}
+	return value, nil
+}
+
+func convertFilterArgs(filter structure.TemplateFilter, args []any) ([]any, error) {
+	required := 0
+	for _, arg := range filter.Args {
+		if !arg.Optional {
+			required++
+		}
+	}
+	if len(args) < required || len(args) > len(filter.Args) {
+		return nil, fmt.Errorf("filter %q expects %s, got %d", filter.Name, describeArity(required, len(filter.Args)), len(args))
+	}
+
+	converted := make([]any, len(filter.Args))
+	for i, spec := range filter.Args {
+		if i >= len(args) {
+			converted[i] = spec.Default
+			continue
+		}
+		value, ok := convertFilterArg(spec.Type, args[i])
+		if !ok {
+			return nil, fmt.Errorf("filter %q argument %q must be %s, got %T %q", filter.Name, spec.Name, describeArgType(spec.Type), args[i], Stringify(args[i]))
+		}
+		converted[i] = value
+	}
+	return converted, nil
+}
+
+func convertFilterArg(argType structure.FilterArgType, value any) (any, bool) {
+	switch argType {
+	case structure.ArgString:
+		if value == nil {
+			return "", true
+		}
+		return Stringify(value), true
+	case structure.ArgInt:
+		if i, ok := toInt(value); ok {
+			return i, true
+		}
+		switch v := value.(type) {
+		case float64:
+			if v == math.Trunc(v) {
+				return int(v), true
+			}
+		case string:
+			if i, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+				return i, true
+			}
+		}
+		return nil, false
+	case structure.ArgFloat:
+		if f, ok := ToFloat(value); ok {
+			return f, true
+		}
+		return nil, false
+	case structure.ArgBool:
+		switch v := value.(type) {
+		case bool:
+			return v, true
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, true
+			}
+		}
+		return nil, false
+	case structure.ArgList:
+		if list, ok := ToList(value); ok {
+			return list, true
+		}
+		return nil, false
+	case structure.ArgMap:
+		if m, ok := ToMap(value); ok {
+			return m, true
+		}
+		return nil, false
+	}
+	return value, true
+}
+
+// ToFloat converts numbers and numeric strings to float64
+func ToFloat(value any) (float64, bool) {
+	if f, err := toFloat(value); err == nil {
+		return f, true
+	}
+	if s, ok := value.(string); ok {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// ToList converts any slice or array to []any
+func ToList(value any) ([]any, bool) {
+	if list, ok := value.([]any); ok {
+		return list, true
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	list := make([]any, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list, true
+}
+
+// ToMap converts any map with string keys to map[string]any
+func ToMap(value any) (map[string]any, bool) {
+	if m, ok := value.(map[string]any); ok {
+		return m, true
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	m := make(map[string]any, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		m[iter.Key().String()] = iter.Value().Interface()
+	}
+	return m, true
+}
+
+func describeArity(required, total int) string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return strconv.Itoa(n) + " arguments"
+	}
+	switch {
+	case required == total:
+		return plural(total)
+	case required == 0:
+		return "at most " + plural(total)
+	default:
+		return fmt.Sprintf("%d to %s", required, plural(total))
+	}
+}
+
+func describeArgType(argType structure.FilterArgType) string {
+	switch argType {
+	case structure.ArgString:
+		return "a string"
+	case structure.ArgInt:
+		return "an integer"
+	case structure.ArgFloat:
+		return "a number"
+	case structure.ArgBool:
+		return "a boolean"
+	case structure.ArgList:
+		return "a list"
+	case structure.ArgMap:
+		return "a map"
+	}
+	return "a value"
+}
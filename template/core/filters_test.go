@@ -0,0 +1,160 @@
+package core_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kato-studio/wispy/template/core"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// argsFilter returns the converted arguments of a filter taking one argument of argType
+func argsFilter(argType structure.FilterArgType) structure.TemplateFilter {
+	return structure.TemplateFilter{
+		Name: "probe",
+		Args: []structure.FilterArg{{Name: "arg", Type: argType}},
+		Handler: func(pipedValue any, args []any) (any, error) {
+			return args[0], nil
+		},
+	}
+}
+
+func TestCallFilterConversions(t *testing.T) {
+	tests := []struct {
+		name    string
+		argType structure.FilterArgType
+		arg     any
+		want    any
+		err     string
+	}{
+		{"any", structure.ArgAny, []any{1}, []any{1}, ""},
+		{"string of int", structure.ArgString, 3, "3", ""},
+		{"string of nil", structure.ArgString, nil, "", ""},
+		{"int", structure.ArgInt, 3, 3, ""},
+		{"int of whole float", structure.ArgInt, 3.0, 3, ""},
+		{"int of string", structure.ArgInt, " 12 ", 12, ""},
+		{"int of fraction", structure.ArgInt, 1.5, nil, `filter "probe" argument "arg" must be an integer, got float64 "1.5"`},
+		{"int of word", structure.ArgInt, "ten", nil, `argument "arg" must be an integer, got string "ten"`},
+		{"float", structure.ArgFloat, 2, 2.0, ""},
+		{"float of string", structure.ArgFloat, "2.5", 2.5, ""},
+		{"float of word", structure.ArgFloat, "x", nil, `argument "arg" must be a number, got string "x"`},
+		{"bool", structure.ArgBool, true, true, ""},
+		{"bool of string", structure.ArgBool, "false", false, ""},
+		{"bool of int", structure.ArgBool, 1, nil, `argument "arg" must be a boolean, got int "1"`},
+		{"list", structure.ArgList, []string{"a"}, []any{"a"}, ""},
+		{"list of string", structure.ArgList, "a", nil, `argument "arg" must be a list, got string "a"`},
+		{"map", structure.ArgMap, map[string]int{"a": 1}, map[string]any{"a": 1}, ""},
+		{"map of int keys", structure.ArgMap, map[int]any{1: "a"}, nil, `argument "arg" must be a map, got map[int]interface {}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := core.CallFilter(argsFilter(tt.argType), nil, []any{tt.arg})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("CallFilter(%v) error = %v, want %q", tt.arg, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CallFilter(%v) = %#v, want %#v", tt.arg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallFilterArity(t *testing.T) {
+	filter := structure.TemplateFilter{
+		Name: "pad",
+		Args: []structure.FilterArg{
+			{Name: "width", Type: structure.ArgInt},
+			{Name: "fill", Type: structure.ArgString, Optional: true, Default: " "},
+		},
+		Handler: func(pipedValue any, args []any) (any, error) {
+			return args, nil
+		},
+	}
+	tests := []struct {
+		args []any
+		want []any
+		err  string
+	}{
+		{[]any{2}, []any{2, " "}, ""},
+		{[]any{2, "-"}, []any{2, "-"}, ""},
+		{nil, nil, `filter "pad" expects 1 to 2 arguments, got 0`},
+		{[]any{1, "-", "x"}, nil, `filter "pad" expects 1 to 2 arguments, got 3`},
+	}
+	for _, tt := range tests {
+		got, err := core.CallFilter(filter, nil, tt.args)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("CallFilter(%v) error = %v, want %q", tt.args, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CallFilter(%v) = %v, %v, want %v", tt.args, got, err, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		args []structure.FilterArg
+		want string
+	}{
+		{nil, "0 arguments"},
+		{[]structure.FilterArg{{Name: "a"}}, "1 argument"},
+		{[]structure.FilterArg{{Name: "a", Optional: true}, {Name: "b", Optional: true}}, "at most 2 arguments"},
+	} {
+		filter := structure.TemplateFilter{Name: "f", Args: tt.args, Handler: filter.Handler}
+		_, err := core.CallFilter(filter, nil, []any{1, 2, 3})
+		if err == nil || !strings.Contains(err.Error(), "expects "+tt.want) {
+			t.Errorf("arity error = %v, want %q", err, tt.want)
+		}
+	}
+}
+
+func TestCallFilterHandlerError(t *testing.T) {
+	failure := errors.New("failed")
+	filter := structure.TemplateFilter{Name: "fail", Handler: func(pipedValue any, args []any) (any, error) {
+		return nil, failure
+	}}
+	if _, err := core.CallFilter(filter, nil, nil); !errors.Is(err, failure) || err.Error() != `filter "fail": failed` {
+		t.Errorf("CallFilter error = %v", err)
+	}
+}
+
+// Arguments of the built-in filters are converted from literals and variables of the template
+func TestFilterArguments(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+		err  string
+	}{
+		{`{% .name | truncate 2 %}`, "An", ""},
+		{`{% .name | truncate .count %}`, "Ann", ""},
+		{`{% .name | truncate "2" %}`, "An", ""},
+		{`{% .price | round 1 %}`, "2.5", ""},
+		{`{% .name | truncate "two" %}`, "", `filter "truncate" argument "length" must be an integer, got string "two"`},
+		{`{% .name | truncate %}`, "", `filter "truncate" expects 1 argument, got 0`},
+		{`{% .name | truncate 1 2 %}`, "", `filter "truncate" expects 1 argument, got 2`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			var out strings.Builder
+			errs := core.Render(newCtx(testData()), &out, tt.src)
+			if tt.err != "" {
+				if len(errs) == 0 || !strings.Contains(errs[0].Error(), tt.err) {
+					t.Fatalf("Render(%q) errors = %v, want %q", tt.src, errs, tt.err)
+				}
+				return
+			}
+			if len(errs) > 0 || out.String() != tt.want {
+				t.Errorf("Render(%q) = %q, %v, want %q", tt.src, out.String(), errs, tt.want)
+			}
+		})
+	}
+}
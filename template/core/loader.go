@@ -0,0 +1,59 @@
+package core
+
+import (
+	"os"
+
+	common "github.com/kato-studio/wispy/wispy_common"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// LoadTemplate returns the parsed template at path for the given site.
+// The file is only read and parsed when it is not in Engine.Templates yet,
+// outside of production cached templates are re-parsed when the file changed on disk.
+func LoadTemplate(engine *structure.TemplateEngine, site, path string) (*structure.Template, error) {
+	if engine.Templates != nil {
+		if tmpl, ok := engine.Templates.Get(site, path); ok {
+			if common.IsProduction() {
+				return tmpl, nil
+			}
+			if info, err := os.Stat(path); err == nil && info.ModTime().Equal(tmpl.ModTime) {
+				return tmpl, nil
+			}
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := Parse(engine, path, string(raw))
+	tmpl.ModTime = info.ModTime()
+	if engine.Templates != nil {
+		engine.Templates.Set(site, tmpl)
+	}
+	return tmpl, nil
+}
+
+// LoadFirstTemplate loads the first of the given paths that exists,
+// used by tags that accept both "name.hstm" and "name/index.hstm".
+func LoadFirstTemplate(engine *structure.TemplateEngine, site string, paths ...string) (tmpl *structure.Template, err error) {
+	for _, path := range paths {
+		tmpl, err = LoadTemplate(engine, site, path)
+		if err == nil {
+			return tmpl, nil
+		}
+	}
+	return nil, err
+}
+
+// SiteKey is the key a render context's templates are cached under
+func SiteKey(ctx *structure.RenderCtx) string {
+	if ctx.Site == nil {
+		return ctx.ScopedDirectory
+	}
+	return ctx.Site.Domain
+}
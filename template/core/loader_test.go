@@ -0,0 +1,105 @@
+package core_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kato-studio/wispy/template"
+	"github.com/kato-studio/wispy/template/core"
+)
+
+// writeTemplate writes source to path with a modification time, so changes are seen without waiting for the clock
+func writeTemplate(t *testing.T, path, source string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadTemplateCache(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name string
+		env  string
+		// write the file again with a later modification time
+		change bool
+		// drop the template from the cache, as a rebuild of the site does
+		invalidate bool
+		reparsed   bool
+	}{
+		{name: "unchanged", env: "development", reparsed: false},
+		{name: "changed while developing", env: "development", change: true, reparsed: true},
+		{name: "changed in production", env: "production", change: true, reparsed: false},
+		{name: "invalidated in production", env: "production", invalidate: true, reparsed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENV", tt.env)
+			engine := template.StartDefaultEngine()
+			path := filepath.Join(t.TempDir(), "page.hstm")
+			writeTemplate(t, path, "first", start)
+
+			first, err := core.LoadTemplate(engine, "example.com", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.change {
+				writeTemplate(t, path, "second", start.Add(time.Minute))
+			}
+			if tt.invalidate {
+				engine.Templates.Invalidate("example.com", path)
+			}
+			again, err := core.LoadTemplate(engine, "example.com", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reparsed := again != first; reparsed != tt.reparsed {
+				t.Errorf("template reparsed = %v, want %v", reparsed, tt.reparsed)
+			}
+			if tt.change && tt.reparsed && again.Source != "second" {
+				t.Errorf("reparsed source = %q, want the changed file", again.Source)
+			}
+		})
+	}
+}
+
+func TestTemplateCacheInvalidateSite(t *testing.T) {
+	engine := template.StartDefaultEngine()
+	path := filepath.Join(t.TempDir(), "page.hstm")
+	writeTemplate(t, path, "page", time.Now())
+	for _, site := range []string{"a.com", "b.com"} {
+		if _, err := core.LoadTemplate(engine, site, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// sites cache their templates apart, a rebuilt site drops only its own
+	engine.Templates.InvalidateSite("a.com")
+	if _, ok := engine.Templates.Get("a.com", path); ok {
+		t.Errorf("template of the invalidated site is still cached")
+	}
+	if _, ok := engine.Templates.Get("b.com", path); !ok {
+		t.Errorf("template of another site was dropped")
+	}
+}
+
+func TestLoadFirstTemplate(t *testing.T) {
+	engine := template.StartDefaultEngine()
+	dir := t.TempDir()
+	index := filepath.Join(dir, "nav", "index.hstm")
+	os.MkdirAll(filepath.Dir(index), 0o755)
+	writeTemplate(t, index, "index", time.Now())
+
+	tmpl, err := core.LoadFirstTemplate(engine, "example.com", filepath.Join(dir, "nav.hstm"), index)
+	if err != nil || tmpl.Path != index {
+		t.Errorf("LoadFirstTemplate = %v, %v, want %s", tmpl, err, index)
+	}
+	if _, err := core.LoadFirstTemplate(engine, "example.com", filepath.Join(dir, "missing.hstm")); !os.IsNotExist(err) {
+		t.Errorf("LoadFirstTemplate of a missing template error = %v", err)
+	}
+}
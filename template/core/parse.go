@@ -0,0 +1,249 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// parseFrame is an open block tag waiting for its "end-" tag
+type parseFrame struct {
+	node *structure.Node
+	tag  structure.TemplateTag
+	kind structure.TagKind
+	// list new nodes are appended to
+	list *[]*structure.Node
+}
+
+// Parse turns a raw template into a tree of nodes that can be executed many times.
+// Block tags registered in Engine.TagMap collect their body into Node.Children,
+// errors such as unbalanced end tags are stored on the returned template.
+func Parse(engine *structure.TemplateEngine, path, raw string) *structure.Template {
+	tmpl := &structure.Template{Path: path, Source: raw}
+	var ds = engine.DelimStart
+	var de = engine.DelimEnd
+
+	stack := []*parseFrame{{list: &tmpl.Nodes}}
+	// follows the HTML around each output so it can be escaped for its context
+	var escape htmlContext
+	emit := func(node *structure.Node) {
+		switch node.Type {
+		case structure.TextNode:
+			escape.feed(node.Content)
+		case structure.OutputNode:
+			node.Escape = escape.context()
+			escape.feedOutput()
+		}
+		top := stack[len(stack)-1]
+		*top.list = append(*top.list, node)
+	}
+
+	pos := 0
+	length := len(raw)
+	for pos < length {
+		startDelim := SeekIndex(raw, ds, pos)
+		// If no more delimiters found, keep the remaining text and stop.
+		if startDelim == -1 {
+			emit(&structure.Node{Type: structure.TextNode, Content: raw[pos:], Pos: pos, Template: tmpl})
+			break
+		}
+		// Keep literal text between the current position and the next delimiter.
+		if startDelim > pos {
+			emit(&structure.Node{Type: structure.TextNode, Content: raw[pos:startDelim], Pos: pos, Template: tmpl})
+		}
+		endDelim := SeekIndex(raw, de, startDelim+len(ds))
+		if endDelim == -1 {
+			parseError(tmpl, startDelim, "", fmt.Errorf("missing closing delimiter %q", de))
+			break
+		}
+		endDelim += len(de)
+		pos = endDelim
+
+		// Extract the contents of the variable or tag.
+		tag_contents := strings.Trim(raw[startDelim:endDelim], engine.CutSet)
+		if isOutputExpression(tag_contents) {
+			emit(&structure.Node{Type: structure.OutputNode, Content: tag_contents, Pos: startDelim, Template: tmpl})
+			continue
+		}
+
+		tagName, contents := cutTagName(tag_contents)
+		if tagName == "" {
+			parseError(tmpl, startDelim, "", fmt.Errorf("could not resolve tag name in %q", tag_contents))
+			continue
+		}
+
+		// Closing tags end the nearest open block with the same name
+		if closes, ok := strings.CutPrefix(tagName, "end-"); ok {
+			if !closeFrame(&stack, closes) {
+				parseError(tmpl, startDelim, tagName, fmt.Errorf("unexpected end tag %q", tagName))
+			}
+			continue
+		}
+
+		// Clauses of the open block start a new branch, "{% else-if .x %}" or "{% else %}"
+		if clauseFrame(stack, tagName) {
+			hoistOptional(&stack)
+			top := stack[len(stack)-1]
+			if last := len(top.node.Branches) - 1; last >= 0 && top.node.Branches[last].Name == "else" {
+				parseError(tmpl, startDelim, tagName, fmt.Errorf("%q after \"else\" in %q", tagName, top.node.Name))
+			}
+			branch := &structure.Node{Type: structure.TagNode, Name: tagName, Content: contents, Pos: startDelim, Template: tmpl}
+			top.node.Branches = append(top.node.Branches, branch)
+			top.list = &branch.Children
+			continue
+		}
+
+		node := &structure.Node{Type: structure.TagNode, Name: tagName, Content: contents, Pos: startDelim, Template: tmpl}
+		emit(node)
+
+		// unknown tags are kept as inline nodes and reported when executed
+		templateTag, tagExists := engine.TagMap[tagName]
+		if !tagExists {
+			continue
+		}
+		switch templateTag.Kind {
+		case structure.KindBlock, structure.KindRest, structure.KindOptional:
+			stack = append(stack, &parseFrame{node: node, tag: templateTag, kind: templateTag.Kind, list: &node.Children})
+		case structure.KindRaw:
+			bodyEnd, closeEnd := seekRawEnd(engine, raw, tagName, pos)
+			if bodyEnd == -1 {
+				parseError(tmpl, startDelim, tagName, fmt.Errorf("could not find end tag for %q", tagName))
+				continue
+			}
+			node.Children = []*structure.Node{{Type: structure.TextNode, Content: raw[pos:bodyEnd], Pos: pos, Template: tmpl}}
+			pos = closeEnd
+		}
+	}
+
+	// Rest tags are allowed to run to the end of the template and optional tags have no body, anything else is unclosed
+	for len(stack) > 1 {
+		top := stack[len(stack)-1]
+		switch top.kind {
+		case structure.KindOptional:
+			hoistOptional(&stack)
+			continue
+		case structure.KindRest:
+		default:
+			parseError(tmpl, top.node.Pos, top.node.Name, fmt.Errorf("could not find end tag for %q", "end-"+top.node.Name))
+		}
+		stack = stack[:len(stack)-1]
+	}
+	return tmpl
+}
+
+// parseError records an error located at pos on the template
+func parseError(tmpl *structure.Template, pos int, tag string, err error) {
+	tmpl.Errors = append(tmpl.Errors, structure.NewTemplateError(tmpl, pos, tag, err))
+}
+
+// Words starting an output expression rather than naming a tag, "{% not .hidden %}", "{% nil | default "x" %}"
+var expressionKeywords = []string{"not", "true", "false", "nil", "null"}
+
+// isOutputExpression reports whether tag contents are an output expression rather than a tag,
+// outputs start with a variable, a literal, a keyword, a minus sign or a parenthesis: "{% .title %}", "{% "hi" | upcase %}"
+func isOutputExpression(tag_contents string) bool {
+	if tag_contents == "" {
+		return false
+	}
+	word := tag_contents
+	if i := strings.IndexAny(word, " \t\r\n|()"); i != -1 {
+		word = word[:i]
+	}
+	if slices.Contains(expressionKeywords, strings.ToLower(word)) {
+		return true
+	}
+	switch c := tag_contents[0]; {
+	case c == '.', c == '"', c == '\'', c == '(', c == '!':
+		return true
+	case c == '-' && len(tag_contents) > 1:
+		// negative numbers and negated variables, "{% -3 | abs %}"
+		return isDigit(tag_contents[1]) || tag_contents[1] == '.'
+	default:
+		return isDigit(c)
+	}
+}
+
+// cutTagName splits tag contents into the tag name and the remaining contents
+func cutTagName(tag_contents string) (name, contents string) {
+	i := strings.IndexAny(tag_contents, " \t\r\n")
+	if i == -1 {
+		return tag_contents, ""
+	}
+	return tag_contents[:i], strings.TrimSpace(tag_contents[i+1:])
+}
+
+// closeFrame pops the stack up to and including the nearest frame named name,
+// open rest tags in between are closed implicitly and open optional tags turn out to have no body.
+func closeFrame(stack *[]*parseFrame, name string) bool {
+	frames := *stack
+	for i := len(frames) - 1; i > 0; i-- {
+		if frames[i].node.Name == name {
+			for len(*stack) > i+1 {
+				if !hoistOptional(stack) {
+					*stack = (*stack)[:len(*stack)-1]
+				}
+			}
+			*stack = (*stack)[:i]
+			return true
+		}
+		if frames[i].kind != structure.KindRest && frames[i].kind != structure.KindOptional {
+			return false
+		}
+	}
+	return false
+}
+
+// clauseFrame reports whether name is a clause of the nearest open block, skipping optional tags without an end tag
+func clauseFrame(stack []*parseFrame, name string) bool {
+	for i := len(stack) - 1; i > 0; i-- {
+		if slices.Contains(stack[i].tag.Clauses, name) {
+			return true
+		}
+		if stack[i].kind != structure.KindOptional {
+			return false
+		}
+	}
+	return false
+}
+
+// hoistOptional pops optional tags from the top of the stack, the nodes collected as their body
+// follow them in the enclosing body instead. reports whether anything was popped
+func hoistOptional(stack *[]*parseFrame) bool {
+	hoisted := false
+	for len(*stack) > 1 {
+		top := (*stack)[len(*stack)-1]
+		if top.kind != structure.KindOptional {
+			break
+		}
+		parent := (*stack)[len(*stack)-2]
+		*parent.list = append(*parent.list, top.node.Children...)
+		top.node.Children = nil
+		*stack = (*stack)[:len(*stack)-1]
+		hoisted = true
+	}
+	return hoisted
+}
+
+// seekRawEnd finds the "end-" tag of a raw tag without parsing anything in between.
+// returns the start of the end tag and the position after it, or -1 when missing.
+func seekRawEnd(engine *structure.TemplateEngine, raw, tagName string, pos int) (int, int) {
+	endName := "end-" + tagName
+	for {
+		startDelim := SeekIndex(raw, engine.DelimStart, pos)
+		if startDelim == -1 {
+			return -1, -1
+		}
+		endDelim := SeekIndex(raw, engine.DelimEnd, startDelim+len(engine.DelimStart))
+		if endDelim == -1 {
+			return -1, -1
+		}
+		endDelim += len(engine.DelimEnd)
+		if strings.Trim(raw[startDelim:endDelim], engine.CutSet) == endName {
+			return startDelim, endDelim
+		}
+		// the raw body may hold broken tags, so only skip past the start delimiter
+		pos = startDelim + len(engine.DelimStart)
+	}
+}
@@ -1,47 +1,24 @@
 package core
 
 import (
+	"errors"
 	"fmt"
-	"maps"
+	"io"
 	"strings"
 
 	"github.com/kato-studio/wispy/wispy_common/structure"
 )
 
-func ResolveFiltersIfAny(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents string) error {
-	// sb.WriteString("(" + tag_contents + ")")
-	parts := strings.Split(tag_contents, " | ")
-	lenParts := len(parts)
-	//
-	val, valErr := ResolveVariable(ctx, parts[0])
-	if valErr != nil {
-		return valErr
+// ResolveOutput evaluates an output node including any filter pipeline and writes the result to w,
+// escaped for the node's HTML context unless auto-escaping is turned off or the value is structure.SafeHTML
+func ResolveOutput(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) error {
+	value, errs := EvaluateExpression(ctx, node.Content)
+	if AutoEscapeEnabled(ctx) {
+		io.WriteString(w, EscapeValue(node.Escape, value))
+	} else {
+		io.WriteString(w, Stringify(value))
 	}
-	if lenParts == 1 {
-		if str, ok := val.(string); ok {
-			sb.WriteString(str)
-		} else {
-			sb.WriteString(Stringify(val))
-		}
-	} else if lenParts > 1 {
-		var pipeValue any = val
-		var err error
-		for i := 1; i < lenParts; i++ {
-			filterSec := parts[i]
-			filterParts := SplitRespectQuotes(filterSec)
-			filterName := filterParts[1]
-			//
-			if filter, ok := ctx.Engine.FilterMap[filterName]; ok {
-				pipeValue, err = filter.Handler(pipeValue, filterParts)
-				if err != nil {
-					return err
-				}
-			} else {
-				return fmt.Errorf("no filter found %s", filterName)
-			}
-		}
-	}
-	return nil
+	return errors.Join(errs...)
 }
 
 func FindDelim(ctx *structure.RenderCtx, raw string, pos int) (int, int) {
@@ -57,35 +34,55 @@ func FindDelim(ctx *structure.RenderCtx, raw string, pos int) (int, int) {
 	return next, endDelim
 }
 
-func ResolveTag(ctx *structure.RenderCtx, sb *strings.Builder, pos int, tag_contents, raw string) (new_pos int, errs []error) {
-	tagName, contents, tagNameExists := strings.Cut(tag_contents, " ")
-	if !tagNameExists && len(tagName) < 1 {
-		return pos, []error{fmt.Errorf("could not resolve tag name in \"" + tag_contents + "\"")}
-	}
-
+func ResolveTag(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
 	// check if tag has been registered to the template engine.
-	templateTag, tagExists := ctx.Engine.TagMap[tagName]
+	templateTag, tagExists := ctx.Engine.TagMap[node.Name]
 	if !tagExists {
-		return pos, []error{fmt.Errorf("\"" + tagName + "\" not found in Engine.TagMap \"" + tag_contents + "\"")}
+		err := Undefined(ctx, fmt.Errorf("%w %q in %q", structure.ErrUnknownTag, node.Name, strings.TrimSpace(node.Name+" "+node.Content)))
+		if err == nil {
+			return nil
+		}
+		return []error{err}
 	}
 
-	return templateTag.Render(ctx, sb, contents, raw, pos)
+	return templateTag.Render(ctx, w, node)
 }
 
 // resolveVariable resolves a variable reference from the RenderCtx's Props or Data maps.
 func ResolveVariable(ctx *structure.RenderCtx, path string) (any, error) {
-	parts := strings.Split(path, ".")
-	var current any = maps.Clone(ctx.Props)
+	parts := strings.Split(strings.TrimPrefix(path, "."), ".")
 	// try to resolve the variable from Props.
-	current = ParseDataPath(parts, current)
-	// If the variable was not found in Props, try to resolve it from Data.
+	current := ParseDataPath(parts, ctx.Props)
+	// If the variable was not found in Props, try to resolve it from Data and the enclosing scopes.
 	if current == nil {
-		current = ctx.Data
-		current = ParseDataPath(parts, current)
+		if value, ok := ctx.Lookup(parts[0]); ok {
+			current = ParseDataPath(parts[1:], value)
+		}
 	}
 	// If it's still we know there was no data either so we return an error
 	if current == nil {
-		return "", fmt.Errorf("invalid variable path: %s", path)
+		return "", fmt.Errorf("%w %q", structure.ErrUndefinedVariable, path)
 	}
 	return current, nil
 }
+
+// UndefinedMode returns the site's handling of undefined variables, unknown filters and unknown tags,
+// falling back to the engine's
+func UndefinedMode(ctx *structure.RenderCtx) structure.UndefinedMode {
+	if ctx.Site != nil && ctx.Site.Config.Undefined != nil {
+		return *ctx.Site.Config.Undefined
+	}
+	return ctx.Engine.Undefined
+}
+
+// Undefined applies the undefined mode to an undefined error,
+// silent mode drops it and strict mode halts the render so the route is answered with an error
+func Undefined(ctx *structure.RenderCtx, err error) error {
+	switch UndefinedMode(ctx) {
+	case structure.UndefinedSilent:
+		return nil
+	case structure.UndefinedStrict:
+		ctx.Halted = true
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package core_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kato-studio/wispy/template/core"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+func TestUndefinedModes(t *testing.T) {
+	tests := []struct {
+		name string
+		mode structure.UndefinedMode
+		src  string
+		want string
+		// error wrapped by the reported error, nil when nothing is reported
+		err    error
+		halted bool
+	}{
+		{"lenient variable", structure.UndefinedLenient, `a{% .missing %}b`, "ab", structure.ErrUndefinedVariable, false},
+		{"lenient filter", structure.UndefinedLenient, `a{% .name | nope %}b`, "ab", structure.ErrUnknownFilter, false},
+		{"lenient tag", structure.UndefinedLenient, `a{% nope %}b`, "ab", structure.ErrUnknownTag, false},
+		{"strict variable", structure.UndefinedStrict, `a{% .missing %}b`, "a", structure.ErrUndefinedVariable, true},
+		{"strict filter", structure.UndefinedStrict, `a{% .name | nope %}b`, "a", structure.ErrUnknownFilter, true},
+		{"strict tag", structure.UndefinedStrict, `a{% nope %}b`, "a", structure.ErrUnknownTag, true},
+		{"strict in loop", structure.UndefinedStrict, `{% each i in range 1..3 %}{% .i %}{% .missing %}{% end-each %}`, "1", structure.ErrUndefinedVariable, true},
+		{"silent variable", structure.UndefinedSilent, `a{% .missing %}b`, "ab", nil, false},
+		{"silent filter passes the value", structure.UndefinedSilent, `a{% .name | nope %}b`, "aAnnb", nil, false},
+		{"silent tag", structure.UndefinedSilent, `a{% nope %}b`, "ab", nil, false},
+		{"default filter allows undefined", structure.UndefinedStrict, `{% .missing | default "x" %}`, "x", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newCtx(testData())
+			ctx.Engine.Undefined = tt.mode
+			var out strings.Builder
+			errs := core.Render(ctx, &out, tt.src)
+			if tt.err == nil && len(errs) > 0 {
+				t.Errorf("Render(%q) errors = %v, want none", tt.src, errs)
+			}
+			if tt.err != nil && (len(errs) != 1 || !errors.Is(errs[0], tt.err)) {
+				t.Errorf("Render(%q) errors = %v, want %v", tt.src, errs, tt.err)
+			}
+			if out.String() != tt.want || ctx.Halted != tt.halted {
+				t.Errorf("Render(%q) = %q, halted %v, want %q, halted %v", tt.src, out.String(), ctx.Halted, tt.want, tt.halted)
+			}
+		})
+	}
+}
+
+// The mode of the site's config.toml wins over the engine's
+func TestUndefinedModeSiteOverride(t *testing.T) {
+	ctx := newCtx(testData())
+	ctx.Engine.Undefined = structure.UndefinedStrict
+	if got := core.UndefinedMode(ctx); got != structure.UndefinedStrict {
+		t.Errorf("UndefinedMode() = %v, want the engine's strict", got)
+	}
+	silent := structure.UndefinedSilent
+	ctx.Site.Config.Undefined = &silent
+	if got := core.UndefinedMode(ctx); got != structure.UndefinedSilent {
+		t.Errorf("UndefinedMode() = %v, want the site's silent", got)
+	}
+}
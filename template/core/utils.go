@@ -1,8 +1,8 @@
 package core
 
 import (
+	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 
 	common "github.com/kato-studio/wispy/wispy_common"
@@ -59,40 +59,17 @@ func SeekClosingHandleNested(raw, closingTag, openingTag string, pos int) (newPo
 	}
 }
 
+// ResolveValue evaluates an expression such as a literal, a variable path or a full expression
 func ResolveValue(ctx *structure.RenderCtx, expr string) (any, error) {
 	expr = strings.TrimSpace(expr)
 	if expr == "" {
 		return nil, fmt.Errorf("empty expression")
 	}
-
-	if strings.HasPrefix(expr, ".") {
-		// Resolve the value to be assigned from ctx Variable
-		return ResolveVariable(ctx, expr)
-	}
-
-	// Check if it's a boolean
-	if expr == "true" || strings.ToLower(expr) == "true" {
-		return true, nil
-	}
-	if expr == "false" || strings.ToLower(expr) == "false" {
-		return false, nil
-	}
-
-	// Check if it's a string literal
-	if (strings.HasPrefix(expr, `"`) && strings.HasSuffix(expr, `"`)) ||
-		(strings.HasPrefix(expr, `'`) && strings.HasSuffix(expr, `'`)) {
-		return expr[1 : len(expr)-1], nil
-	}
-
-	// Check if it's a numeric value
-	if num, err := strconv.Atoi(expr); err == nil {
-		return num, nil
+	value, errs := EvaluateExpression(ctx, expr)
+	if len(errs) > 0 {
+		return value, errors.Join(errs...)
 	}
-	if num, err := strconv.ParseFloat(expr, 64); err == nil {
-		return num, nil
-	}
-
-	return nil, fmt.Errorf("could not resolve expression " + expr)
+	return value, nil
 }
 
 // ---
@@ -0,0 +1,289 @@
+package template
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Cookie holding the locale a visitor picked, it wins over Accept-Language
+	LocaleCookieName = "wispy_locale"
+	// Folder of a site whose files are exposed to templates as .Site.Data
+	DataDir = "data"
+)
+
+// Extensions of data files, tried in order when several exist
+var dataFileExts = []string{".json", ".yaml", ".yml", ".toml"}
+
+// RequestLocale picks the locale of a request among the site's default_locale and locales: a "/<locale>/" prefix
+// of the path, then the wispy_locale cookie, then Accept-Language, then default_locale.
+// Returns the path without the locale prefix for matching the route
+func RequestLocale(site *structure.SiteStructure, r *http.Request, requestPath string) (locale, routePath string) {
+	trimmed := strings.TrimPrefix(requestPath, "/")
+	first, rest, _ := strings.Cut(trimmed, "/")
+	if locale, ok := siteLocale(site, first, false); ok {
+		return locale, "/" + rest
+	}
+	if r != nil {
+		if cookie, err := r.Cookie(LocaleCookieName); err == nil {
+			if locale, ok := siteLocale(site, cookie.Value, false); ok {
+				return locale, requestPath
+			}
+		}
+		for _, tag := range acceptedLanguages(r.Header.Get("Accept-Language")) {
+			if locale, ok := siteLocale(site, tag, true); ok {
+				return locale, requestPath
+			}
+		}
+	}
+	return site.Config.DefaultLocale, requestPath
+}
+
+// siteLocale returns the locale of the site matching a tag, case and "-" or "_" aside.
+// With byLanguage "pt-BR" also matches "pt" and the other way around
+func siteLocale(site *structure.SiteStructure, tag string, byLanguage bool) (string, bool) {
+	if tag == "" {
+		return "", false
+	}
+	normalize := func(locale string) string { return strings.ToLower(strings.ReplaceAll(locale, "_", "-")) }
+	language := func(locale string) string { before, _, _ := strings.Cut(normalize(locale), "-"); return before }
+	locales := append([]string{site.Config.DefaultLocale}, site.Config.Locales...)
+	for _, locale := range locales {
+		if normalize(locale) == normalize(tag) {
+			return locale, true
+		}
+	}
+	if byLanguage {
+		for _, locale := range locales {
+			if language(locale) == language(tag) {
+				return locale, true
+			}
+		}
+	}
+	return "", false
+}
+
+// acceptedLanguages returns the tags of an Accept-Language header by preference
+func acceptedLanguages(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	slices.SortStableFunc(tags, func(a, b weighted) int { return cmp.Compare(b.q, a.q) })
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.tag
+	}
+	return names
+}
+
+// MergeData merges src into dst, nested maps are merged key by key and any other value of src replaces the one of dst.
+// Only dst is modified, nested maps are copied before they are merged into
+func MergeData(dst, src map[string]any) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]any)
+		dstMap, dstIsMap := dst[key].(map[string]any)
+		if srcIsMap && dstIsMap {
+			merged := make(map[string]any, len(dstMap)+len(srcMap))
+			MergeData(merged, dstMap)
+			MergeData(merged, srcMap)
+			dst[key] = merged
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// ReadDataFile decodes a JSON, YAML or TOML file by its extension, its top level must be an object
+func ReadDataFile(path string) (map[string]any, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]any{}
+	switch filepath.Ext(path) {
+	case ".json":
+		err = json.Unmarshal(source, &data)
+	case ".yaml", ".yml":
+		data, err = decodeYAML(source)
+	case ".toml":
+		_, err = toml.Decode(string(source), &data)
+	default:
+		err = fmt.Errorf("unknown data file type %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return data, nil
+}
+
+// decodeYAML decodes a YAML document whose top level is a mapping, an empty document decodes to an empty map.
+// Mappings with keys other than strings, such as "2024: ...", get their keys formatted as strings
+func decodeYAML(source []byte) (map[string]any, error) {
+	var data map[string]any
+	if err := yaml.Unmarshal(source, &data); err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return map[string]any{}, nil
+	}
+	return stringKeys(data).(map[string]any), nil
+}
+
+// stringKeys converts the map[any]any mappings of a decoded YAML value to map[string]any
+func stringKeys(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, item := range value {
+			value[key] = stringKeys(item)
+		}
+		return value
+	case map[any]any:
+		converted := make(map[string]any, len(value))
+		for key, item := range value {
+			converted[fmt.Sprint(key)] = stringKeys(item)
+		}
+		return converted
+	case []any:
+		for i, item := range value {
+			value[i] = stringKeys(item)
+		}
+		return value
+	}
+	return value
+}
+
+// findDataFile returns the first data file named name in dir with one of the data file extensions
+func findDataFile(dir, name string) (string, bool) {
+	for _, ext := range dataFileExts {
+		path := filepath.Join(dir, name+ext)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// pageData reads the data files next to a page, "data_<locale>" over "data_<default_locale>" so keys
+// a translation leaves out come from the default locale. Missing files are skipped
+func pageData(site *structure.SiteStructure, dir, locale string) (map[string]any, error) {
+	data := map[string]any{}
+	names := []string{"data_" + site.Config.DefaultLocale}
+	if locale != site.Config.DefaultLocale {
+		names = append(names, "data_"+locale)
+	}
+	for _, name := range names {
+		path, ok := findDataFile(dir, name)
+		if !ok {
+			continue
+		}
+		fileData, err := ReadDataFile(path)
+		if err != nil {
+			return nil, err
+		}
+		MergeData(data, fileData)
+	}
+	return data, nil
+}
+
+// LoadSiteData reads the data/ folder of a site, "data/authors/ann.yaml" becomes .Site.Data.authors.ann.
+// "nav_fr.yaml" is the "fr" version of "nav.yaml" when fr is a locale of the site, merged over it and over the version of
+// the default locale
+func LoadSiteData(siteFolderPath string, config structure.SiteConfig) (data map[string]map[string]any, errs []error) {
+	neutral := map[string]any{}
+	localized := map[string]map[string]any{}
+	dataPath := filepath.Join(siteFolderPath, DataDir)
+	locales := append([]string{config.DefaultLocale}, config.Locales...)
+
+	err := filepath.WalkDir(dataPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dataPath {
+				return filepath.SkipAll
+			}
+			errs = append(errs, err)
+			return nil
+		}
+		if d.IsDir() || !slices.Contains(dataFileExts, filepath.Ext(path)) {
+			return nil
+		}
+		fileData, err := ReadDataFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		rel, _ := filepath.Rel(dataPath, path)
+		keys := strings.Split(strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel)), "/")
+		target := neutral
+		last := len(keys) - 1
+		for _, locale := range locales {
+			if name, ok := strings.CutSuffix(keys[last], "_"+locale); ok && name != "" {
+				keys[last] = name
+				if localized[locale] == nil {
+					localized[locale] = map[string]any{}
+				}
+				target = localized[locale]
+				break
+			}
+		}
+		// the file becomes a nested map at the path of its folders and name
+		var nested any = fileData
+		for i := last; i >= 0; i-- {
+			nested = map[string]any{keys[i]: nested}
+		}
+		MergeData(target, nested.(map[string]any))
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// files of the default locale fill in what other locales leave out
+	data = make(map[string]map[string]any, len(locales)+1)
+	for _, locale := range append(locales, "") {
+		merged := map[string]any{}
+		MergeData(merged, neutral)
+		MergeData(merged, localized[config.DefaultLocale])
+		MergeData(merged, localized[locale])
+		data[locale] = merged
+	}
+	return data, errs
+}
+
+// localeSiteData returns the data/ files of a site for a locale
+func localeSiteData(site *structure.SiteStructure, locale string) map[string]any {
+	if data, ok := site.Data[locale]; ok {
+		return data
+	}
+	if data, ok := site.Data[""]; ok {
+		return data
+	}
+	return map[string]any{}
+}
@@ -0,0 +1,228 @@
+package template
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+func localeTestSite() *structure.SiteStructure {
+	return &structure.SiteStructure{
+		Domain: "example.com",
+		Config: structure.SiteConfig{DefaultLocale: "en", Locales: []string{"fr", "pt-BR"}},
+	}
+}
+
+func TestRequestLocale(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		cookie         string
+		acceptLanguage string
+		locale         string
+		routePath      string
+	}{
+		{name: "default", path: "/about", locale: "en", routePath: "/about"},
+		{name: "prefix", path: "/fr/about", locale: "fr", routePath: "/about"},
+		{name: "prefix of the home page", path: "/fr", locale: "fr", routePath: "/"},
+		{name: "prefix ignores case", path: "/pt-br/about", locale: "pt-BR", routePath: "/about"},
+		{name: "prefix wins over the cookie", path: "/fr/about", cookie: "pt-BR", locale: "fr", routePath: "/about"},
+		{name: "unknown prefix is part of the route", path: "/de/about", locale: "en", routePath: "/de/about"},
+		{name: "cookie", path: "/about", cookie: "fr", acceptLanguage: "pt-BR", locale: "fr", routePath: "/about"},
+		{name: "cookie of an unknown locale", path: "/about", cookie: "de", acceptLanguage: "fr", locale: "fr", routePath: "/about"},
+		{name: "accept language", path: "/about", acceptLanguage: "fr-CA, en;q=0.5", locale: "fr", routePath: "/about"},
+		{name: "accept language by q", path: "/about", acceptLanguage: "en;q=0.3, pt-BR;q=0.8, fr;q=0.5", locale: "pt-BR", routePath: "/about"},
+		{name: "accept language by language", path: "/about", acceptLanguage: "pt-PT", locale: "pt-BR", routePath: "/about"},
+		{name: "accept language skips q=0 and unknown", path: "/about", acceptLanguage: "fr;q=0, de, *", locale: "en", routePath: "/about"},
+	}
+	site := localeTestSite()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://example.com"+tt.path, nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: LocaleCookieName, Value: tt.cookie})
+			}
+			if tt.acceptLanguage != "" {
+				r.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			locale, routePath := RequestLocale(site, r, tt.path)
+			if locale != tt.locale || routePath != tt.routePath {
+				t.Errorf("RequestLocale(%q) = %q, %q, want %q, %q", tt.path, locale, routePath, tt.locale, tt.routePath)
+			}
+		})
+	}
+}
+
+func TestAcceptedLanguages(t *testing.T) {
+	got := acceptedLanguages("da, en-GB;q=0.8, en;q=0.7, fr;q=0.8, *;q=0.1, de;q=0")
+	if want := []string{"da", "en-GB", "fr", "en"}; !slices.Equal(got, want) {
+		t.Errorf("acceptedLanguages = %v, want %v", got, want)
+	}
+}
+
+func TestMergeData(t *testing.T) {
+	nested := map[string]any{"title": "Home", "links": []any{"a"}}
+	dst := map[string]any{"nav": nested, "name": "site", "menu": "flat"}
+	src := map[string]any{"nav": map[string]any{"title": "Accueil"}, "menu": map[string]any{"home": "/"}, "new": 1}
+	MergeData(dst, src)
+
+	want := map[string]any{
+		"nav":  map[string]any{"title": "Accueil", "links": []any{"a"}},
+		"name": "site",
+		"menu": map[string]any{"home": "/"},
+		"new":  1,
+	}
+	if !reflect.DeepEqual(dst, want) {
+		t.Errorf("MergeData = %#v, want %#v", dst, want)
+	}
+	// nested maps of dst are copied, not merged into
+	if nested["title"] != "Home" {
+		t.Errorf("nested map of dst was modified: %v", nested)
+	}
+}
+
+func TestLoadSiteData(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"data/nav.yaml":           "home: Home\nabout: About\ncontact: Contact\n",
+		"data/nav_en.yaml":        "about: About us\n",
+		"data/nav_fr.yaml":        "home: Accueil\n",
+		"data/authors/ann.toml":   "name = \"Ann\"\n",
+		"data/broken.json":        "{",
+		"data/notes.txt":          "not data",
+		"data/nav_de.yaml":        "home: Startseite\n",
+		"data/authors/_fr.yaml":   "name: Anne\n",
+		"data/authors/bob.json":   `{"name": "Bob"}`,
+		"data/authors/bob_fr.yml": "name: Robert\n",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, errs := LoadSiteData(dir, structure.SiteConfig{DefaultLocale: "en", Locales: []string{"fr"}})
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "broken.json") {
+		t.Errorf("LoadSiteData errors = %v, want the error of broken.json", errs)
+	}
+
+	// neutral files < the default locale < the requested locale
+	tests := []struct {
+		locale string
+		key    string
+		want   any
+	}{
+		{"en", "nav.home", "Home"},
+		{"en", "nav.about", "About us"},
+		{"fr", "nav.home", "Accueil"},
+		{"fr", "nav.about", "About us"},
+		{"fr", "nav.contact", "Contact"},
+		{"", "nav.about", "About us"},
+		{"en", "authors.ann.name", "Ann"},
+		{"fr", "authors.bob.name", "Robert"},
+		{"en", "authors.bob.name", "Bob"},
+		// files of locales the site doesn't have are neutral data of their own name
+		{"fr", "nav_de.home", "Startseite"},
+		{"fr", "authors._fr.name", "Anne"},
+	}
+	for _, tt := range tests {
+		var value any = data[tt.locale]
+		for _, key := range strings.Split(tt.key, ".") {
+			value = value.(map[string]any)[key]
+		}
+		if value != tt.want {
+			t.Errorf("data[%q].%s = %v, want %v", tt.locale, tt.key, value, tt.want)
+		}
+	}
+}
+
+func TestPageDataByLocale(t *testing.T) {
+	engine := buildTestSite(t, "example.com", map[string]string{
+		"config.toml":            "domain = \"example.com\"\ndefault_locale = \"en\"\nlocales = [\"fr\"]\n",
+		"layouts/root.hstm":      `{% passed %}`,
+		"data/nav.yaml":          "home: Home\n",
+		"data/nav_fr.yaml":       "home: Accueil\n",
+		"pages/page.hstm":        `{% .Locale %}|{% .title %}|{% .footer.note %}|{% .footer.year %}|{% .Site.Data.nav.home %}`,
+		"pages/data_en.yaml":     "title: Welcome\nfooter:\n  note: Thanks\n  year: 2024\n",
+		"pages/data_fr.yaml":     "title: Bienvenue\nfooter:\n  note: Merci\n",
+		"pages/bad/page.hstm":    `bad`,
+		"pages/bad/data_fr.json": `{"title": `,
+	})
+
+	for path, want := range map[string]string{
+		"/":    "en|Welcome|Thanks|2024|Home",
+		"/fr":  "fr|Bienvenue|Merci|2024|Accueil",
+		"/fr/": "fr|Bienvenue|Merci|2024|Accueil",
+	} {
+		var out strings.Builder
+		if _, err := renderTestRoute(t, engine, "example.com", path, &out); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if out.String() != want {
+			t.Errorf("%s = %q, want %q", path, out.String(), want)
+		}
+	}
+
+	// a data file that fails to decode fails the page of its locale only
+	var out strings.Builder
+	if _, err := renderTestRoute(t, engine, "example.com", "/bad", &out); err != nil {
+		t.Errorf("/bad: %v", err)
+	}
+	if _, err := renderTestRoute(t, engine, "example.com", "/fr/bad", &out); err == nil || !strings.Contains(err.Error(), "data_fr.json") {
+		t.Errorf("/fr/bad error = %v, want the error of data_fr.json", err)
+	}
+}
+
+func TestLintPageData(t *testing.T) {
+	engine := buildTestSite(t, "example.com", map[string]string{
+		"config.toml":              "domain = \"example.com\"\ndefault_locale = \"en\"\nlocales = [\"fr\"]\n",
+		"layouts/root.hstm":        `{% passed %}`,
+		"pages/page.hstm":          `{% .title %}`,
+		"pages/data_en.yaml":       "title: Welcome\n",
+		"pages/data_fr.yaml":       "title: [Bienvenue\n",
+		"pages/about/page.hstm":    `{% .title %}`,
+		"pages/about/data_de.yaml": "title: Willkommen\n",
+		"pages/about/data_fr.txt":  "not data",
+	})
+	var messages []string
+	for _, err := range Lint(engine) {
+		messages = append(messages, err.Error())
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Lint = %q, want 2 errors", messages)
+	}
+	if !strings.Contains(messages[0]+messages[1], "page data: ") || !strings.Contains(messages[0]+messages[1], "data_fr.yaml") {
+		t.Errorf("Lint = %q, want the decode error of data_fr.yaml", messages)
+	}
+	if !strings.Contains(messages[0]+messages[1], `"de" is not a locale of the site`) {
+		t.Errorf("Lint = %q, want the unknown locale of data_de.yaml", messages)
+	}
+}
+
+// .Site is shared by every request of the site, assignments of a render only change its own copy
+func TestAssignLeavesSiteDataUnchanged(t *testing.T) {
+	engine := buildTestSite(t, "example.com", map[string]string{
+		"config.toml":       "domain = \"example.com\"\n[site.menu]\ntitle = \"Menu\"\n",
+		"layouts/root.hstm": `{% passed %}`,
+		"data/nav.yaml":     "home: Home\n",
+		"pages/page.hstm":   `{% .Site.Data.nav.home %}|{% .Site.menu.title %}{% assign .Site.Data.nav.home = "changed" %}{% assign .Site.menu.title = "changed" %}`,
+	})
+	for range 2 {
+		var out strings.Builder
+		if _, err := renderTestRoute(t, engine, "example.com", "/", &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != "Home|Menu" {
+			t.Errorf("/ = %q, want the values of the site", out.String())
+		}
+	}
+}
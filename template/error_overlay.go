@@ -0,0 +1,69 @@
+package template
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+const errorOverlayStyle = `#wispy-error-overlay{position:fixed;inset:0;z-index:2147483647;overflow:auto;background:rgba(20,20,24,.94);color:#e8e8e8;font:14px/1.5 ui-monospace,SFMono-Regular,Menlo,Consolas,monospace;padding:32px}` +
+	`#wispy-error-overlay h1{color:#ff6b6b;font-size:18px;margin:0 0 16px}` +
+	`#wispy-error-overlay section{background:#1f1f25;border-left:4px solid #ff6b6b;border-radius:4px;margin:0 0 16px;padding:12px 16px}` +
+	`#wispy-error-overlay .where{color:#8ab4ff}#wispy-error-overlay .tag{color:#ffd479}` +
+	`#wispy-error-overlay pre{background:#141418;margin:8px 0;padding:8px 12px;overflow:auto}` +
+	`#wispy-error-overlay ul{margin:4px 0 0;padding-left:20px;color:#a0a0a8}` +
+	`#wispy-error-overlay button{position:absolute;top:16px;right:24px;background:none;border:1px solid #555;color:#e8e8e8;cursor:pointer;padding:4px 10px}`
+
+// ErrorOverlay renders template errors as an HTML overlay shown on top of the page while developing
+func ErrorOverlay(errs []error) string {
+	var sb strings.Builder
+	sb.WriteString(`<div id="wispy-error-overlay"><style>` + errorOverlayStyle + `</style>`)
+	sb.WriteString(`<button onclick="this.parentNode.remove()">close</button>`)
+	fmt.Fprintf(&sb, "<h1>%d template error", len(errs))
+	if len(errs) != 1 {
+		sb.WriteString("s")
+	}
+	sb.WriteString("</h1>")
+
+	for _, err := range errs {
+		sb.WriteString("<section>")
+		te, ok := err.(*structure.TemplateError)
+		if !ok {
+			sb.WriteString("<div>" + html.EscapeString(err.Error()) + "</div></section>")
+			continue
+		}
+		sb.WriteString(`<div><span class="where">` + html.EscapeString(te.Where()) + "</span>")
+		if te.Tag != "" {
+			sb.WriteString(` <span class="tag">{% ` + html.EscapeString(te.Tag) + ` %}</span>`)
+		}
+		sb.WriteString("</div>")
+		if te.Err != nil {
+			sb.WriteString("<div>" + html.EscapeString(te.Err.Error()) + "</div>")
+		}
+		if te.Snippet != "" {
+			sb.WriteString("<pre>" + html.EscapeString(te.Snippet) + "</pre>")
+		}
+		if len(te.Chain) > 0 {
+			sb.WriteString("<ul>")
+			for _, frame := range te.Chain {
+				fmt.Fprintf(&sb, "<li>included by {%% %s %%} at %s:%d:%d</li>",
+					html.EscapeString(frame.Tag), html.EscapeString(frame.Path), frame.Line, frame.Column)
+			}
+			sb.WriteString("</ul>")
+		}
+		sb.WriteString("</section>")
+	}
+	sb.WriteString("</div>")
+	return sb.String()
+}
+
+// InjectErrorOverlay adds the error overlay before the closing body tag, or at the end when there is none
+func InjectErrorOverlay(page string, errs []error) string {
+	overlay := ErrorOverlay(errs)
+	if i := strings.LastIndex(strings.ToLower(page), "</body>"); i != -1 {
+		return page[:i] + overlay + page[i:]
+	}
+	return page + overlay
+}
@@ -0,0 +1,162 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// ExportSite renders every route of a site to outDir/<route>/index.html and copies its public folder next to them,
+// so the site can be hosted as plain files, entries of content collections and "/<locale>/" versions of the routes included. Pages keep their CSS and JS bundle inlined by root-css and root-js.
+// Routes render with a synthetic GET request and no session, routes listed in the site's [export] skip are left out.
+// Routes that fail or redirect are reported and the remaining routes are still exported,
+// template errors are handled like when serving the page (see TemplateEngine.Undefined) and reported with the route.
+// Exported and skipped routes are logged at debug level
+func ExportSite(engine *structure.TemplateEngine, domain, outDir string) (errs []error) {
+	site, exists := engine.Sites.Get(domain)
+	if !exists {
+		return append(errs, fmt.Errorf("domain %s not found", domain))
+	}
+	scopedDirectory := filepath.Join(engine.SITES_DIR, site.Domain)
+
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return append(errs, fmt.Errorf("failed to create export directory %s: %w", outDir, err))
+	}
+
+	for _, routeKey := range slices.Sorted(maps.Keys(site.Routes)) {
+		requestPath := strings.TrimPrefix(routeKey, site.Domain)
+		// dynamic routes have no known values to render them with
+		if site.Routes[routeKey].Pattern != nil {
+			slog.Debug("Skipped dynamic route", "path", requestPath)
+			continue
+		}
+		if RouteMatches(site.Config.Export.Skip, requestPath) {
+			slog.Debug("Skipped route", "path", requestPath)
+			continue
+		}
+		for _, localizedPath := range localizedPaths(site, requestPath) {
+			if err := exportRoute(engine, site, scopedDirectory, localizedPath, outDir); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			slog.Debug("Exported route", "path", localizedPath)
+		}
+	}
+	// Entries of content collections, drafts and entries dated later are left out in production
+	for _, name := range slices.Sorted(maps.Keys(site.Collections)) {
+		for _, entry := range site.Collections[name].Entries {
+			if entry.URL == "" || !contentVisible(entry, time.Now()) || RouteMatches(site.Config.Export.Skip, entry.URL) {
+				continue
+			}
+			for _, localizedPath := range localizedPaths(site, entry.URL) {
+				if err := exportRoute(engine, site, scopedDirectory, localizedPath, outDir); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				slog.Debug("Exported route", "path", localizedPath)
+			}
+		}
+	}
+
+	// Public files are served from the site root, essential files (favicon, manifest, ...) from "/"
+	publicDir := filepath.Join(scopedDirectory, site.Config.Assets.PublicDir)
+	if err := copyDir(publicDir, outDir); err != nil {
+		errs = append(errs, fmt.Errorf("failed to copy %s: %w", publicDir, err))
+	}
+	if err := copyDir(filepath.Join(publicDir, "essential"), outDir); err != nil {
+		errs = append(errs, fmt.Errorf("failed to copy essential files: %w", err))
+	}
+	return errs
+}
+
+// localizedPaths returns a route path and its "/<locale>/" versions for the other locales of the site
+func localizedPaths(site *structure.SiteStructure, requestPath string) []string {
+	paths := []string{requestPath}
+	for _, locale := range site.Config.Locales {
+		if locale != site.Config.DefaultLocale {
+			paths = append(paths, "/"+locale+requestPath)
+		}
+	}
+	return paths
+}
+
+// exportRoute renders a single route with a synthetic request and writes it to outDir/<route>/index.html
+func exportRoute(engine *structure.TemplateEngine, site *structure.SiteStructure, scopedDirectory, requestPath, outDir string) error {
+	req := httptest.NewRequest(http.MethodGet, "http://"+site.Domain+requestPath, nil)
+	rec := httptest.NewRecorder()
+
+	data := map[string]any{}
+	ctx := engine.InitCtx(scopedDirectory, site, data)
+	var page bytes.Buffer
+	err := RenderRoute(engine, ctx, &page, requestPath, data, rec, req)
+	if err != nil {
+		return fmt.Errorf("route %s: %w", requestPath, err)
+	}
+	if ctx.Halted || rec.Code >= 300 {
+		return fmt.Errorf("route %s: render ended early with status %d, add it to [export] skip if it needs a request", requestPath, rec.Code)
+	}
+
+	target := filepath.Join(outDir, filepath.FromSlash(requestPath), "index.html")
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return fmt.Errorf("route %s: %w", requestPath, err)
+	}
+	if err := os.WriteFile(target, page.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("route %s: %w", requestPath, err)
+	}
+	// lenient and silent modes still write the page, its errors are returned so they can be fixed
+	if len(ctx.Errors) > 0 {
+		return fmt.Errorf("route %s: exported with %d template error(s):\n%w", requestPath, len(ctx.Errors), errors.Join(ctx.Errors...))
+	}
+	return nil
+}
+
+// copyDir copies the files of src into dst, a missing src is not an error
+func copyDir(src, dst string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.WalkDir(src, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, filePath)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, os.ModePerm)
+		}
+		return copyFile(filePath, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
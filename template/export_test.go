@@ -0,0 +1,69 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// buildTestSite writes files into a site folder and builds it with the default engine
+func buildTestSite(t *testing.T, domain string, files map[string]string) *structure.TemplateEngine {
+	t.Helper()
+	sitesDir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(sitesDir, domain, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine := StartDefaultEngine()
+	engine.SITES_DIR = sitesDir
+	BuildSiteMap(engine)
+	return engine
+}
+
+func TestExportSite(t *testing.T) {
+	engine := buildTestSite(t, "example.com", map[string]string{
+		"config.toml":                 "domain = \"example.com\"\n[export]\nskip = [\"/private\"]\n",
+		"layouts/root.hstm":           `<html><head>{% root-head %}</head><body>{% passed %}</body></html>`,
+		"pages/page.hstm":             `home`,
+		"pages/about/page.hstm":       `about`,
+		"pages/broken/page.hstm":      `before{% .missing %}after`,
+		"pages/private/page.hstm":     `private`,
+		"pages/blog/[slug]/page.hstm": `{% .URL.Params.slug %}`,
+		"public/robots.txt":           "User-agent: *",
+	})
+	outDir := t.TempDir()
+	errs := ExportSite(engine, "example.com", outDir)
+
+	// the page with a template error is written and reported
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "route /broken: exported with 1 template error(s)") {
+		t.Fatalf("ExportSite errors = %v, want one template error of /broken", errs)
+	}
+	for path, want := range map[string]string{
+		"index.html":        "home",
+		"about/index.html":  "about",
+		"broken/index.html": "beforeafter",
+		"robots.txt":        "User-agent: *",
+	} {
+		got, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(path)))
+		if err != nil {
+			t.Errorf("%s was not exported: %v", path, err)
+			continue
+		}
+		if !strings.Contains(string(got), want) {
+			t.Errorf("%s = %q, want it to contain %q", path, got, want)
+		}
+	}
+	for _, path := range []string{"private/index.html", "blog"} {
+		if _, err := os.Stat(filepath.Join(outDir, path)); err == nil {
+			t.Errorf("%s was exported, want it skipped", path)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package filters
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kato-studio/wispy/template/core"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// List filters work on any slice, JSON data arrives as []any and is returned as []any
+
+var JoinFilter = TemplateFilter{
+	Name: "join",
+	Args: []structure.FilterArg{{Name: "separator", Type: structure.ArgString, Optional: true, Default: " "}},
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		list, ok := core.ToList(pipedValue)
+		if !ok {
+			return pipedValue, nil
+		}
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = core.Stringify(item)
+		}
+		return strings.Join(parts, args[0].(string)), nil
+	},
+}
+
+var SplitFilter = TemplateFilter{
+	Name: "split",
+	Args: []structure.FilterArg{{Name: "separator", Type: structure.ArgString}},
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		if pipedValue == nil {
+			return []any{}, nil
+		}
+		parts := strings.Split(core.Stringify(pipedValue), args[0].(string))
+		list := make([]any, len(parts))
+		for i, part := range parts {
+			list[i] = part
+		}
+		return list, nil
+	},
+}
+
+var FirstFilter = TemplateFilter{
+	Name: "first",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		if s, ok := pipedValue.(string); ok {
+			r, size := utf8.DecodeRuneInString(s)
+			if size == 0 {
+				return "", nil
+			}
+			return string(r), nil
+		}
+		if list, ok := core.ToList(pipedValue); ok && len(list) > 0 {
+			return list[0], nil
+		}
+		return nil, nil
+	},
+}
+
+var LastFilter = TemplateFilter{
+	Name: "last",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		if s, ok := pipedValue.(string); ok {
+			r, size := utf8.DecodeLastRuneInString(s)
+			if size == 0 {
+				return "", nil
+			}
+			return string(r), nil
+		}
+		if list, ok := core.ToList(pipedValue); ok && len(list) > 0 {
+			return list[len(list)-1], nil
+		}
+		return nil, nil
+	},
+}
+
+var SortFilter = TemplateFilter{
+	Name: "sort",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		list, ok := core.ToList(pipedValue)
+		if !ok {
+			return nil, fmt.Errorf("cannot sort %T", pipedValue)
+		}
+		sorted := slices.Clone(list)
+		slices.SortStableFunc(sorted, core.Compare)
+		return sorted, nil
+	},
+}
+
+var SortByFilter = TemplateFilter{
+	Name: "sort_by",
+	Args: []structure.FilterArg{
+		{Name: "key", Type: structure.ArgString},
+		{Name: "descending", Type: structure.ArgBool, Optional: true, Default: false},
+	},
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		list, ok := core.ToList(pipedValue)
+		if !ok {
+			return nil, fmt.Errorf("cannot sort %T", pipedValue)
+		}
+		key, descending := args[0].(string), args[1].(bool)
+		sorted := slices.Clone(list)
+		slices.SortStableFunc(sorted, func(a, b any) int {
+			order := core.Compare(field(a, key), field(b, key))
+			if descending {
+				return -order
+			}
+			return order
+		})
+		return sorted, nil
+	},
+}
+
+var ReverseFilter = TemplateFilter{
+	Name: "reverse",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		if s, ok := pipedValue.(string); ok {
+			runes := []rune(s)
+			slices.Reverse(runes)
+			return string(runes), nil
+		}
+		list, ok := core.ToList(pipedValue)
+		if !ok {
+			return pipedValue, nil
+		}
+		reversed := slices.Clone(list)
+		slices.Reverse(reversed)
+		return reversed, nil
+	},
+}
+
+var UniqFilter = TemplateFilter{
+	Name: "uniq",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		list, ok := core.ToList(pipedValue)
+		if !ok {
+			return pipedValue, nil
+		}
+		unique := make([]any, 0, len(list))
+		for _, item := range list {
+			if !slices.ContainsFunc(unique, func(seen any) bool { return core.Equal(seen, item) }) {
+				unique = append(unique, item)
+			}
+		}
+		return unique, nil
+	},
+}
+
+// WhereFilter keeps the items whose key equals the value, or whose key is truthy when no value is given.
+// "{% .posts | where "category" "go" %}"
+var WhereFilter = TemplateFilter{
+	Name: "where",
+	Args: []structure.FilterArg{
+		{Name: "key", Type: structure.ArgString},
+		{Name: "value", Optional: true},
+	},
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		list, ok := core.ToList(pipedValue)
+		if !ok {
+			return nil, fmt.Errorf("cannot filter %T", pipedValue)
+		}
+		key := args[0].(string)
+		matches := make([]any, 0, len(list))
+		for _, item := range list {
+			itemValue := field(item, key)
+			if args[1] == nil && core.IsTruthy(itemValue) || args[1] != nil && core.Equal(itemValue, args[1]) {
+				matches = append(matches, item)
+			}
+		}
+		return matches, nil
+	},
+}
+
+// MapFilter collects a key from every item, "{% .posts | map "title" | join ", " %}"
+var MapFilter = TemplateFilter{
+	Name: "map",
+	Args: []structure.FilterArg{{Name: "key", Type: structure.ArgString}},
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		list, ok := core.ToList(pipedValue)
+		if !ok {
+			return nil, fmt.Errorf("cannot map %T", pipedValue)
+		}
+		values := make([]any, len(list))
+		for i, item := range list {
+			values[i] = field(item, args[0].(string))
+		}
+		return values, nil
+	},
+}
+
+// field reads a dotted key such as "author.name" from a map, missing keys are nil
+func field(item any, key string) any {
+	for _, part := range strings.Split(key, ".") {
+		m, ok := core.ToMap(item)
+		if !ok {
+			return nil
+		}
+		item = m[part]
+	}
+	return item
+}
@@ -0,0 +1,164 @@
+package filters
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kato-studio/wispy/template/core"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// Named layouts accepted by "date" and "time_format" besides Go layouts and strftime patterns
+var dateLayouts = map[string]string{
+	"date":     "2006-01-02",
+	"time":     "15:04",
+	"datetime": "2006-01-02 15:04",
+	"long":     "January 2, 2006",
+	"short":    "Jan 2, 2006",
+	"kitchen":  time.Kitchen,
+	"rfc822":   time.RFC822,
+	"rfc1123":  time.RFC1123,
+	"rfc3339":  time.RFC3339,
+	"iso8601":  time.RFC3339,
+}
+
+// Layouts tried in order when a date is given as a string
+var dateInputLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"January 2, 2006",
+	"Jan 2, 2006",
+}
+
+// DateFilter formats a date in an optional timezone, "{% .published | date "long" "Europe/Berlin" %}".
+// Accepts time.Time, common date strings, "now" and unix timestamps in seconds
+var DateFilter = TemplateFilter{
+	Name: "date",
+	Args: []structure.FilterArg{
+		{Name: "layout", Type: structure.ArgString, Optional: true, Default: "date"},
+		{Name: "timezone", Type: structure.ArgString, Optional: true, Default: ""},
+	},
+	Handler: formatDate,
+}
+
+var TimeFormatFilter = TemplateFilter{
+	Name: "time_format",
+	Args: []structure.FilterArg{
+		{Name: "layout", Type: structure.ArgString, Optional: true, Default: "time"},
+		{Name: "timezone", Type: structure.ArgString, Optional: true, Default: ""},
+	},
+	Handler: formatDate,
+}
+
+func formatDate(pipedValue any, args []any) (any, error) {
+	if pipedValue == nil || pipedValue == "" {
+		return "", nil
+	}
+	t, err := toTime(pipedValue)
+	if err != nil {
+		return nil, err
+	}
+	if zone := args[1].(string); zone != "" {
+		location, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", zone)
+		}
+		t = t.In(location)
+	}
+	return t.Format(dateLayout(args[0].(string))), nil
+}
+
+func toTime(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		s := strings.TrimSpace(v)
+		switch strings.ToLower(s) {
+		case "now":
+			return time.Now(), nil
+		case "today":
+			year, month, day := time.Now().Date()
+			return time.Date(year, month, day, 0, 0, 0, 0, time.Local), nil
+		}
+		for _, layout := range dateInputLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+	default:
+		if seconds, ok := core.ToFloat(v); ok {
+			return time.Unix(int64(seconds), 0).UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot read %q as a date", core.Stringify(value))
+}
+
+// dateLayout resolves named layouts and converts strftime patterns such as "%Y-%m-%d" to Go layouts
+func dateLayout(layout string) string {
+	if named, ok := dateLayouts[strings.ToLower(layout)]; ok {
+		return named
+	}
+	if !strings.Contains(layout, "%") {
+		return layout
+	}
+	var sb strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' || i+1 == len(layout) {
+			sb.WriteByte(layout[i])
+			continue
+		}
+		i++
+		directive := string(layout[i])
+		if layout[i] == '-' && i+1 < len(layout) {
+			i++
+			directive = "-" + string(layout[i])
+		}
+		if goLayout, ok := strftime[directive]; ok {
+			sb.WriteString(goLayout)
+		} else {
+			sb.WriteString("%" + directive)
+		}
+	}
+	return sb.String()
+}
+
+var strftime = map[string]string{
+	"Y":  "2006",
+	"y":  "06",
+	"m":  "01",
+	"-m": "1",
+	"d":  "02",
+	"-d": "2",
+	"e":  "_2",
+	"j":  "002",
+	"B":  "January",
+	"b":  "Jan",
+	"h":  "Jan",
+	"A":  "Monday",
+	"a":  "Mon",
+	"H":  "15",
+	"I":  "03",
+	"-I": "3",
+	"l":  "3",
+	"M":  "04",
+	"S":  "05",
+	"p":  "PM",
+	"P":  "pm",
+	"Z":  "MST",
+	"z":  "-0700",
+	"F":  "2006-01-02",
+	"T":  "15:04:05",
+	"%":  "%",
+}
@@ -1,9 +1,13 @@
 package filters
 
 import (
-	"strconv"
+	"fmt"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/kato-studio/wispy/template/core"
+	common "github.com/kato-studio/wispy/wispy_common"
 	"github.com/kato-studio/wispy/wispy_common/structure"
 )
 
@@ -11,14 +15,15 @@ import (
 //
 //	type TemplateFilter struct {
 //		Name    string
-//		Handler func(pipedValue any, args []string) (value any, err error)
+//		Args    []structure.FilterArg
+//		Handler func(pipedValue any, args []any) (value any, err error)
 //	}
 type TemplateFilter = structure.TemplateFilter
 
 // Default template data filters functions
 var UpcaseFilter = TemplateFilter{
 	Name: "upcase",
-	Handler: func(pipedValue any, args []string) (value any, err error) {
+	Handler: func(pipedValue any, args []any) (value any, err error) {
 		if s, ok := pipedValue.(string); ok {
 			return strings.ToUpper(s), nil
 		}
@@ -28,7 +33,7 @@ var UpcaseFilter = TemplateFilter{
 
 var DowncaseFilter = TemplateFilter{
 	Name: "downcase",
-	Handler: func(pipedValue any, args []string) (value any, err error) {
+	Handler: func(pipedValue any, args []any) (value any, err error) {
 		if s, ok := pipedValue.(string); ok {
 			return strings.ToLower(s), nil
 		}
@@ -38,7 +43,7 @@ var DowncaseFilter = TemplateFilter{
 
 var CapitalizeFilter = TemplateFilter{
 	Name: "capitalize",
-	Handler: func(pipedValue any, args []string) (value any, err error) {
+	Handler: func(pipedValue any, args []any) (value any, err error) {
 		if s, ok := pipedValue.(string); ok && len(s) > 0 {
 			return strings.ToUpper(s[:1]) + s[1:], nil
 		}
@@ -48,7 +53,7 @@ var CapitalizeFilter = TemplateFilter{
 
 var StripFilter = TemplateFilter{
 	Name: "strip",
-	Handler: func(pipedValue any, args []string) (value any, err error) {
+	Handler: func(pipedValue any, args []any) (value any, err error) {
 		if s, ok := pipedValue.(string); ok {
 			return strings.TrimSpace(s), nil
 		}
@@ -58,11 +63,14 @@ var StripFilter = TemplateFilter{
 
 var TruncateFilter = TemplateFilter{
 	Name: "truncate",
-	Handler: func(pipedValue any, args []string) (value any, err error) {
-		if s, ok := pipedValue.(string); ok && len(args) > 0 {
-			if n, err := strconv.Atoi(args[0]); err == nil && len(s) > n {
-				return s[:n], nil
-			}
+	Args: []structure.FilterArg{{Name: "length", Type: structure.ArgInt}},
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		n := args[0].(int)
+		if n < 0 {
+			return nil, fmt.Errorf("length must not be negative, got %d", n)
+		}
+		if s, ok := pipedValue.(string); ok && len(s) > n {
+			return s[:n], nil
 		}
 		return pipedValue, nil
 	},
@@ -70,10 +78,11 @@ var TruncateFilter = TemplateFilter{
 
 var SliceFilter = TemplateFilter{
 	Name: "slice",
-	Handler: func(pipedValue any, args []string) (value any, err error) {
-		delimiter := ","
-		if len(args) > 0 && args[0] != "" {
-			delimiter = args[0]
+	Args: []structure.FilterArg{{Name: "delimiter", Type: structure.ArgString, Optional: true, Default: ","}},
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		delimiter := args[0].(string)
+		if delimiter == "" {
+			delimiter = ","
 		}
 		if s, ok := pipedValue.(string); ok {
 			parts := strings.Split(s, delimiter)
@@ -86,3 +95,130 @@ var SliceFilter = TemplateFilter{
 		return pipedValue, nil
 	},
 }
+
+// RawFilter marks a value as trusted HTML so it is written without auto-escaping
+var RawFilter = TemplateFilter{
+	Name: "raw",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		if safe, ok := pipedValue.(structure.SafeHTML); ok {
+			return safe, nil
+		}
+		return structure.SafeHTML(common.Stringify(pipedValue)), nil
+	},
+}
+
+// DefaultFilter replaces undefined, nil, false and empty values, "{% .title | default "Untitled" %}"
+var DefaultFilter = TemplateFilter{
+	Name:           "default",
+	Args:           []structure.FilterArg{{Name: "fallback"}},
+	AllowUndefined: true,
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		if !core.IsTruthy(pipedValue) {
+			if f, ok := core.ToFloat(pipedValue); !ok || f != 0 {
+				return args[0], nil
+			}
+		}
+		return pipedValue, nil
+	},
+}
+
+var ReplaceFilter = TemplateFilter{
+	Name: "replace",
+	Args: []structure.FilterArg{
+		{Name: "search", Type: structure.ArgString},
+		{Name: "replacement", Type: structure.ArgString, Optional: true, Default: ""},
+	},
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		if pipedValue == nil {
+			return "", nil
+		}
+		return strings.ReplaceAll(core.Stringify(pipedValue), args[0].(string), args[1].(string)), nil
+	},
+}
+
+var SizeFilter = TemplateFilter{
+	Name: "size",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		switch v := pipedValue.(type) {
+		case nil:
+			return 0, nil
+		case string:
+			return utf8.RuneCountInString(v), nil
+		case structure.SafeHTML:
+			return utf8.RuneCountInString(string(v)), nil
+		}
+		if list, ok := core.ToList(pipedValue); ok {
+			return len(list), nil
+		}
+		if m, ok := core.ToMap(pipedValue); ok {
+			return len(m), nil
+		}
+		return nil, fmt.Errorf("%T has no size", pipedValue)
+	},
+}
+
+// PluralizeFilter picks a word for a count, "{% .count | pluralize "item" %}" => "item" or "items"
+var PluralizeFilter = TemplateFilter{
+	Name: "pluralize",
+	Args: []structure.FilterArg{
+		{Name: "singular", Type: structure.ArgString},
+		{Name: "plural", Type: structure.ArgString, Optional: true, Default: ""},
+	},
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		count, ok := core.ToFloat(pipedValue)
+		if !ok {
+			if list, isList := core.ToList(pipedValue); isList {
+				count = float64(len(list))
+			} else {
+				return nil, fmt.Errorf("%q is not a count", core.Stringify(pipedValue))
+			}
+		}
+		singular, plural := args[0].(string), args[1].(string)
+		if count == 1 {
+			return singular, nil
+		}
+		if plural == "" {
+			plural = singular + "s"
+		}
+		return plural, nil
+	},
+}
+
+// SlugifyFilter turns text into a URL segment, "{% "Héllo, World!" | slugify %}" => "hello-world"
+var SlugifyFilter = TemplateFilter{
+	Name: "slugify",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		return Slugify(core.Stringify(pipedValue)), nil
+	},
+}
+
+// accented latin letters folded to ASCII by Slugify
+var slugFold = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae",
+	'ç': "c", 'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ð': "d", 'ñ': "n", 'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'œ': "oe",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ý': "y", 'ÿ': "y", 'þ': "th", 'ß': "ss",
+}
+
+// Slugify lowercases text, folds accents and joins words with "-"
+func Slugify(text string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		if folded, ok := slugFold[r]; ok {
+			sb.WriteString(folded)
+			dash = false
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "-")
+}
@@ -0,0 +1,72 @@
+package filters
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"html"
+	"net/url"
+
+	"github.com/kato-studio/wispy/template/core"
+	"github.com/kato-studio/wispy/template/markdown"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// JSONFilter encodes a value as JSON, inside <script> output values are already written as JSON
+var JSONFilter = TemplateFilter{
+	Name: "json",
+	Args: []structure.FilterArg{{Name: "indent", Type: structure.ArgBool, Optional: true, Default: false}},
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		var encoded []byte
+		if args[0].(bool) {
+			encoded, err = json.MarshalIndent(pipedValue, "", "  ")
+		} else {
+			encoded, err = json.Marshal(pipedValue)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return string(encoded), nil
+	},
+}
+
+var URLEncodeFilter = TemplateFilter{
+	Name: "url_encode",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		return url.QueryEscape(core.Stringify(pipedValue)), nil
+	},
+}
+
+// EscapeFilter escapes HTML for sites without auto-escaping. With auto-escaping the value is still escaped for the
+// context it is written in, such as the URL check of href, and HTML text is not escaped twice
+var EscapeFilter = TemplateFilter{
+	Name: "escape",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		return structure.EscapedHTML(html.EscapeString(core.Stringify(pipedValue))), nil
+	},
+}
+
+var Base64Filter = TemplateFilter{
+	Name: "base64",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		return base64.StdEncoding.EncodeToString([]byte(core.Stringify(pipedValue))), nil
+	},
+}
+
+var Base64DecodeFilter = TemplateFilter{
+	Name: "base64_decode",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		decoded, err := base64.StdEncoding.DecodeString(core.Stringify(pipedValue))
+		if err != nil {
+			return nil, err
+		}
+		return string(decoded), nil
+	},
+}
+
+// MarkdownFilter renders Markdown to HTML, raw HTML in the source is left out and unsafe link schemes are dropped
+var MarkdownFilter = TemplateFilter{
+	Name: "markdown",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		return structure.SafeHTML(markdown.ToHTML(core.Stringify(pipedValue))), nil
+	},
+}
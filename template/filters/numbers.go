@@ -0,0 +1,144 @@
+package filters
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kato-studio/wispy/template/core"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+var AbsFilter = TemplateFilter{
+	Name: "abs",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		return mathFilter(pipedValue, math.Abs)
+	},
+}
+
+var CeilFilter = TemplateFilter{
+	Name: "ceil",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		return mathFilter(pipedValue, math.Ceil)
+	},
+}
+
+var FloorFilter = TemplateFilter{
+	Name: "floor",
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		return mathFilter(pipedValue, math.Floor)
+	},
+}
+
+var RoundFilter = TemplateFilter{
+	Name: "round",
+	Args: []structure.FilterArg{{Name: "precision", Type: structure.ArgInt, Optional: true, Default: 0}},
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		precision := args[0].(int)
+		if precision == 0 {
+			return mathFilter(pipedValue, math.Round)
+		}
+		scale := math.Pow10(precision)
+		return mathFilter(pipedValue, func(f float64) float64 {
+			return math.Round(f*scale) / scale
+		})
+	},
+}
+
+// mathFilter applies fn to a number, whole results are returned as int so they print without a fraction
+func mathFilter(pipedValue any, fn func(float64) float64) (any, error) {
+	f, ok := core.ToFloat(pipedValue)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a number", core.Stringify(pipedValue))
+	}
+	result := fn(f)
+	if result == math.Trunc(result) && math.Abs(result) < math.MaxInt32 {
+		return int(result), nil
+	}
+	return result, nil
+}
+
+// NumberFormatFilter groups thousands and fixes the decimals, "{% 1234.5 | number_format 2 %}" => "1,234.50"
+var NumberFormatFilter = TemplateFilter{
+	Name: "number_format",
+	Args: []structure.FilterArg{
+		{Name: "decimals", Type: structure.ArgInt, Optional: true, Default: 0},
+		{Name: "decimal_separator", Type: structure.ArgString, Optional: true, Default: "."},
+		{Name: "thousands_separator", Type: structure.ArgString, Optional: true, Default: ","},
+	},
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		f, ok := core.ToFloat(pipedValue)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a number", core.Stringify(pipedValue))
+		}
+		return formatNumber(f, args[0].(int), args[1].(string), args[2].(string)), nil
+	},
+}
+
+type currencyFormat struct {
+	symbol   string
+	decimals int
+}
+
+var currencies = map[string]currencyFormat{
+	"USD": {"$", 2},
+	"CAD": {"CA$", 2},
+	"AUD": {"A$", 2},
+	"EUR": {"€", 2},
+	"GBP": {"£", 2},
+	"JPY": {"¥", 0},
+	"CNY": {"CN¥", 2},
+	"INR": {"₹", 2},
+	"KRW": {"₩", 0},
+	"BRL": {"R$", 2},
+	"MXN": {"MX$", 2},
+	"CHF": {"CHF ", 2},
+}
+
+// CurrencyFilter formats an amount with the symbol of an ISO 4217 code, "{% .price | currency "EUR" %}" => "€9.99"
+var CurrencyFilter = TemplateFilter{
+	Name: "currency",
+	Args: []structure.FilterArg{{Name: "code", Type: structure.ArgString, Optional: true, Default: "USD"}},
+	Handler: func(pipedValue any, args []any) (value any, err error) {
+		f, ok := core.ToFloat(pipedValue)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a number", core.Stringify(pipedValue))
+		}
+		code := strings.ToUpper(args[0].(string))
+		format, known := currencies[code]
+		if !known {
+			format = currencyFormat{code + " ", 2}
+		}
+		sign := ""
+		if f < 0 {
+			sign = "-"
+			f = -f
+		}
+		return sign + format.symbol + formatNumber(f, format.decimals, ".", ","), nil
+	},
+}
+
+func formatNumber(f float64, decimals int, decimalSep, thousandsSep string) string {
+	if decimals < 0 {
+		decimals = 0
+	}
+	formatted := strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+	whole, fraction, _ := strings.Cut(formatted, ".")
+
+	var sb strings.Builder
+	if f < 0 && strings.Trim(formatted, "0.") != "" {
+		sb.WriteByte('-')
+	}
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			sb.WriteString(thousandsSep)
+		}
+		sb.WriteRune(c)
+	}
+	if fraction != "" {
+		sb.WriteString(decimalSep)
+		sb.WriteString(fraction)
+	}
+	return sb.String()
+}
@@ -7,6 +7,8 @@ replace github.com/kato-studio/wispy/wispy_common => ../wispy_common
 require (
 	github.com/BurntSushi/toml v1.5.0
 	github.com/kato-studio/wispy/wispy_common v0.0.0-00010101000000-000000000000
+	github.com/yuin/goldmark v1.8.6
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -1,7 +1,6 @@
 package template
 
 import (
-	"bytes"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -20,34 +19,54 @@ const (
 	colorReset = "\033[0m"
 )
 
+// SitePublicFolderHandler serves the public folder of the site of the request host.
+//
+// Deprecated: use wispy.Server, its static stage serves the public folder
 func SitePublicFolderHandler(engine *structure.TemplateEngine, w http.ResponseWriter, r *http.Request) {
+	site, exists := engine.Sites.Lookup(r.Host)
+	if !exists {
+		http.Error(w, fmt.Sprintf("domain %s not found", r.Host), http.StatusNotFound)
+		return
+	}
+	if site.Config.Cache.Public != "" {
+		w.Header().Set("Cache-Control", site.Config.Cache.Public)
+	}
+
 	// Handle essential site files served from "/"
-	domain := r.Host
 	requestPath := r.URL.Path
 	filename := filepath.Base(requestPath)
 	if _, exists := core.ESSENTIAL_SERVE[filename]; exists {
-		targetFile := filepath.Join(engine.SITES_DIR, domain, "public/essential", filename)
+		targetFile := filepath.Join(engine.SITES_DIR, site.Domain, site.Config.Assets.PublicDir, "essential", filename)
 		// Serve the essential file
 		http.ServeFile(w, r, targetFile)
 		return
 	}
 
 	// Serve public assets
-	targetFile := filepath.Join(engine.SITES_DIR, domain, requestPath)
+	targetFile := filepath.Join(engine.SITES_DIR, site.Domain, requestPath)
 	fmt.Println(targetFile)
 	http.ServeFile(w, r, targetFile)
 
 }
+
+// SiteAuthRouteHandler serves the public files and rendered pages of the site of the request host.
+//
+// Deprecated: use wispy.Server, which splits host resolution, static files and rendering into stages
 func SiteAuthRouteHandler(engine *structure.TemplateEngine, w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 	domain := r.Host
 
 	// Look up the site structure for the domain
-	site, exists := engine.SiteMap[domain]
+	site, exists := engine.Sites.Lookup(domain)
 	if !exists {
 		http.Error(w, fmt.Sprintf("domain %s not found", domain), http.StatusNotFound)
 		return
 	}
+	// Pages rendered while sites are watched listen here for rebuilds
+	if r.URL.Path == LiveReloadPath && LiveReload.Active() {
+		LiveReload.ServeSite(w, r, site.Domain)
+		return
+	}
 
 	scopedDirectory := filepath.Join(engine.SITES_DIR, site.Domain)
 	// Handle public content
@@ -55,7 +74,7 @@ func SiteAuthRouteHandler(engine *structure.TemplateEngine, w http.ResponseWrite
 	// if file extension check if there is a valid file in public directory to serve
 	if filepath.Ext(path) != "" {
 		// Serve public content if available
-		root := os.DirFS(filepath.Join(scopedDirectory, "public"))
+		root := os.DirFS(filepath.Join(scopedDirectory, site.Config.Assets.PublicDir))
 		f, err := root.Open(path)
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -67,6 +86,9 @@ func SiteAuthRouteHandler(engine *structure.TemplateEngine, w http.ResponseWrite
 			stat, err := f.Stat()
 			if err != nil && !stat.IsDir() {
 				// File exists and is not a directory - serve it
+				if site.Config.Cache.Public != "" {
+					w.Header().Set("Cache-Control", site.Config.Cache.Public)
+				}
 				http.ServeFile(w, r, path)
 				return
 			}
@@ -74,20 +96,15 @@ func SiteAuthRouteHandler(engine *structure.TemplateEngine, w http.ResponseWrite
 	}
 	//
 	data := map[string]any{}
-	ctx := engine.InitCtx(scopedDirectory, &site, data)
+	ctx := engine.InitCtx(scopedDirectory, site, data)
 
 	//
-	page, err := RenderRoute(engine, ctx, r.URL.Path, data, w, r)
+	err := ServeRoute(engine, ctx, data, w, r)
 	if err != nil {
 		slog.Error("Rendering Route using \"RenderRoute()\"" + err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	// Measure rendering and styling times
 	renderTime := time.Now()
-	var results bytes.Buffer
-	results.WriteString(page)
 
 	// Log performance metrics
 	colorize := func(dur time.Duration) string {
@@ -100,9 +117,4 @@ func SiteAuthRouteHandler(engine *structure.TemplateEngine, w http.ResponseWrite
 		colorize(time.Since(startTime)),
 		colorReset,
 	)
-
-	// Write the final HTML to the response
-	w.Header().Set("Content-Type", "text/html")
-	w.WriteHeader(http.StatusOK)
-	w.Write(results.Bytes())
 }
@@ -0,0 +1,141 @@
+package template
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kato-studio/wispy/template/core"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// Lint parses every page, layout and partial of the sites in engine.Sites and reports problems that would otherwise
+// only show up when a page is rendered: invalid site configs and content front matter, unbalanced end tags, unknown tags and filters, missing partial,
+// layout and extends targets, import paths that don't exist, duplicate define names and page data files that fail to
+// decode or are named for a locale the site doesn't have.
+// Template problems are *structure.TemplateError located in the template source, use Detail() to print them with a snippet
+func Lint(engine *structure.TemplateEngine) (errs []error) {
+	for _, domain := range engine.Sites.Domains() {
+		site, exists := engine.Sites.Get(domain)
+		if !exists {
+			continue
+		}
+		scopedDirectory := filepath.Join(engine.SITES_DIR, site.Domain)
+		errs = append(errs, site.ConfigErrors...)
+		errs = append(errs, site.ContentErrors...)
+		for _, dir := range []string{"pages", "layouts", "partials"} {
+			root := filepath.Join(scopedDirectory, dir)
+			if _, err := os.Stat(root); os.IsNotExist(err) {
+				continue
+			}
+			err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if entry.IsDir() {
+					return nil
+				}
+				if dir == "pages" && strings.HasPrefix(entry.Name(), "data_") {
+					errs = append(errs, lintPageData(site, path)...)
+					return nil
+				}
+				if filepath.Ext(path) != engine.FILE_EXT {
+					return nil
+				}
+				errs = append(errs, lintTemplate(engine, site, scopedDirectory, path)...)
+				return nil
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to walk %s: %w", root, err))
+			}
+		}
+	}
+	return errs
+}
+
+// lintTemplate parses a single template and checks every node of it
+func lintTemplate(engine *structure.TemplateEngine, site *structure.SiteStructure, scopedDirectory, path string) (errs []error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return append(errs, fmt.Errorf("failed to read template %s: %w", path, err))
+	}
+	tmpl := core.Parse(engine, path, string(source))
+	errs = append(errs, tmpl.Errors...)
+
+	// tags check their targets against a context without a request, blocks collect define names per template
+	ctx := engine.InitCtx(scopedDirectory, site, map[string]any{})
+	ctx.CurrentTemplatePath = path
+	return append(errs, lintNodes(ctx, tmpl.Nodes)...)
+}
+
+// lintPageData checks a "data_<locale>" file next to a page, such errors otherwise only fail the render of the page
+func lintPageData(site *structure.SiteStructure, path string) (errs []error) {
+	ext := filepath.Ext(path)
+	if !slices.Contains(dataFileExts, ext) {
+		return nil
+	}
+	if _, err := ReadDataFile(path); err != nil {
+		errs = append(errs, fmt.Errorf("page data: %w", err))
+	}
+	tag := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "data_"), ext)
+	if locale, ok := siteLocale(site, tag, false); !ok || locale != tag {
+		errs = append(errs, fmt.Errorf("page data %s: %q is not a locale of the site, the file is never read", path, tag))
+	}
+	return errs
+}
+
+func lintNodes(ctx *structure.RenderCtx, nodes []*structure.Node) (errs []error) {
+	for _, node := range nodes {
+		var nodeErrs []error
+		switch node.Type {
+		case structure.OutputNode:
+			if _, err := core.CompileExpression(node.Content); err != nil {
+				nodeErrs = append(nodeErrs, err)
+			}
+			nodeErrs = append(nodeErrs, lintFilters(ctx, node.Content)...)
+		case structure.TagNode:
+			tag, exists := ctx.Engine.TagMap[node.Name]
+			if !exists {
+				nodeErrs = append(nodeErrs, fmt.Errorf("%w %q", structure.ErrUnknownTag, node.Name))
+				break
+			}
+			// raw tags such as css and js have no filters in their contents
+			if tag.Kind != structure.KindRaw {
+				nodeErrs = append(nodeErrs, lintFilters(ctx, node.Content)...)
+			}
+			if tag.Lint != nil {
+				nodeErrs = append(nodeErrs, tag.Lint(ctx, node)...)
+			}
+		}
+		errs = append(errs, locateLintErrors(node, nodeErrs)...)
+
+		errs = append(errs, lintNodes(ctx, node.Children)...)
+		for _, branch := range node.Branches {
+			errs = append(errs, locateLintErrors(branch, lintFilters(ctx, branch.Content))...)
+			errs = append(errs, lintNodes(ctx, branch.Children)...)
+		}
+	}
+	return errs
+}
+
+func locateLintErrors(node *structure.Node, nodeErrs []error) (errs []error) {
+	for _, err := range nodeErrs {
+		if _, located := err.(*structure.TemplateError); !located {
+			err = structure.NewTemplateError(node.Template, node.Pos, node.Name, err)
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func lintFilters(ctx *structure.RenderCtx, contents string) (errs []error) {
+	for _, name := range core.PipedFilters(contents) {
+		if _, exists := ctx.Engine.FilterMap[name]; !exists {
+			errs = append(errs, fmt.Errorf("%w %q in %q", structure.ErrUnknownFilter, name, strings.TrimSpace(contents)))
+		}
+	}
+	return errs
+}
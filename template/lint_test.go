@@ -0,0 +1,70 @@
+package template
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+func TestLint(t *testing.T) {
+	site := map[string]string{
+		"config.toml":           `domain = "example.com"`,
+		"layouts/root.hstm":     `{% passed %}`,
+		"layouts/docs.hstm":     `{% block body %}{% end-block %}`,
+		"partials/card.hstm":    `<b>{% .title %}</b>`,
+		"public/style.css":      `b {}`,
+		"pages/page.hstm":       `{% partial "card" title="Hi" %}{% .name | upcase %}`,
+		"pages/about/page.hstm": `{% import path="public/style.css" type="css" %}{% if .a %}a{% else %}b{% end-if %}`,
+	}
+	tests := []struct {
+		name  string
+		files map[string]string
+		// substring of the single expected error, empty when the site lints clean
+		want string
+		// error the diagnostic wraps
+		is error
+	}{
+		{name: "clean site"},
+		{"unknown tag", map[string]string{"pages/x/page.hstm": `{% nope %}`}, `unknown tag "nope"`, structure.ErrUnknownTag},
+		{"unknown filter", map[string]string{"pages/x/page.hstm": `{% .name | nope %}`}, `unknown filter "nope"`, structure.ErrUnknownFilter},
+		{"unknown filter in tag", map[string]string{"pages/x/page.hstm": `{% if .a | nope %}a{% end-if %}`}, `unknown filter "nope"`, structure.ErrUnknownFilter},
+		{"unknown filter in else-if", map[string]string{"pages/x/page.hstm": `{% if .a %}a{% else-if .b | nope %}b{% end-if %}`}, `unknown filter "nope"`, structure.ErrUnknownFilter},
+		{"unknown tag in partial", map[string]string{"partials/bad.hstm": `{% nope %}`}, `unknown tag "nope"`, structure.ErrUnknownTag},
+		{"unclosed tag", map[string]string{"pages/x/page.hstm": `{% if .a %}a`}, `could not find end tag for "end-if"`, nil},
+		{"stray end tag", map[string]string{"pages/x/page.hstm": `a{% end-if %}`}, `unexpected end tag "end-if"`, nil},
+		{"invalid expression", map[string]string{"pages/x/page.hstm": `{% .a + %}`}, `unexpected end of expression`, nil},
+		{"missing partial", map[string]string{"pages/x/page.hstm": `{% partial "nope" %}`}, `failed to read partial template file`, nil},
+		{"missing component", map[string]string{"pages/x/page.hstm": `{% component "nope" %}x{% end-component %}`}, `failed to read partial template file`, nil},
+		{"missing layout", map[string]string{"pages/x/page.hstm": `{% layout "nope" %}x{% end-layout %}`}, `failed to read layout template file`, nil},
+		{"missing extends", map[string]string{"pages/x/page.hstm": `{% extends "layouts/nope" %}`}, `failed to read layout template file`, nil},
+		{"missing import", map[string]string{"pages/x/page.hstm": `{% import path="public/nope.css" type="css" %}`}, `import "public/nope.css" not found`, nil},
+		{"duplicate define", map[string]string{"pages/x/page.hstm": `{% extends "layouts/docs" %}{% define body %}a{% end-define %}{% define body %}b{% end-define %}`}, `block "body" is defined more than once`, nil},
+		{"config error", map[string]string{"config.toml": "domain = \"example.com\"\n[assets]\npublic_dir = \"../up\"\n"}, `assets.public_dir: "../up" must stay inside the site folder`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(map[string]string)
+			for name, content := range site {
+				files[name] = content
+			}
+			for name, content := range tt.files {
+				files[name] = content
+			}
+			errs := Lint(buildTestSite(t, "example.com", files))
+			if tt.want == "" {
+				if len(errs) > 0 {
+					t.Errorf("Lint = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.want) {
+				t.Fatalf("Lint = %v, want one error with %q", errs, tt.want)
+			}
+			if tt.is != nil && !errors.Is(errs[0], tt.is) {
+				t.Errorf("Lint error %v does not wrap %v", errs[0], tt.is)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package template
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	common "github.com/kato-studio/wispy/wispy_common"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSMode selects where the certificates of the HTTPS listener come from
+type TLSMode string
+
+const (
+	// Plain HTTP only
+	TLSOff TLSMode = "off"
+	// Certificates from an ACME CA such as Let's Encrypt for the domains and aliases of the sites
+	TLSAutocert TLSMode = "autocert"
+	// Certificate and key read from CertFile and KeyFile
+	TLSFiles TLSMode = "files"
+)
+
+// ServerConfig configures the listeners of ServeSites
+type ServerConfig struct {
+	// Address of the plain HTTP listener. With TLS on it answers ACME challenges and redirects to HTTPS
+	HTTPAddr string
+	// Address of the HTTPS listener, unused when TLS is TLSOff
+	HTTPSAddr string
+	TLS       TLSMode
+	// Certificate and key files for TLSFiles
+	CertFile string
+	KeyFile  string
+	// Directory autocert keeps certificates in
+	CertCacheDir string
+	// Contact address given to the ACME CA
+	ACMEEmail string
+	// ACME directory, empty for Let's Encrypt
+	ACMEDirectoryURL string
+	// PEM file of the CA certificates the ACME directory is verified with, for a test CA such as Pebble whose
+	// certificate is not signed by a system root. Empty uses the system roots
+	ACMECAFile string
+	// Timeouts of every listener, zero for none (see http.Server)
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// How long requests still in flight get to finish on shutdown
+	ShutdownTimeout time.Duration
+}
+
+// DefaultServerConfig returns the listeners for the environment. Production serves HTTPS on :443 with autocert
+// and redirects :80, ACME_CONTACT_EMAIL, ACME_DIRECTORY_URL and ACME_CA_FILE configure the CA. Development serves HTTP on :8080
+func DefaultServerConfig() ServerConfig {
+	config := ServerConfig{
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		ShutdownTimeout:   15 * time.Second,
+	}
+	if !common.IsProduction() {
+		// no write timeout, it would end live reload streams
+		config.HTTPAddr = ":8080"
+		config.TLS = TLSOff
+		return config
+	}
+	config.HTTPAddr = ":80"
+	config.HTTPSAddr = ":443"
+	config.TLS = TLSAutocert
+	config.CertCacheDir = "/var/www/.cache"
+	config.ACMEEmail = os.Getenv("ACME_CONTACT_EMAIL")
+	config.ACMEDirectoryURL = os.Getenv("ACME_DIRECTORY_URL")
+	config.ACMECAFile = os.Getenv("ACME_CA_FILE")
+	config.WriteTimeout = 60 * time.Second
+	return config
+}
+
+// Listeners are the servers of a ServerConfig, built without binding any address so their handlers can be
+// tested with httptest
+type Listeners struct {
+	// Serves the sites, over HTTPS unless TLS is TLSOff
+	Main *http.Server
+	// Answers ACME challenges and redirects to HTTPS, nil when TLS is TLSOff
+	Redirect *http.Server
+	config   ServerConfig
+}
+
+// NewListeners builds the servers of a config for a handler such as a wispy.Server
+func NewListeners(handler http.Handler, engine *structure.TemplateEngine, config ServerConfig) (*Listeners, error) {
+	listeners := &Listeners{config: config}
+	listeners.Main = config.newServer(config.HTTPAddr, handler)
+	if config.TLS == TLSOff || config.TLS == "" {
+		return listeners, nil
+	}
+
+	listeners.Main.Addr = config.HTTPSAddr
+	listeners.Main.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	redirect := HTTPSRedirect(config.HTTPSAddr)
+	switch config.TLS {
+	case TLSAutocert:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: sitesHostPolicy(engine),
+			Email:      config.ACMEEmail,
+			Cache:      autocert.DirCache(config.CertCacheDir),
+		}
+		if config.ACMEDirectoryURL != "" || config.ACMECAFile != "" {
+			manager.Client = &acme.Client{DirectoryURL: config.ACMEDirectoryURL}
+		}
+		if config.ACMECAFile != "" {
+			roots, err := loadCertPool(config.ACMECAFile)
+			if err != nil {
+				return nil, fmt.Errorf("loading ACME CA: %w", err)
+			}
+			manager.Client.HTTPClient = &http.Client{
+				Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+			}
+		}
+		listeners.Main.TLSConfig.GetCertificate = manager.GetCertificate
+		redirect = manager.HTTPHandler(redirect)
+	case TLSFiles:
+		certificate, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		listeners.Main.TLSConfig.Certificates = []tls.Certificate{certificate}
+	default:
+		return nil, fmt.Errorf("unknown TLS mode %q, use %q, %q or %q", config.TLS, TLSOff, TLSAutocert, TLSFiles)
+	}
+	listeners.Redirect = config.newServer(config.HTTPAddr, redirect)
+	return listeners, nil
+}
+
+// loadCertPool reads the PEM certificates of a file into a pool
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s holds no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+func (config ServerConfig) newServer(addr string, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+	// live reload streams never finish on their own
+	server.RegisterOnShutdown(LiveReload.DisconnectAll)
+	return server
+}
+
+// ListenAndServe binds the configured addresses and serves until ctx is done, see Serve
+func (listeners *Listeners) ListenAndServe(ctx context.Context) error {
+	main, err := net.Listen("tcp", listeners.Main.Addr)
+	if err != nil {
+		return err
+	}
+	var redirect net.Listener
+	if listeners.Redirect != nil {
+		if redirect, err = net.Listen("tcp", listeners.Redirect.Addr); err != nil {
+			main.Close()
+			return err
+		}
+	}
+	return listeners.Serve(ctx, main, redirect)
+}
+
+// Serve accepts connections on the listeners until ctx is done or a server fails, then shuts down gracefully:
+// new connections are refused and requests in flight get ShutdownTimeout to finish.
+// redirect may be nil when there is no Redirect server
+func (listeners *Listeners) Serve(ctx context.Context, main, redirect net.Listener) error {
+	failed := make(chan error, 2)
+	serve := func(server *http.Server, listener net.Listener, useTLS bool) {
+		var err error
+		if useTLS {
+			slog.Info("Serving HTTPS", "addr", listener.Addr().String())
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			slog.Info("Serving HTTP", "addr", listener.Addr().String())
+			err = server.Serve(listener)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}
+	go serve(listeners.Main, main, listeners.Redirect != nil)
+	if listeners.Redirect != nil && redirect != nil {
+		go serve(listeners.Redirect, redirect, false)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down, waiting for requests in flight", "timeout", listeners.config.ShutdownTimeout.String())
+	case err = <-failed:
+	}
+
+	shutdownCtx := context.Background()
+	if listeners.config.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, listeners.config.ShutdownTimeout)
+		defer cancel()
+	}
+	var shutdownErrs []error
+	for _, server := range []*http.Server{listeners.Main, listeners.Redirect} {
+		if server != nil {
+			shutdownErrs = append(shutdownErrs, server.Shutdown(shutdownCtx))
+		}
+	}
+	return errors.Join(append(shutdownErrs, err)...)
+}
+
+// HTTPSRedirect sends requests to the same URL over HTTPS on the port of httpsAddr, 308 keeps the method and body
+func HTTPSRedirect(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// sitesHostPolicy allows certificates for the domains and aliases of the sites being served, and "www." of
+// domains without a subdomain. Sites added while running are allowed too
+func sitesHostPolicy(engine *structure.TemplateEngine) autocert.HostPolicy {
+	return func(_ context.Context, host string) error {
+		if strings.HasPrefix(host, "localhost") {
+			return fmt.Errorf("no certificates for %s", host)
+		}
+		if _, ok := engine.Sites.Lookup(host); ok {
+			return nil
+		}
+		if domain, ok := strings.CutPrefix(host, "www."); ok && strings.Count(domain, ".") == 1 {
+			if _, ok := engine.Sites.Get(domain); ok {
+				return nil
+			}
+		}
+		return fmt.Errorf("host %s is not served by any site", host)
+	}
+}
+
+// ServeSites serves the sites with a config until ctx is done, see Listeners
+func ServeSites(ctx context.Context, r http.Handler, engine *structure.TemplateEngine, config ServerConfig) error {
+	listeners, err := NewListeners(r, engine, config)
+	if err != nil {
+		return err
+	}
+	return listeners.ListenAndServe(ctx)
+}
+
+// StartHttpServer serves the sites with DefaultServerConfig until SIGINT or SIGTERM, then shuts down gracefully
+func StartHttpServer(r http.Handler, engine *structure.TemplateEngine) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	mode := "DEV"
+	if common.IsProduction() {
+		mode = "PROD"
+	}
+	slog.Info("Starting HTTP server", "mode", mode)
+	return ServeSites(ctx, r, engine, DefaultServerConfig())
+}
@@ -0,0 +1,196 @@
+package template
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		httpsAddr string
+		url       string
+		want      string
+	}{
+		{":443", "http://example.com/a?b=1", "https://example.com/a?b=1"},
+		{":443", "http://example.com:80/", "https://example.com/"},
+		{"", "http://example.com/a", "https://example.com/a"},
+		{":8443", "http://example.com:8080/a", "https://example.com:8443/a"},
+		{"127.0.0.1:8443", "http://[::1]:8080/", "https://[::1]:8443/"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		HTTPSRedirect(tt.httpsAddr).ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.url, nil))
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != tt.want {
+			t.Errorf("redirect of %s to %q = %d %q, want 308 %q", tt.url, tt.httpsAddr, w.Code, w.Header().Get("Location"), tt.want)
+		}
+	}
+}
+
+func TestSitesHostPolicy(t *testing.T) {
+	engine := buildTestSite(t, "example.com", map[string]string{
+		"config.toml": "domain = \"example.com\"\naliases = [\"example.org\"]\n",
+	})
+	policy := sitesHostPolicy(engine)
+	tests := []struct {
+		host    string
+		allowed bool
+	}{
+		{"example.com", true},
+		{"example.org", true},
+		{"www.example.com", true},
+		{"www.example.org", false},
+		{"other.com", false},
+		{"www.other.com", false},
+		{"localhost", false},
+	}
+	for _, tt := range tests {
+		if err := policy(context.Background(), tt.host); (err == nil) != tt.allowed {
+			t.Errorf("policy(%q) = %v, want allowed %v", tt.host, err, tt.allowed)
+		}
+	}
+}
+
+func TestNewListeners(t *testing.T) {
+	engine := StartDefaultEngine()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "site") })
+
+	listeners, err := NewListeners(handler, engine, ServerConfig{HTTPAddr: ":8080", TLS: TLSOff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listeners.Main.Addr != ":8080" || listeners.Main.TLSConfig != nil || listeners.Redirect != nil {
+		t.Errorf("plain HTTP listeners = %+v", listeners)
+	}
+
+	listeners, err = NewListeners(handler, engine, ServerConfig{HTTPAddr: ":80", HTTPSAddr: ":443", TLS: TLSAutocert, CertCacheDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listeners.Main.Addr != ":443" || listeners.Main.TLSConfig.GetCertificate == nil || listeners.Redirect.Addr != ":80" {
+		t.Errorf("autocert listeners = %+v", listeners)
+	}
+	w := httptest.NewRecorder()
+	listeners.Redirect.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/a", nil))
+	if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != "https://example.com/a" {
+		t.Errorf("redirect listener = %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	// the ACME directory is verified with the system roots or the given CA, never skipped
+	caServer := httptest.NewTLSServer(handler)
+	defer caServer.Close()
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caServer.Certificate().Raw}), 0o644)
+	os.WriteFile(filepath.Join(dir, "empty.pem"), []byte("no certificates"), 0o644)
+	config := ServerConfig{HTTPSAddr: ":443", TLS: TLSAutocert, CertCacheDir: dir, ACMEDirectoryURL: caServer.URL, ACMECAFile: caFile}
+	if _, err := NewListeners(handler, engine, config); err != nil {
+		t.Errorf("NewListeners with an ACME CA file: %v", err)
+	}
+
+	for name, config := range map[string]ServerConfig{
+		"unknown TLS mode":        {TLS: "other"},
+		"missing certificate":     {TLS: TLSFiles, CertFile: filepath.Join(dir, "missing.pem"), KeyFile: filepath.Join(dir, "missing.key")},
+		"missing ACME CA file":    {TLS: TLSAutocert, CertCacheDir: dir, ACMECAFile: filepath.Join(dir, "missing.pem")},
+		"ACME CA file without CA": {TLS: TLSAutocert, CertCacheDir: dir, ACMECAFile: filepath.Join(dir, "empty.pem")},
+	} {
+		if _, err := NewListeners(handler, engine, config); err == nil {
+			t.Errorf("NewListeners with %s succeeded", name)
+		}
+	}
+}
+
+// Cancelling the context stops accepting connections and lets requests in flight finish
+func TestServeShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+	listeners, err := NewListeners(handler, StartDefaultEngine(), ServerConfig{TLS: TLSOff, ShutdownTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + listener.Addr().String() + "/"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- listeners.Serve(ctx, listener, nil) }()
+
+	type response struct {
+		body string
+		err  error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		res, err := http.Get(url)
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		responses <- response{string(body), err}
+	}()
+
+	<-started
+	cancel()
+	// the server waits for the request in flight
+	select {
+	case err := <-served:
+		t.Fatalf("Serve returned with a request in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+
+	if res := <-responses; res.err != nil || res.body != "done" {
+		t.Errorf("request in flight = %q, %v", res.body, res.err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve = %v", err)
+	}
+	if _, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		t.Errorf("connection accepted after shutdown")
+	}
+}
+
+// Requests that outlast ShutdownTimeout end Serve with the deadline error
+func TestServeShutdownTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	listeners, err := NewListeners(handler, StartDefaultEngine(), ServerConfig{TLS: TLSOff, ShutdownTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- listeners.Serve(ctx, listener, nil) }()
+	go http.Get("http://" + listener.Addr().String() + "/")
+
+	<-started
+	cancel()
+	if err := <-served; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Serve = %v, want the shutdown deadline", err)
+	}
+}
@@ -0,0 +1,105 @@
+package template
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LiveReloadPath is where pages rendered in development listen for rebuilds of their site
+const LiveReloadPath = "/_wispy/live-reload"
+
+// liveReloadScript reloads the page when its site is rebuilt, added to pages through the AssetRegistry
+const liveReloadScript = `(function(){var s=new EventSource("` + LiveReloadPath + `");s.addEventListener("reload",function(){s.close();location.reload()})})();`
+
+// LiveReloadHub sends reload events to connected browsers over server-sent events
+type LiveReloadHub struct {
+	mu sync.Mutex
+	// connected browsers and the domain of the page they show
+	clients map[chan struct{}]string
+	// set while WatchSites runs, pages only get the script when something will tell them to reload
+	active atomic.Bool
+	// closed by DisconnectAll to end the streams connected before
+	disconnect chan struct{}
+}
+
+// LiveReload is the hub notified by WatchSites
+var LiveReload = &LiveReloadHub{clients: make(map[chan struct{}]string), disconnect: make(chan struct{})}
+
+// Active reports whether sites are being watched
+func (hub *LiveReloadHub) Active() bool {
+	return hub.active.Load()
+}
+
+func (hub *LiveReloadHub) setActive(active bool) {
+	hub.active.Store(active)
+}
+
+// Reload tells every browser showing a page of the domain to reload
+func (hub *LiveReloadHub) Reload(domain string) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for client, clientDomain := range hub.clients {
+		if clientDomain != domain {
+			continue
+		}
+		// a reload is already pending for slow clients
+		select {
+		case client <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// DisconnectAll ends the open streams, so a server shutting down doesn't wait for browsers to leave
+func (hub *LiveReloadHub) DisconnectAll() {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	close(hub.disconnect)
+	hub.disconnect = make(chan struct{})
+}
+
+// ServeSite streams reload events of a domain until the browser disconnects
+func (hub *LiveReloadHub) ServeSite(w http.ResponseWriter, r *http.Request, domain string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	client := make(chan struct{}, 1)
+	hub.mu.Lock()
+	hub.clients[client] = domain
+	disconnect := hub.disconnect
+	hub.mu.Unlock()
+	defer func() {
+		hub.mu.Lock()
+		delete(hub.clients, client)
+		hub.mu.Unlock()
+	}()
+
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	// comments keep proxies from closing idle connections
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-disconnect:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-client:
+			fmt.Fprint(w, "event: reload\ndata: {}\n\n")
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,84 @@
+// Package markdown renders CommonMark with strikethrough to HTML through goldmark.
+//
+// Raw HTML in the source is left out, link and image URLs with schemes other than
+// http, https, mailto, tel and ftp are replaced with "#".
+package markdown
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var renderer = goldmark.New(
+	goldmark.WithExtensions(extension.Strikethrough),
+	goldmark.WithParserOptions(
+		parser.WithASTTransformers(util.Prioritized(safeURLs{}, 100)),
+	),
+)
+
+// ToHTML renders Markdown source to HTML
+func ToHTML(src string) string {
+	var buf bytes.Buffer
+	if err := renderer.Convert([]byte(src), &buf); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// safeURLs replaces link and image URLs with schemes that can run code such as "javascript:"
+type safeURLs struct{}
+
+func (safeURLs) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var unsafeAutoLinks []*ast.AutoLink
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *ast.Link:
+			n.Destination = safeURL(n.Destination)
+		case *ast.Image:
+			n.Destination = safeURL(n.Destination)
+		case *ast.AutoLink:
+			if n.AutoLinkType == ast.AutoLinkURL && !isSafeURL(string(n.URL(source))) {
+				unsafeAutoLinks = append(unsafeAutoLinks, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	// unsafe autolinks stay as plain text
+	for _, n := range unsafeAutoLinks {
+		n.Parent().ReplaceChild(n.Parent(), n, ast.NewString(n.Label(source)))
+	}
+}
+
+// safeURL returns "#" in place of URLs with unsafe schemes, escapes and entities are resolved first
+// like they are when the URL is rendered
+func safeURL(url []byte) []byte {
+	resolved := util.ResolveEntityNames(util.ResolveNumericReferences(util.UnescapePunctuations(url)))
+	if isSafeURL(string(resolved)) {
+		return url
+	}
+	return []byte("#")
+}
+
+// isSafeURL reports whether url is relative or uses one of the allowed schemes
+func isSafeURL(url string) bool {
+	url = strings.TrimSpace(url)
+	if k := strings.IndexAny(url, ":/?#"); k > 0 && url[k] == ':' {
+		switch strings.ToLower(url[:k]) {
+		case "http", "https", "mailto", "tel", "ftp":
+		default:
+			return false
+		}
+	}
+	return true
+}
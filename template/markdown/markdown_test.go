@@ -0,0 +1,61 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		// inline
+		{"emphasis", "*a* _b_ **c** __d__", "<p><em>a</em> <em>b</em> <strong>c</strong> <strong>d</strong></p>"},
+		{"nested emphasis", "***a** b*", "<p><em><strong>a</strong> b</em></p>"},
+		{"intraword underscore", "snake_case_name", "<p>snake_case_name</p>"},
+		{"strikethrough", "~~gone~~", "<p><del>gone</del></p>"},
+		{"code span", "`a < b` and `` ` ``", "<p><code>a &lt; b</code> and <code>`</code></p>"},
+		{"link", `[home](/index "Home")`, `<p><a href="/index" title="Home">home</a></p>`},
+		{"reference link", "[a][ref]\n\n[ref]: https://example.com", `<p><a href="https://example.com">a</a></p>`},
+		{"image", "![a *cat*](/cat.png)", `<p><img src="/cat.png" alt="a cat"></p>`},
+		{"autolink", "<https://example.com>", `<p><a href="https://example.com">https://example.com</a></p>`},
+		{"email autolink", "<ann@example.com>", `<p><a href="mailto:ann@example.com">ann@example.com</a></p>`},
+		{"escapes", `\*not em\* & <3`, "<p>*not em* &amp; &lt;3</p>"},
+		{"hard break", "a  \nb", "<p>a<br>\nb</p>"},
+		// blocks
+		{"atx headings", "# One\n### Three ###", "<h1>One</h1>\n<h3>Three</h3>"},
+		{"setext headings", "One\n===\nTwo\n---", "<h1>One</h1>\n<h2>Two</h2>"},
+		{"paragraphs", "a\nb\n\nc", "<p>a\nb</p>\n<p>c</p>"},
+		{"fenced code", "```go\nx := 1 < 2\n```", "<pre><code class=\"language-go\">x := 1 &lt; 2\n</code></pre>"},
+		{"indented code", "    code\n    more", "<pre><code>code\nmore\n</code></pre>"},
+		{"block quote", "> quote\n> **bold**", "<blockquote>\n<p>quote\n<strong>bold</strong></p>\n</blockquote>"},
+		{"thematic break", "a\n\n***\n\nb", "<p>a</p>\n<hr>\n<p>b</p>"},
+		// lists
+		{"unordered list", "- a\n- b", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>"},
+		{"ordered list start", "3. a\n4. b", "<ol start=\"3\">\n<li>a</li>\n<li>b</li>\n</ol>"},
+		{"nested list", "- a\n  - b\n    1. c\n- d", "<ul>\n<li>a\n<ul>\n<li>b\n<ol>\n<li>c</li>\n</ol>\n</li>\n</ul>\n</li>\n<li>d</li>\n</ul>"},
+		{"loose list", "- a\n\n- b", "<ul>\n<li>\n<p>a</p>\n</li>\n<li>\n<p>b</p>\n</li>\n</ul>"},
+		// unsafe content
+		{"javascript link", "[x](javascript:alert(1))", `<p><a href="#">x</a></p>`},
+		{"javascript link case", "[x](JaVaScRiPt:alert(1))", `<p><a href="#">x</a></p>`},
+		{"entity encoded scheme", "[x](javascript&#58;alert(1))", `<p><a href="#">x</a></p>`},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD4=)", `<p><a href="#">x</a></p>`},
+		{"vbscript image", "![x](vbscript:msgbox)", `<p><img src="#" alt="x"></p>`},
+		{"javascript autolink", "<javascript:alert(1)>", "<p>javascript:alert(1)</p>"},
+		{"javascript reference", "[x][r]\n\n[r]: javascript:alert(1)", `<p><a href="#">x</a></p>`},
+		{"mailto link", "[x](mailto:ann@example.com)", `<p><a href="mailto:ann@example.com">x</a></p>`},
+		{"colon in path", "[x](/a:b)", `<p><a href="/a:b">x</a></p>`},
+		{"raw html", "<script>alert(1)</script>", "<!-- raw HTML omitted -->"},
+		{"inline raw html", "a <img src=x onerror=alert(1)> b", "<p>a <!-- raw HTML omitted --> b</p>"},
+		{"attribute quotes", `[x](/a"b)`, `<p><a href="/a%22b">x</a></p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.TrimSpace(ToHTML(tt.src)); got != tt.want {
+				t.Errorf("ToHTML(%q)\n got %q\nwant %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// MatchPageCacheRule returns the first [[cache.routes]] rule of a site matching a request path
+func MatchPageCacheRule(site *structure.SiteStructure, requestPath string) (structure.PageCacheRule, bool) {
+	for _, rule := range site.Config.Cache.Routes {
+		if RouteMatches([]string{rule.Path}, requestPath) {
+			return rule, true
+		}
+	}
+	return structure.PageCacheRule{}, false
+}
+
+// pageCacheRule returns the rule caching the page of a request. Only GET and HEAD requests are cached,
+// and requests of logged-in users only when the rule marks the page shareable
+func pageCacheRule(ctx *structure.RenderCtx, r *http.Request) (structure.PageCacheRule, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return structure.PageCacheRule{}, false
+	}
+	rule, ok := MatchPageCacheRule(ctx.Site, r.URL.Path)
+	if !ok || (ctx.UserID != "" && !rule.Shareable) {
+		return structure.PageCacheRule{}, false
+	}
+	return rule, true
+}
+
+// pageCacheKey identifies a cached page by its domain, path and the parts of the request the rule varies on
+func pageCacheKey(ctx *structure.RenderCtx, rule structure.PageCacheRule, r *http.Request) string {
+	var key strings.Builder
+	key.WriteString(ctx.Site.Domain)
+	key.WriteString(r.URL.Path)
+	if len(rule.Query) > 0 {
+		query := url.Values{}
+		for _, name := range rule.Query {
+			if values, ok := r.URL.Query()[name]; ok {
+				query[name] = values
+			}
+		}
+		// Encode sorts by name so the order of the request doesn't matter
+		key.WriteString("?" + query.Encode())
+	}
+	if rule.Role {
+		roles := slices.Sorted(slices.Values(ctx.UserRoles))
+		key.WriteString("|role=" + strings.Join(roles, ","))
+	}
+	if rule.Locale {
+		locale, _ := RequestLocale(ctx.Site, r, r.URL.Path)
+		key.WriteString("|locale=" + locale)
+	}
+	return key.String()
+}
+
+// servePageCache answers a request from the page cache, a stale page is rendered again in the background
+func servePageCache(engine *structure.TemplateEngine, ctx *structure.RenderCtx, rule structure.PageCacheRule, key string, w http.ResponseWriter, r *http.Request) bool {
+	cached, ok := engine.Pages.Get(ctx.Site.Domain, key, rule.Disk)
+	if !ok {
+		return false
+	}
+	state := "HIT"
+	if !cached.Fresh(time.Now()) {
+		state = "STALE"
+		revalidatePage(engine, ctx, rule, key, r)
+	}
+	w.Header().Set("X-Wispy-Cache", state)
+	NewPageWriter(w, ctx.Site).Write(cached.Body)
+	return true
+}
+
+// storePage keeps a rendered page for the TTL and stale_while_revalidate of its rule
+func storePage(engine *structure.TemplateEngine, ctx *structure.RenderCtx, rule structure.PageCacheRule, key string, body []byte) {
+	now := time.Now()
+	engine.Pages.Set(&structure.CachedPage{
+		Key:        key,
+		Domain:     ctx.Site.Domain,
+		Route:      ctx.Request.URL.Path,
+		Tags:       rule.Tags,
+		Body:       body,
+		Expires:    now.Add(rule.TTL),
+		StaleUntil: now.Add(rule.TTL + rule.StaleWhileRevalidate),
+	}, rule.Disk)
+}
+
+// cacheablePage reports whether a finished render may be stored.
+// Pages that redirected, had template errors or hold something of the visitor (see RenderCtx.Private) are not
+func cacheablePage(ctx *structure.RenderCtx) bool {
+	return !ctx.Halted && !ctx.Private && len(ctx.Errors) == 0
+}
+
+// revalidatePage renders a stale page again in the background, as the user of the request that found it stale
+func revalidatePage(engine *structure.TemplateEngine, ctx *structure.RenderCtx, rule structure.PageCacheRule, key string, r *http.Request) {
+	if !engine.Pages.StartRevalidate(key) {
+		return
+	}
+	site, scopedDirectory := ctx.Site, ctx.ScopedDirectory
+	userID, userRoles, usersDB := ctx.UserID, ctx.UserRoles, ctx.UsersDB
+	req := r.Clone(context.Background())
+
+	go func() {
+		defer engine.Pages.EndRevalidate(key)
+		data := map[string]any{}
+		fresh := engine.InitCtx(scopedDirectory, site, data)
+		fresh.UserID, fresh.UserRoles, fresh.UsersDB = userID, userRoles, usersDB
+
+		var body bytes.Buffer
+		err := RenderRoute(engine, fresh, &body, req.URL.Path, data, httptest.NewRecorder(), req)
+		logRenderErrors(req, fresh.Errors)
+		if err != nil {
+			slog.Error("Failed to revalidate cached page", "key", key, "error", err)
+			return
+		}
+		// a site rebuilt meanwhile has purged its pages, the render of the old site is dropped
+		if current, ok := engine.Sites.Get(site.Domain); !ok || current != site || !cacheablePage(fresh) {
+			return
+		}
+		storePage(engine, fresh, rule, key, body.Bytes())
+	}()
+}
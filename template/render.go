@@ -1,16 +1,24 @@
 package template
 
 import (
-	"encoding/json"
+	"bytes"
+	"cmp"
+	"errors"
 	"fmt"
-	"log"
+	"html"
+	"io"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/kato-studio/wispy/template/core"
+	common "github.com/kato-studio/wispy/wispy_common"
 	"github.com/kato-studio/wispy/wispy_common/structure"
 )
 
@@ -25,20 +33,22 @@ const (
 	// colorGrey = "\033[90m"
 )
 
-// RenderRoute renders a page route for a given domain and page name.
+// RenderRoute renders a page route for a given domain and page name and writes the page to out.
 // It looks up the page in the site's route map
 // The route key is assumed to be in the form "domain/pageName" (e.g. "example.com/about").
-func RenderRoute(engine *structure.TemplateEngine, ctx *structure.RenderCtx, requestPath string, data map[string]any, w http.ResponseWriter, r *http.Request) (output string, err error) {
+func RenderRoute(engine *structure.TemplateEngine, ctx *structure.RenderCtx, out io.Writer, requestPath string, data map[string]any, w http.ResponseWriter, r *http.Request) (err error) {
 	ctx.ResponseWriter = &w
 	ctx.Request = r
 
 	// Construct the route key. If route is empty, key becomes "domain/".
 	site := ctx.Site
 	routeKey := site.Domain + requestPath
-	route, exists := site.Routes[routeKey]
+	// "/fr/about" renders the route "/about" in French
+	locale, routePath := RequestLocale(site, r, requestPath)
+	ctx.Locale = locale
+	route, params, exists := MatchRoute(site, routePath)
 	if !exists {
-		http.Redirect(*ctx.ResponseWriter, ctx.Request, "/error?code=404&source="+requestPath+"&error=route not found", http.StatusSeeOther)
-		return "", fmt.Errorf("route %s not found", routeKey)
+		return &structure.StatusError{Status: http.StatusNotFound, Err: fmt.Errorf("route %s not found", routeKey)}
 	}
 
 	// Create the render context and inject it into the data.
@@ -54,6 +64,8 @@ func RenderRoute(engine *structure.TemplateEngine, ctx *structure.RenderCtx, req
 	if _, ok := data["URL"].(map[string]any)["Query"].(map[string]any); !ok {
 		data["URL"].(map[string]any)["Query"] = make(map[string]any)
 	}
+	// Values of dynamic route segments, "pages/blog/[slug]" exposes .URL.Params.slug
+	data["URL"].(map[string]any)["Params"] = params
 	queryMap := data["URL"].(map[string]any)["Query"].(map[string]any)
 	// Add query parameters
 	for key, values := range r.URL.Query() {
@@ -64,68 +76,339 @@ func RenderRoute(engine *structure.TemplateEngine, ctx *structure.RenderCtx, req
 		}
 	}
 
-	// Read and merge JSON data if the file exist
-	jsonPath := filepath.Join(filepath.Dir(route.Path), "data_en.json")
-	jsonAsBytes, err := os.ReadFile(jsonPath)
-	if err != nil {
-		log.Println("data_en.json not found")
-		log.Printf("failed to read JSON file: %s \n", err.Error())
-	} else {
-		var jsonData map[string]any
-		if err := json.Unmarshal(jsonAsBytes, &jsonData); err != nil {
-			return "", fmt.Errorf("failed to unmarshal JSON: %w", err)
-		}
+	// Custom values from the [site] table of config.toml and the files of data/
+	if _, ok := data["Site"]; !ok {
+		data["Site"] = siteData(site, locale)
+	}
+	data["Locale"] = locale
 
-		// Merge JSON data with existing data
-		for k, v := range jsonData {
-			data[k] = v
-		}
+	// Entries of the content collections, and the entry a collection route renders
+	if _, ok := data["Collections"]; !ok {
+		data["Collections"], data["Taxonomies"] = collectionsData(site, time.Now())
+	}
+	if route.Entry != nil {
+		data["Entry"] = route.Entry.Values
 	}
 
-	rootLayoutPath := path.Join(ctx.ScopedDirectory, "layouts", "root.hstm")
-	rootLayoutAsBytes, err := os.ReadFile(rootLayoutPath)
+	// Reload the page in the browser when the site is rebuilt, see WatchSites
+	if LiveReload.Active() && !common.IsProduction() {
+		ctx.AssetRegistry.Add(&structure.Asset{Type: structure.JS, Content: liveReloadScript, IsInline: true, Priority: 1000})
+	}
+
+	// Data files next to the page, nested keys are merged into the data
+	fileData, err := pageData(site, filepath.Dir(route.Path), locale)
 	if err != nil {
-		fmt.Println(err)
-		slog.Error("Failed to read root layout at ", rootLayoutPath, ": ", err)
-		return "", fmt.Errorf("Failed to read root layout at %s", rootLayoutPath)
+		return err
 	}
+	MergeData(data, fileData)
 
-	templateAsBytes, err := os.ReadFile(route.Path)
+	pageTemplate, err := core.LoadTemplate(ctx.Engine, site.Domain, route.Path)
 	if err != nil {
-		fmt.Println(err)
-		slog.Error("Failed to read page template at ", route.Path, ": ", err)
-		return "", fmt.Errorf("route %s not found", routeKey)
+		slog.Error("Failed to read page template", "path", route.Path, "error", err)
+		return &structure.StatusError{Status: http.StatusNotFound, Err: fmt.Errorf("route %s not found", routeKey)}
 	}
 	// Update for use in asset imports
 	ctx.CurrentTemplatePath = strings.TrimSuffix(route.Path, ctx.Engine.PAGE_FILE_NAME)
 	//
-	var sb strings.Builder
 	ctx.Data = data
-	renderErrors := Render(ctx, &sb, string(templateAsBytes))
+	renderErrors, err := renderWithRootLayout(ctx, out, pageTemplate)
+	ctx.Errors = renderErrors
+
+	// Strict mode halts on the first undefined variable, unknown filter or unknown tag and the page is not served
+	if ctx.Halted && core.UndefinedMode(ctx) == structure.UndefinedStrict {
+		for _, err := range renderErrors {
+			if structure.IsUndefined(err) {
+				return err
+			}
+		}
+	}
+	// Tags such as restricted-by-role end the page with an error status
+	if ctx.Halted && ctx.Status >= http.StatusBadRequest {
+		return &structure.StatusError{Status: ctx.Status, Err: fmt.Errorf("route %s ended with status %d", routeKey, ctx.Status)}
+	}
+	return err
+}
+
+// siteData returns the custom values of the [site] table of config.toml with the data/ files of a locale as Data,
+// exposed to templates as .Site. Nested maps are shared with the site, "assign" copies them before writing
+func siteData(site *structure.SiteStructure, locale string) map[string]any {
+	data := maps.Clone(site.Config.Data)
+	if data == nil {
+		data = make(map[string]any)
+	}
+	data["Data"] = localeSiteData(site, locale)
+	return data
+}
+
+// logRenderErrors logs the template errors of a served page, with the source snippet of errors located in a template
+func logRenderErrors(r *http.Request, renderErrors []error) {
+	for _, err := range renderErrors {
+		if te, ok := err.(*structure.TemplateError); ok {
+			slog.Error("Template error", "host", r.Host, "path", r.URL.Path, "error", te.Error(), "detail", te.Detail())
+		} else {
+			slog.Error("Template error", "host", r.Host, "path", r.URL.Path, "error", err)
+		}
+	}
+}
+
+// renderWithRootLayout renders a page template and streams it to out wrapped in the site's layouts/root.hstm.
+// Nothing is sent before the page is done so the head tags and assets it adds are known when the root layout's
+// slots are filled, and a page that halts can still be answered with its own status
+func renderWithRootLayout(ctx *structure.RenderCtx, out io.Writer, pageTemplate *structure.Template) (renderErrors []error, err error) {
+	rootLayoutPath := path.Join(ctx.ScopedDirectory, "layouts", ctx.Site.Config.RootLayout+".hstm")
+	rootLayout, err := core.LoadFirstTemplate(ctx.Engine, ctx.Site.Domain,
+		rootLayoutPath,
+		path.Join(ctx.ScopedDirectory, "layouts", ctx.Site.Config.RootLayout, "index.hstm"),
+	)
+	if err != nil {
+		slog.Error("Failed to read root layout", "path", rootLayoutPath, "error", err)
+		return nil, fmt.Errorf("Failed to read root layout at %s", rootLayoutPath)
+	}
 
-	// Render the layouts/root.hstm
-	ctx.Passed = sb.String()
-	var rootSb strings.Builder
-	rootRenderErrs := Render(ctx, &rootSb, string(rootLayoutAsBytes))
-	if len(rootRenderErrs) > 0 {
-		renderErrors = append(renderErrors, rootRenderErrs...)
+	// The page renders where the root layout places "passed". Output is held back until the page is done,
+	// then root-head and root-css are filled and the rest of the root layout streams, root-js is filled at the end
+	renderErrors = append(renderErrors, pageTemplate.Errors...)
+	slots := structure.NewSlotWriter(out)
+	ctx.Passed = &structure.Slot{
+		Nodes: withDefaultLayout(ctx, pageTemplate),
+		Scope: ctx.CurrentScope(),
+		Rendered: func() {
+			if !ctx.Halted {
+				slots.Resolve()
+			}
+		},
+	}
+	renderErrors = append(renderErrors, core.ExecuteTemplate(ctx, slots, rootLayout)...)
+	if ctx.Halted {
+		return renderErrors, nil
 	}
+	return renderErrors, slots.Flush()
+}
 
-	// TODO: better error logging using built-in go logger with better highlighting
-	for ei, err := range renderErrors {
-		if ei == 0 {
-			fmt.Println(colorGrey + "-------------------" + colorReset)
+// withDefaultLayout wraps the nodes of a page in the site's default_layout unless the page picks its own layout
+func withDefaultLayout(ctx *structure.RenderCtx, pageTemplate *structure.Template) []*structure.Node {
+	layout := ctx.Site.Config.DefaultLayout
+	if layout == "" {
+		return pageTemplate.Nodes
+	}
+	for _, node := range pageTemplate.Nodes {
+		if node.Type == structure.TagNode && (node.Name == "layout" || node.Name == "extends") {
+			return pageTemplate.Nodes
 		}
-		fmt.Println(colorGrey+"["+colorRed+"Error"+colorGrey+"] "+colorReset, err)
-		if ei == len(renderErrors)-1 {
-			fmt.Println(colorGrey + "-------------------")
+	}
+	// the same as a "{% layout %}" tag at the top of the page
+	return []*structure.Node{{
+		Type:     structure.TagNode,
+		Name:     "layout",
+		Content:  layout,
+		Template: pageTemplate,
+		Children: pageTemplate.Nodes,
+	}}
+}
+
+// ServeRoute renders the route of a request and sends it as the response, or the page cached for it (see PageCacheRule).
+// Pages stream to the client, but are buffered while developing so the error overlay can be added
+// and in strict mode so an aborted page can still be replaced by the error page
+func ServeRoute(engine *structure.TemplateEngine, ctx *structure.RenderCtx, data map[string]any, w http.ResponseWriter, r *http.Request) error {
+	rule, cache := pageCacheRule(ctx, r)
+	var cacheKey string
+	if cache {
+		cacheKey = pageCacheKey(ctx, rule, r)
+		if servePageCache(engine, ctx, rule, cacheKey, w, r) {
+			return nil
 		}
+		w.Header().Set("X-Wispy-Cache", "MISS")
 	}
 
-	return rootSb.String(), err
+	page := NewPageWriter(w, ctx.Site)
+	buffer := !common.IsProduction() || core.UndefinedMode(ctx) == structure.UndefinedStrict
+	var buffered bytes.Buffer
+	var out io.Writer = page
+	if buffer || cache {
+		out = &buffered
+	}
+	// cached pages still stream, a copy is kept for the cache
+	if cache && !buffer {
+		out = io.MultiWriter(page, &buffered)
+	}
+
+	err := RenderRoute(engine, ctx, out, r.URL.Path, data, w, r)
+	logRenderErrors(r, ctx.Errors)
+	if err != nil {
+		// part of the page has been sent, the status can't change anymore
+		if page.Started() {
+			return err
+		}
+		status := http.StatusInternalServerError
+		var statusErr *structure.StatusError
+		if errors.As(err, &statusErr) {
+			status = statusErr.Status
+		}
+		WriteErrorPage(ctx, w, status, err)
+		// missing pages and denied access are answered, not failures of the server
+		if status < http.StatusInternalServerError {
+			return nil
+		}
+		return err
+	}
+	if cache && cacheablePage(ctx) {
+		storePage(engine, ctx, rule, cacheKey, buffered.Bytes())
+	}
+	if !buffer {
+		return nil
+	}
+	// Show template errors on top of the page while developing
+	if !common.IsProduction() && len(ctx.Errors) > 0 {
+		_, err = io.WriteString(page, InjectErrorOverlay(buffered.String(), ctx.Errors))
+		return err
+	}
+	_, err = buffered.WriteTo(page)
+	return err
+}
+
+// PageWriter sends a rendered page to the client. The headers of the page go out with the first write
+// so tags that redirect before any output, such as restricted-by-role, can still set their own status
+type PageWriter struct {
+	w       http.ResponseWriter
+	site    *structure.SiteStructure
+	started bool
+}
+
+func NewPageWriter(w http.ResponseWriter, site *structure.SiteStructure) *PageWriter {
+	return &PageWriter{w: w, site: site}
+}
+
+func (page *PageWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if !page.started {
+		page.started = true
+		page.w.Header().Set("Content-Type", "text/html")
+		if page.site.Config.Cache.Pages != "" {
+			page.w.Header().Set("Cache-Control", page.site.Config.Cache.Pages)
+		}
+		page.w.WriteHeader(http.StatusOK)
+	}
+	return page.w.Write(p)
+}
+
+// Started reports whether the response has been sent
+func (page *PageWriter) Started() bool {
+	return page.started
+}
+
+// ErrorPagesDir holds the error pages of a site in its pages folder, "pages/_errors/404.hstm" answers missing routes.
+// Pages in it are not routes of the site
+const ErrorPagesDir = "_errors"
+
+// WriteErrorPage answers a request with an error status, rendering the error page of the site in place with an .Error.
+// The page is the template of the status in error_pages, else pages/_errors/<status>.hstm, else the engine's
+// StrictErrorPage for a 500, else a built-in page. Outside of production the error overlay is added to the response
+func WriteErrorPage(ctx *structure.RenderCtx, w http.ResponseWriter, status int, err error) {
+	page := ""
+	if errorPagePath, ok := errorPageTemplate(ctx, status); ok {
+		page = renderErrorPage(ctx, errorPagePath, status, err)
+	}
+	if page == "" {
+		page = fallbackErrorPage(status, err)
+	}
+	if !common.IsProduction() && len(ctx.Errors) > 0 {
+		page = InjectErrorOverlay(page, ctx.Errors)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	io.WriteString(w, page)
+}
+
+// errorPageTemplate returns the path of the error page of a status
+func errorPageTemplate(ctx *structure.RenderCtx, status int) (string, bool) {
+	if errorPage, ok := ctx.Site.Config.ErrorPage(status); ok && errorPage != "" {
+		return filepath.Join(ctx.ScopedDirectory, errorPage), true
+	}
+	sitePage := filepath.Join(ctx.ScopedDirectory, "pages", ErrorPagesDir, strconv.Itoa(status)+ctx.Engine.FILE_EXT)
+	if info, err := os.Stat(sitePage); err == nil && !info.IsDir() {
+		return sitePage, true
+	}
+	if status == http.StatusInternalServerError && ctx.Engine.StrictErrorPage != "" {
+		return filepath.Join(ctx.ScopedDirectory, ctx.Engine.StrictErrorPage), true
+	}
+	return "", false
+}
+
+// renderErrorPage renders an error page in the root layout with a fresh context, so nothing of the failed page
+// such as its title or assets ends up in it. Returns "" when the error page fails too
+func renderErrorPage(ctx *structure.RenderCtx, errorPagePath string, status int, err error) string {
+	errorTemplate, loadErr := core.LoadTemplate(ctx.Engine, ctx.Site.Domain, errorPagePath)
+	if loadErr != nil {
+		slog.Error("Failed to read error page", "path", errorPagePath, "error", loadErr)
+		return ""
+	}
+	data := map[string]any{
+		"Site":  siteData(ctx.Site, cmp.Or(ctx.Locale, ctx.Site.Config.DefaultLocale)),
+		"Error": errorData(err, status),
+	}
+	if ctx.Request != nil {
+		data["Error"].(map[string]any)["RequestPath"] = ctx.Request.URL.Path
+	}
+	errCtx := ctx.Engine.InitCtx(ctx.ScopedDirectory, ctx.Site, data)
+	errCtx.Request, errCtx.ResponseWriter = ctx.Request, ctx.ResponseWriter
+	errCtx.UserID, errCtx.UserRoles, errCtx.UsersDB = ctx.UserID, ctx.UserRoles, ctx.UsersDB
+	errCtx.CSRFToken = ctx.CSRFToken
+	errCtx.CurrentTemplatePath = filepath.Dir(errorPagePath)
+
+	var output strings.Builder
+	renderErrs, renderErr := renderWithRootLayout(errCtx, &output, errorTemplate)
+	if renderErr != nil {
+		renderErrs = append(renderErrs, renderErr)
+	}
+	if len(renderErrs) > 0 || errCtx.Halted {
+		slog.Error("Failed to render error page", "path", errorPagePath, "error", errors.Join(renderErrs...))
+		return ""
+	}
+	return output.String()
+}
+
+// fallbackErrorPage is the built-in page of sites without an error page for a status
+func fallbackErrorPage(status int, err error) string {
+	title := strconv.Itoa(status) + " " + http.StatusText(status)
+	detail := ""
+	// errors may name files of the server, they are only shown while developing
+	if !common.IsProduction() && err != nil {
+		detail = "<p>" + html.EscapeString(err.Error()) + "</p>"
+	}
+	return "<!DOCTYPE html><html><head><title>" + title + "</title></head><body><h1>" + title + "</h1>" + detail + "</body></html>"
+}
+
+// errorData exposes an error to templates as .Error, with its status as Code and Status.
+// Errors may name files of the server, in production Message is the status text and the error is left out
+func errorData(err error, status int) map[string]any {
+	data := map[string]any{
+		"Code":    status,
+		"Status":  status,
+		"Message": http.StatusText(status),
+	}
+	if common.IsProduction() {
+		return data
+	}
+	if err != nil {
+		data["Message"] = err.Error()
+	}
+	if te, ok := err.(*structure.TemplateError); ok {
+		if te.Err != nil {
+			data["Message"] = te.Err.Error()
+		}
+		data["Path"] = te.Path
+		data["Line"] = te.Line
+		data["Column"] = te.Column
+		data["Tag"] = te.Tag
+		data["Snippet"] = te.Snippet
+	}
+	return data
 }
 
-// SetupWispyCache ensures the .wispy cache directory exists.
+// SetupWispyCache ensures the .wispy cache directory exists, pages cached with disk = true are kept in .wispy/pages.
 func SetupWispyCache() {
 	cacheDir := ".wispy"
 	if _, err := os.Stat(cacheDir); os.IsNotExist(err) {
@@ -0,0 +1,110 @@
+package template
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// renderTestRoute renders a route of a site built by buildTestSite into out
+func renderTestRoute(t *testing.T, engine *structure.TemplateEngine, domain, requestPath string, out io.Writer) (*structure.RenderCtx, error) {
+	t.Helper()
+	site, ok := engine.Sites.Get(domain)
+	if !ok {
+		t.Fatalf("site %s was not built", domain)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://"+domain+requestPath, nil)
+	data := map[string]any{}
+	ctx := engine.InitCtx(filepath.Join(engine.SITES_DIR, domain), site, data)
+	err := RenderRoute(engine, ctx, out, requestPath, data, httptest.NewRecorder(), req)
+	return ctx, err
+}
+
+// The page is sent as soon as it is done, the rest of the root layout streams after it
+func TestRenderStreamsAfterPage(t *testing.T) {
+	engine := buildTestSite(t, "example.com", map[string]string{
+		"config.toml":       `domain = "example.com"`,
+		"layouts/root.hstm": `<html><head>{% root-head %}{% root-css %}</head><body>{% passed %}<footer>{% "" | probe %}</footer>{% root-js %}</body></html>`,
+		"layouts/main.hstm": `<main>{% passed %}</main>`,
+		"pages/page.hstm":   `{% layout "main" %}<h1>home</h1>{% css %}h1{color:red}{% end-css %}`,
+	})
+	var out strings.Builder
+	var sentBeforeFooter string
+	engine.FilterMap["probe"] = structure.TemplateFilter{
+		Name: "probe",
+		Handler: func(pipedValue any, args []any) (any, error) {
+			sentBeforeFooter = out.String()
+			return "", nil
+		},
+	}
+
+	if _, err := renderTestRoute(t, engine, "example.com", "/", &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(sentBeforeFooter, "<body><main><h1>home</h1></main><footer>") {
+		t.Errorf("sent before the footer rendered = %q, want the page up to the footer", sentBeforeFooter)
+	}
+	if !strings.Contains(sentBeforeFooter, "h1{color:red}") {
+		t.Errorf("root-css sent without the CSS of the page: %q", sentBeforeFooter)
+	}
+	if !strings.HasSuffix(out.String(), "<footer></footer></body></html>") {
+		t.Errorf("page = %q", out.String())
+	}
+}
+
+// A page that halts with a status sends nothing so the error page can be served in its place
+func TestRenderHaltSendsNothing(t *testing.T) {
+	engine := buildTestSite(t, "example.com", map[string]string{
+		"config.toml":       `domain = "example.com"`,
+		"layouts/root.hstm": `<html><head>{% root-head %}</head><body>{% passed %}</body></html>`,
+		"pages/page.hstm":   `<p>before</p>{% deny %}<p>after</p>`,
+	})
+	engine.TagMap["deny"] = structure.TemplateTag{
+		Name: "deny",
+		Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) []error {
+			ctx.Status = http.StatusUnauthorized
+			ctx.Halted = true
+			return nil
+		},
+	}
+
+	var out strings.Builder
+	_, err := renderTestRoute(t, engine, "example.com", "/", &out)
+	var statusErr *structure.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Status != http.StatusUnauthorized {
+		t.Fatalf("RenderRoute error = %v, want status 401", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("halted page sent %q", out.String())
+	}
+}
+
+func TestErrorData(t *testing.T) {
+	tmpl := &structure.Template{Path: "/sites/example.com/pages/page.hstm", Source: "{% .missing %}"}
+	templateErr := structure.NewTemplateError(tmpl, 0, "", errors.New("undefined variable"))
+
+	t.Setenv("ENV", "development")
+	data := errorData(templateErr, http.StatusInternalServerError)
+	if data["Message"] != "undefined variable" || data["Path"] != tmpl.Path || data["Line"] != 1 {
+		t.Errorf("errorData while developing = %v", data)
+	}
+
+	// errors may name files of the server, production only shows the status
+	t.Setenv("ENV", "production")
+	data = errorData(templateErr, http.StatusInternalServerError)
+	want := map[string]any{"Code": 500, "Status": 500, "Message": "Internal Server Error"}
+	if len(data) != len(want) {
+		t.Errorf("errorData in production = %v, want %v", data, want)
+	}
+	for key, value := range want {
+		if data[key] != value {
+			t.Errorf("errorData in production %s = %v, want %v", key, data[key], value)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package template
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// Kinds of route segments in order of precedence, static segments win over parameters and parameters over catch-alls
+const (
+	segmentStatic = iota
+	segmentParam
+	segmentCatchAll
+)
+
+var routeParamName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// parseSegment reads "name", "[slug]" or "[...path]"
+func parseSegment(segment string) (kind int, name string) {
+	inner, ok := strings.CutPrefix(segment, "[")
+	if !ok {
+		return segmentStatic, segment
+	}
+	inner, ok = strings.CutSuffix(inner, "]")
+	if !ok {
+		return segmentStatic, segment
+	}
+	if rest, catchAll := strings.CutPrefix(inner, "..."); catchAll {
+		return segmentCatchAll, rest
+	}
+	return segmentParam, inner
+}
+
+// routePattern splits a page name such as "blog/[slug]" into segments, static page names return nil
+func routePattern(pageName string) ([]string, error) {
+	if !strings.Contains(pageName, "[") {
+		return nil, nil
+	}
+	segments := strings.Split(pageName, "/")
+	seen := map[string]bool{}
+	for i, segment := range segments {
+		kind, name := parseSegment(segment)
+		if kind == segmentStatic {
+			continue
+		}
+		if !routeParamName.MatchString(name) {
+			return nil, fmt.Errorf("invalid route parameter %q in %q", segment, pageName)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("route parameter %q is used more than once in %q", name, pageName)
+		}
+		seen[name] = true
+		if kind == segmentCatchAll && i != len(segments)-1 {
+			return nil, fmt.Errorf("catch-all %q must be the last segment of %q", segment, pageName)
+		}
+	}
+	return segments, nil
+}
+
+// sortDynamicRoutes returns the keys of the dynamic routes in match order.
+// Segments are compared from the left, static before parameter before catch-all, remaining ties are broken by key
+func sortDynamicRoutes(routes map[string]structure.PageRoutes) []string {
+	var keys []string
+	for key, route := range routes {
+		if route.Pattern != nil {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		pa, pb := routes[a].Pattern, routes[b].Pattern
+		for i := range min(len(pa), len(pb)) {
+			ka, _ := parseSegment(pa[i])
+			kb, _ := parseSegment(pb[i])
+			if ka != kb {
+				return ka - kb
+			}
+		}
+		if len(pa) != len(pb) {
+			return len(pb) - len(pa)
+		}
+		return strings.Compare(a, b)
+	})
+	return keys
+}
+
+// MatchRoute finds the route of a request path. Static routes take precedence, then the entries of content collections,
+// then dynamic routes are tried in site.DynamicRoutes order and their values returned as params
+func MatchRoute(site *structure.SiteStructure, requestPath string) (route structure.PageRoutes, params map[string]any, ok bool) {
+	// dynamic routes are keyed by their page name, a request for "/blog/[slug]" matches them through their pattern
+	if route, ok := site.Routes[site.Domain+requestPath]; ok && route.Pattern == nil {
+		return route, map[string]any{}, true
+	}
+
+	trimmed := strings.Trim(requestPath, "/")
+	var parts []string
+	if trimmed != "" {
+		parts = strings.Split(trimmed, "/")
+	}
+	if route, params, ok := matchContentRoute(site, parts); ok {
+		return route, params, true
+	}
+	for _, key := range site.DynamicRoutes {
+		route := site.Routes[key]
+		if params, ok := matchPattern(route.Pattern, parts); ok {
+			return route, params, true
+		}
+	}
+	return structure.PageRoutes{}, nil, false
+}
+
+// matchPattern matches path segments against a route pattern, a catch-all takes at least one segment
+func matchPattern(pattern, parts []string) (map[string]any, bool) {
+	params := map[string]any{}
+	for i, segment := range pattern {
+		kind, name := parseSegment(segment)
+		if kind == segmentCatchAll {
+			if i >= len(parts) {
+				return nil, false
+			}
+			params[name] = strings.Join(parts[i:], "/")
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		switch kind {
+		case segmentStatic:
+			if parts[i] != segment {
+				return nil, false
+			}
+		case segmentParam:
+			params[name] = parts[i]
+		}
+	}
+	if len(parts) != len(pattern) {
+		return nil, false
+	}
+	return params, true
+}
+
+// RouteMatches reports whether a request path matches one of the route patterns of a site config,
+// such as "/account" or "/blog/*" (see path.Match)
+func RouteMatches(patterns []string, requestPath string) bool {
+	route := "/" + strings.Trim(requestPath, "/")
+	for _, pattern := range patterns {
+		if matched, _ := path.Match("/"+strings.Trim(pattern, "/"), route); matched {
+			return true
+		}
+	}
+	return false
+}
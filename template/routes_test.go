@@ -0,0 +1,116 @@
+package template
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// testRouteSite builds a site with a route for each page name
+func testRouteSite(t *testing.T, pageNames ...string) *structure.SiteStructure {
+	t.Helper()
+	site := NewSiteStructure("example.com")
+	for _, name := range pageNames {
+		pattern, err := routePattern(name)
+		if err != nil {
+			t.Fatalf("routePattern(%q): %v", name, err)
+		}
+		site.Routes[site.Domain+"/"+name] = structure.PageRoutes{Name: name, Pattern: pattern}
+	}
+	site.DynamicRoutes = sortDynamicRoutes(site.Routes)
+	return &site
+}
+
+func TestMatchRoute(t *testing.T) {
+	site := testRouteSite(t,
+		"",
+		"about",
+		"blog",
+		"blog/new",
+		"blog/[slug]",
+		"blog/[slug]/comments",
+		"blog/[year]/[slug]",
+		"docs/[...path]",
+		"[lang]/about",
+	)
+	tests := []struct {
+		path   string
+		want   string
+		params map[string]any
+	}{
+		{"/", "", map[string]any{}},
+		{"/about", "about", map[string]any{}},
+		{"/blog", "blog", map[string]any{}},
+		// static segments win over parameters
+		{"/blog/new", "blog/new", map[string]any{}},
+		{"/blog/hello", "blog/[slug]", map[string]any{"slug": "hello"}},
+		{"/blog/hello/", "blog/[slug]", map[string]any{"slug": "hello"}},
+		{"/blog/hello/comments", "blog/[slug]/comments", map[string]any{"slug": "hello"}},
+		{"/blog/2024/hello", "blog/[year]/[slug]", map[string]any{"year": "2024", "slug": "hello"}},
+		{"/docs/a", "docs/[...path]", map[string]any{"path": "a"}},
+		{"/docs/a/b/c", "docs/[...path]", map[string]any{"path": "a/b/c"}},
+		{"/fr/about", "[lang]/about", map[string]any{"lang": "fr"}},
+		// a static first segment wins over the parameter of [lang]/about
+		{"/blog/about", "blog/[slug]", map[string]any{"slug": "about"}},
+		// the page names of dynamic routes are not static paths, their values are the literal segments
+		{"/blog/[slug]", "blog/[slug]", map[string]any{"slug": "[slug]"}},
+		{"/docs/[...path]", "docs/[...path]", map[string]any{"path": "[...path]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			route, params, ok := MatchRoute(site, tt.path)
+			if !ok {
+				t.Fatalf("MatchRoute(%q) found no route, want %q", tt.path, tt.want)
+			}
+			if route.Name != tt.want || !maps.Equal(params, tt.params) {
+				t.Errorf("MatchRoute(%q) = %q %v, want %q %v", tt.path, route.Name, params, tt.want, tt.params)
+			}
+		})
+	}
+
+	for _, path := range []string{"/missing", "/docs", "/blog/a/b/c/d", "/about/more"} {
+		if route, _, ok := MatchRoute(site, path); ok {
+			t.Errorf("MatchRoute(%q) = %q, want no route", path, route.Name)
+		}
+	}
+}
+
+func TestSortDynamicRoutes(t *testing.T) {
+	site := testRouteSite(t, "[a]/[b]", "x/[b]", "[...all]", "x/y", "[a]/y", "x/[...rest]")
+	want := []string{"example.com/x/[b]", "example.com/x/[...rest]", "example.com/[a]/y", "example.com/[a]/[b]", "example.com/[...all]"}
+	if !slices.Equal(site.DynamicRoutes, want) {
+		t.Errorf("DynamicRoutes = %v, want %v", site.DynamicRoutes, want)
+	}
+}
+
+func TestRoutePatternErrors(t *testing.T) {
+	for _, name := range []string{"blog/[slug]/[slug]", "docs/[...path]/edit", "blog/[bad name]", "blog/[]"} {
+		if _, err := routePattern(name); err == nil {
+			t.Errorf("routePattern(%q) succeeded, want an error", name)
+		}
+	}
+}
+
+func TestRouteMatches(t *testing.T) {
+	patterns := []string{"/account", "/blog/*", "admin/"}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/account", true},
+		{"/account/", true},
+		{"/account/settings", false},
+		{"/blog/post", true},
+		{"/blog", false},
+		{"/blog/a/b", false},
+		{"/admin", true},
+		{"/", false},
+	}
+	for _, tt := range tests {
+		if got := RouteMatches(patterns, tt.path); got != tt.want {
+			t.Errorf("RouteMatches(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package template
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// LoadSiteConfig reads and validates the config.toml of a site folder.
+// Unknown keys, invalid values and missing layouts or error pages are reported, the config holds every valid setting
+func LoadSiteConfig(engine *structure.TemplateEngine, siteFolderPath string) (config structure.SiteConfig, errs []error) {
+	configFilePath := filepath.Join(siteFolderPath, engine.SITE_CONFIG_NAME)
+	configBytes, err := os.ReadFile(configFilePath)
+	if err != nil {
+		config.Defaults()
+		return config, append(errs, err)
+	}
+
+	meta, err := toml.Decode(string(configBytes), &config)
+	config.Defaults()
+	if err != nil {
+		return config, append(errs, fmt.Errorf("%s: %w", configFilePath, err))
+	}
+	for _, key := range meta.Undecoded() {
+		errs = append(errs, fmt.Errorf("%s: unknown key %q", configFilePath, key.String()))
+	}
+	for _, err := range config.Validate(filepath.Base(siteFolderPath)) {
+		errs = append(errs, fmt.Errorf("%s: %w", configFilePath, err))
+	}
+
+	// templates named by the config must exist
+	layouts := [][2]string{{"default_layout", config.DefaultLayout}, {"root_layout", config.RootLayout}}
+	for _, layout := range layouts {
+		if layout[1] != "" && !templateExists(filepath.Join(siteFolderPath, "layouts", layout[1])) {
+			errs = append(errs, fmt.Errorf("%s: %s: layout %q not found in %s", configFilePath, layout[0], layout[1], filepath.Join(siteFolderPath, "layouts")))
+		}
+	}
+	for _, status := range slices.Sorted(maps.Keys(config.ErrorPages)) {
+		page := config.ErrorPages[status]
+		if page != "" && !templateExists(filepath.Join(siteFolderPath, strings.TrimSuffix(page, engine.FILE_EXT))) {
+			errs = append(errs, fmt.Errorf("%s: error_pages: %s template %q not found", configFilePath, status, page))
+		}
+	}
+	return config, errs
+}
+
+// templateExists reports whether "name.hstm" or "name/index.hstm" exists
+func templateExists(name string) bool {
+	for _, candidate := range []string{name + ".hstm", filepath.Join(name, "index.hstm")} {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package tags
 
 import (
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/kato-studio/wispy/template/core"
@@ -10,36 +11,37 @@ import (
 
 var AssignTag = TemplateTag{
 	Name: "assign",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (new_pos int, errs []error) {
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
+		tag_contents := node.Content
 		parts := strings.SplitN(tag_contents, "=", 2)
 		if len(parts) != 2 {
 			errs = append(errs, fmt.Errorf("invalid assign syntax: expected '{VAR} = {VALUE}', got %q", tag_contents))
-			return pos, errs
+			return errs
 		}
 
 		variable := strings.TrimSpace(parts[0])
 		valueExpr := strings.TrimSpace(parts[1])
 
-		var value any
-		var err error
-		// Resolve the value to be assigned from string expression
-		value, err = core.ResolveValue(ctx, valueExpr)
-
-		if err != nil {
+		// Resolve the value to be assigned from the expression, e.g. "{% assign total = .price * .qty %}"
+		value, valueErrs := core.EvaluateExpression(ctx, valueExpr)
+		for _, err := range valueErrs {
 			errs = append(errs, fmt.Errorf("could not resolve value for assignment: %v", err))
-			return pos, errs
 		}
 
 		if variable[0] == '.' {
 			path := strings.Split(strings.TrimPrefix(variable, "."), ".")
-			err := insertNestedValue(ctx.Data, path, value)
+			// the value of an enclosing scope is copied into the current one so the assignment ends with the scope
+			current, _ := ctx.Lookup(path[0])
+			updated, err := setNestedValue(current, path[0], path[1:], value)
 			if err != nil {
 				errs = append(errs, fmt.Errorf("failed to set nested value: %v", err))
+			} else {
+				ctx.Data[path[0]] = updated
 			}
 		} else {
 			ctx.Data[variable] = value
 		}
 
-		return pos, errs
+		return errs
 	},
 }
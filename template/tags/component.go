@@ -0,0 +1,118 @@
+package tags
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kato-studio/wispy/template/core"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// name of the slot holding component content outside of "slot" tags
+const defaultSlot = "default"
+
+// ComponentTag renders a partial with props and slots.
+//
+//	{% component "button" variant="primary" %}
+//		{% slot icon %}<svg>...</svg>{% end-slot %}
+//		Save
+//	{% end-component %}
+//
+// Arguments work like the partial tag, slots only exist while this invocation is rendered
+// and their content renders with the data of the template that passed it.
+var ComponentTag = TemplateTag{
+	Name: "component",
+	Kind: structure.KindBlock,
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
+		args, err := core.ParseTagArgs(node.Content)
+		if err != nil {
+			return append(errs, fmt.Errorf("component %w", err))
+		}
+		componentName := args.Name()
+		if componentName == "" {
+			return append(errs, fmt.Errorf("component tag is missing the component name"))
+		}
+		for _, extra := range args.Positional[1:] {
+			if extra != "only" {
+				errs = append(errs, fmt.Errorf("component %q has an unexpected argument %q, expected name=value", componentName, extra))
+			}
+		}
+
+		componentTemplate, err := loadPartial(ctx, componentName)
+		if err != nil {
+			return append(errs, err)
+		}
+
+		props, propErrs := args.Props(ctx)
+		if len(propErrs) > 0 {
+			errs = append(errs, propErrs...)
+		}
+
+		// Named slots and everything else as the default slot, captured with the caller's scope
+		caller := ctx.CurrentScope()
+		slots := make(map[string]*structure.Slot)
+		var content []*structure.Node
+		for _, child := range node.Children {
+			if child.Type == structure.TagNode && child.Name == SlotTag.Name {
+				slotName := strings.Trim(child.Content, " \"'")
+				if slotName == "" {
+					errs = append(errs, fmt.Errorf("slot tag in component %q is missing the slot name", componentName))
+					continue
+				}
+				slots[slotName] = &structure.Slot{Nodes: child.Children, Scope: caller}
+				continue
+			}
+			content = append(content, child)
+		}
+		if hasContent(content) {
+			slots[defaultSlot] = &structure.Slot{Nodes: content, Scope: caller}
+		}
+
+		defer ctx.RestoreScope(caller)
+		ctx.Props = props
+		ctx.Slots = slots
+		if args.Has("only") {
+			ctx.ResetData(make(map[string]any))
+		}
+		// Update for use in asset imports
+		ctx.CurrentTemplatePath = componentTemplate.Path
+
+		return append(errs, core.ExecuteTemplate(ctx, w, componentTemplate)...)
+	},
+	Lint: lintPartialName,
+}
+
+// RenderSlotTag writes a slot passed to the component or parent template, "{% render-slot icon %}".
+// Without a name the default slot is written, content up to "{% end-render-slot %}" is the fallback
+// used when the slot was not passed
+var RenderSlotTag = TemplateTag{
+	Name: "render-slot",
+	Kind: structure.KindOptional,
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
+		slotName := strings.Trim(node.Content, " \"'")
+		if slotName == "" {
+			slotName = defaultSlot
+		}
+
+		slot, ok := ctx.Slots[slotName]
+		if !ok {
+			return core.Execute(ctx, w, node.Children)
+		}
+
+		// Slot content renders in the scope it was written in
+		defer ctx.RestoreScope(ctx.CurrentScope())
+		ctx.RestoreScope(slot.Scope)
+		return core.Execute(ctx, w, slot.Nodes)
+	},
+}
+
+// hasContent reports whether nodes hold anything besides whitespace
+func hasContent(nodes []*structure.Node) bool {
+	for _, node := range nodes {
+		if node.Type != structure.TextNode || strings.TrimSpace(node.Content) != "" {
+			return true
+		}
+	}
+	return false
+}
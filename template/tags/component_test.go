@@ -0,0 +1,45 @@
+package tags_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+func TestComponentSlots(t *testing.T) {
+	partials := map[string]string{
+		"button":   `<button class="{% .variant %}">{% render-slot icon %}{% render-slot %}</button>`,
+		"fallback": `<p>{% render-slot %}empty{% end-render-slot %}|{% render-slot note %}no note{% end-render-slot %}</p>`,
+		"inner":    `<i>{% render-slot %}</i>`,
+	}
+	tests := []struct {
+		name    string
+		src     string
+		want    string
+		wantErr bool
+	}{
+		{"default slot", `{% component "button" variant="primary" %}Save{% end-component %}`, `<button class="primary">Save</button>`, false},
+		{"named slot", `{% component "button" variant="a" %}{% slot icon %}<svg/>{% end-slot %}Save{% end-component %}`, `<button class="a"><svg/>Save</button>`, false},
+		{"quoted slot name", `{% component "button" variant="a" %}{% slot "icon" %}*{% end-slot %}{% end-component %}`, `<button class="a">*</button>`, false},
+		{"fallbacks", `{% component "fallback" %}{% end-component %}`, `<p>empty|no note</p>`, false},
+		{"whitespace is no default slot", "{% component \"fallback\" %}\n\t{% slot note %}n{% end-slot %}\n{% end-component %}", `<p>empty|n</p>`, false},
+		{"passed slots replace fallbacks", `{% component "fallback" %}{% slot note %}n{% end-slot %}body{% end-component %}`, `<p>body|n</p>`, false},
+		{"slot content uses caller data", `{% component "button" variant="x" %}{% .name %}{% end-component %}`, `<button class="x">Ann</button>`, false},
+		{"slots end with the component", `{% component "inner" %}a{% end-component %}{% render-slot %}none{% end-render-slot %}`, `<i>a</i>none`, false},
+		{"nested components", `{% component "inner" %}{% component "inner" %}b{% end-component %}{% end-component %}`, `<i><i>b</i></i>`, false},
+		{"missing slot name", `{% component "inner" %}{% slot %}x{% end-slot %}{% end-component %}`, `<i></i>`, true},
+		{"missing component", `{% component "nope" %}x{% end-component %}!`, "!", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, errs := renderSite(t, structure.UndefinedLenient, partials, tt.src, map[string]any{"name": "Ann"})
+			if (len(errs) > 0) != tt.wantErr {
+				t.Errorf("Render(%q) errors = %v, want errors: %v", tt.src, errs, tt.wantErr)
+			}
+			if strings.TrimSpace(got) != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
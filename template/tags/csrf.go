@@ -0,0 +1,41 @@
+package tags
+
+import (
+	"errors"
+	"html"
+	"io"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// CSRFFieldName is the form field holding the CSRF token, checked by the csrf stage of wispy.Server
+const CSRFFieldName = "csrf_token"
+
+var errNoCSRFToken = errors.New("no CSRF token for this request, it is set by the csrf stage of wispy.Server")
+
+// "csrf-field" writes a hidden input with the CSRF token of the visitor for forms sent back to the site.
+// The page is not cached as the token differs per visitor
+var CSRFFieldTag = TemplateTag{
+	Name: "csrf-field",
+	Render: func(ctx *structure.RenderCtx, w io.Writer, _ *structure.Node) []error {
+		if ctx.CSRFToken == "" {
+			return []error{errNoCSRFToken}
+		}
+		ctx.Private = true
+		io.WriteString(w, `<input type="hidden" name="`+CSRFFieldName+`" value="`+html.EscapeString(ctx.CSRFToken)+`">`)
+		return nil
+	},
+}
+
+// "csrf-token" writes the bare CSRF token, such as for a meta tag read by scripts sending the X-CSRF-Token header
+var CSRFTokenTag = TemplateTag{
+	Name: "csrf-token",
+	Render: func(ctx *structure.RenderCtx, w io.Writer, _ *structure.Node) []error {
+		if ctx.CSRFToken == "" {
+			return []error{errNoCSRFToken}
+		}
+		ctx.Private = true
+		io.WriteString(w, html.EscapeString(ctx.CSRFToken))
+		return nil
+	},
+}
@@ -1,7 +1,7 @@
 package tags
 
 import (
-	"fmt"
+	"io"
 	"strconv"
 	"strings"
 
@@ -11,19 +11,12 @@ import (
 // Block-style CSS tag
 var CSSTag = TemplateTag{
 	Name: "css",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (int, []error) {
-		options := parseAssetTagOptions(tag_contents)
-
-		// Find closing tag
-		closingTag := delimWrap(ctx, "end-css")
-		closingPos := strings.Index(raw[pos:], closingTag)
-		if closingPos == -1 {
-			return pos, []error{fmt.Errorf("missing closing endcss tag")}
-		}
-		closingPos += pos
+	Kind: structure.KindRaw,
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) []error {
+		options := parseAssetTagOptions(node.Content)
 
 		// Get content between tags
-		content := strings.TrimSpace(raw[pos:closingPos])
+		content := strings.TrimSpace(rawBody(node))
 		content = strings.TrimPrefix(content, "<style>")
 		content = strings.TrimSuffix(content, "</style>")
 
@@ -37,24 +30,18 @@ var CSSTag = TemplateTag{
 			Media:    options["media"],
 		})
 
-		return closingPos + len(closingTag), nil
+		return nil
 	},
 }
 
 // Block-style JS tag
 var JSTag = TemplateTag{
 	Name: "js",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (int, []error) {
-		options := parseAssetTagOptions(tag_contents)
-
-		closingTag := delimWrap(ctx, "end-js")
-		closingPos := strings.Index(raw[pos:], closingTag)
-		if closingPos == -1 {
-			return pos, []error{fmt.Errorf("missing closing endjs tag")}
-		}
-		closingPos += pos
+	Kind: structure.KindRaw,
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) []error {
+		options := parseAssetTagOptions(node.Content)
 
-		content := strings.TrimSpace(raw[pos:closingPos])
+		content := strings.TrimSpace(rawBody(node))
 		content = strings.TrimPrefix(content, "<script>")
 		content = strings.TrimSuffix(content, "</script>")
 
@@ -67,6 +54,6 @@ var JSTag = TemplateTag{
 			Module:   options["module"] == "true",
 		})
 
-		return closingPos + len(closingTag), nil
+		return nil
 	},
 }
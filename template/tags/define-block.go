@@ -2,6 +2,7 @@ package tags
 
 import (
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/kato-studio/wispy/template/core"
@@ -11,78 +12,67 @@ import (
 // DefineTag allows defining a named block of content that can be overridden by extending templates
 var DefineTag = TemplateTag{
 	Name: "define",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (new_pos int, errs []error) {
+	Kind: structure.KindBlock,
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
 		// Extract the block name from the tag contents
-		blockName := strings.TrimSpace(tag_contents)
+		blockName := strings.TrimSpace(node.Content)
 		if blockName == "" {
 			errs = append(errs, fmt.Errorf("define tag is missing the block name"))
-			return pos, errs
+			return errs
 		}
 
-		// Find the closing tag
-		closingTag := delimWrap(ctx, "end-define")
-		closingPos := strings.Index(raw[pos:], closingTag)
-		if closingPos == -1 {
-			errs = append(errs, fmt.Errorf("define tag missing closing enddefine"))
-			return pos, errs
-		}
-		closingPos += pos
-
-		// Get the content between the define tags
-		content := raw[pos:closingPos]
-
 		// Store the defined block in the context
 		if ctx.Blocks == nil {
-			ctx.Blocks = make(map[string]string)
+			ctx.Blocks = make(map[string][]*structure.Node)
 		}
-		ctx.Blocks[blockName] = content
+		ctx.Blocks[blockName] = node.Children
 
-		// Return position after the closing tag
-		return closingPos + len(closingTag), errs
+		return errs
+	},
+	Lint: func(ctx *structure.RenderCtx, node *structure.Node) (errs []error) {
+		blockName := strings.TrimSpace(node.Content)
+		if blockName == "" {
+			return append(errs, fmt.Errorf("define tag is missing the block name"))
+		}
+		// a later define silently replaces an earlier one with the same name
+		if _, exists := ctx.Blocks[blockName]; exists {
+			return append(errs, fmt.Errorf("block %q is defined more than once", blockName))
+		}
+		ctx.Blocks[blockName] = node.Children
+		return errs
 	},
 }
 
 // BlockTag represents a block that can be overridden by extending templates
 var BlockTag = TemplateTag{
 	Name: "block",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (new_pos int, errs []error) {
+	Kind: structure.KindBlock,
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
 		// Extract the block name from the tag contents
-		blockName := strings.TrimSpace(tag_contents)
+		blockName := strings.TrimSpace(node.Content)
 		if blockName == "" {
 			errs = append(errs, fmt.Errorf("block tag is missing the block name"))
-			return pos, errs
+			return errs
 		}
 
-		// Find the closing tag
-		closingTag := delimWrap(ctx, "end-block")
-		closingPos := strings.Index(raw[pos:], closingTag)
-		if closingPos == -1 {
-			errs = append(errs, fmt.Errorf("block tag missing closing endblock"))
-			return pos, errs
-		}
-		closingPos += pos
-
-		// Get the default content between the block tags
-		defaultContent := raw[pos:closingPos]
-
 		// If this block is being extended, the extended content will be in ctx.Blocks
 		if ctx.Blocks != nil {
 			if extendedContent, exists := ctx.Blocks[blockName]; exists {
 				// Render the extended content
-				renderErrs := core.Render(ctx, sb, extendedContent)
+				renderErrs := core.Execute(ctx, w, extendedContent)
 				if len(renderErrs) > 0 {
 					errs = append(errs, renderErrs...)
 				}
-				return closingPos + len(closingTag), errs
+				return errs
 			}
 		}
 
 		// Otherwise render the default content
-		renderErrs := core.Render(ctx, sb, defaultContent)
+		renderErrs := core.Execute(ctx, w, node.Children)
 		if len(renderErrs) > 0 {
 			errs = append(errs, renderErrs...)
 		}
 
-		return closingPos + len(closingTag), errs
+		return errs
 	},
 }
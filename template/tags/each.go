@@ -2,90 +2,260 @@ package tags
 
 import (
 	"fmt"
-	"maps"
+	"io"
+	"math"
 	"reflect"
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/kato-studio/wispy/template/core"
 	"github.com/kato-studio/wispy/wispy_common/structure"
 )
 
-// Render
+// Modifiers that may follow the collection, "{% each post in .posts limit:3 offset:1 reversed %}"
+var eachModifier = regexp.MustCompile(`\s+(?:(limit|offset)\s*:\s*(\S+)|(reversed))$`)
+
+var loopVariable = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// loopEntry is a single iteration, the key is the index for lists and the key for maps
+type loopEntry struct {
+	key   any
+	value any
+}
+
+// Each renders its body once per item of a list, map or range.
+//
+//	{% each item in .list %}
+//	{% each key, value in .map %} (map keys are sorted)
+//	{% each i in range 1..10 %}
+//	{% each post in .posts limit:3 offset:1 reversed %}
+//
+// A "loop" variable holds index, index0, first, last, length and the parent loop,
+// "{% else %}" renders when there is nothing to iterate.
 var EachTag = TemplateTag{
-	Name: "each",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (new_pos int, errs []error) {
-		endTag := delimWrap(ctx, "end-each")
-		openingOfTag := ctx.Engine.DelimStart + " each "
-		endTagStart, endTagLength := core.SeekClosingHandleNested(raw, endTag, openingOfTag, pos)
-		if endTagStart == -1 {
-			errs = append(errs, fmt.Errorf("could not find end tag %q", endTag))
-			return pos, errs
-		}
-		newEndPos := endTagStart + endTagLength
+	Name:    "each",
+	Kind:    structure.KindBlock,
+	Clauses: []string{"else"},
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
+		tag_contents := node.Content
 		//
 		// Parse loop variables and collection path
 		parts := strings.SplitN(tag_contents, " in ", 2)
 		if len(parts) != 2 {
 			errs = append(errs, fmt.Errorf("invalid each syntax: expected '{VAR} in {ARRAY}', got %q", tag_contents))
-			return newEndPos, errs
+			return errs
 		}
 		//
-		loopVar := strings.TrimSpace(parts[0])
-		//
-		collectionPath := strings.TrimSpace(parts[1])
-		//
-		collection, varErr := core.ResolveVariable(ctx, collectionPath)
-		if varErr != nil {
-			errs = append(errs, varErr)
+		keyVar, valueVar, err := parseLoopVariables(parts[0])
+		if err != nil {
+			return append(errs, err)
 		}
-
-		collValue := reflect.ValueOf(collection)
-		blockContent := raw[pos:endTagStart]
-
-		switch collValue.Kind() {
-		case reflect.Slice, reflect.Array:
-			for i := 0; i < collValue.Len(); i++ {
-				// Clone parent data and add loop variable
-				newData := maps.Clone(ctx.Data)
-				newData[loopVar] = collValue.Index(i).Interface() // Store in Data
-				newCtx := structure.RenderCtx{
-					Engine:          ctx.Engine,
-					Data:            newData, // Use cloned data
-					Props:           maps.Clone(ctx.Props),
-					ScopedDirectory: ctx.ScopedDirectory,
+		//
+		source := strings.TrimSpace(parts[1])
+		offset, limit, reversed := 0, -1, false
+		for {
+			m := eachModifier.FindStringSubmatchIndex(source)
+			if m == nil {
+				break
+			}
+			if m[6] != -1 {
+				reversed = true
+			} else {
+				n, err := resolveLoopInt(ctx, source[m[4]:m[5]])
+				if err != nil {
+					return append(errs, fmt.Errorf("each %s: %w", source[m[2]:m[3]], err))
 				}
-
-				// Render block with new context
-				var blockSB strings.Builder
-				if renderErrs := core.Render(&newCtx, &blockSB, blockContent); len(renderErrs) > 0 {
-					errs = append(errs, renderErrs...)
+				if source[m[2]:m[3]] == "limit" {
+					limit = n
+				} else {
+					offset = n
 				}
-				sb.WriteString(blockSB.String())
 			}
+			source = strings.TrimSpace(source[:m[0]])
+		}
 
-		case reflect.Map:
-			iter := collValue.MapRange()
-			for iter.Next() {
-				newData := maps.Clone(ctx.Data)
-				newData[loopVar] = iter.Value().Interface() // Store in Data
-				newCtx := structure.RenderCtx{
-					Engine:          ctx.Engine,
-					Data:            newData,
-					Props:           maps.Clone(ctx.Props),
-					ScopedDirectory: ctx.ScopedDirectory,
-				}
+		entries, collectionErrs := resolveLoopEntries(ctx, source)
+		if len(collectionErrs) > 0 {
+			errs = append(errs, collectionErrs...)
+		}
+		entries = entries[min(max(offset, 0), len(entries)):]
+		if limit >= 0 && limit < len(entries) {
+			entries = entries[:limit]
+		}
+		if reversed {
+			slices.Reverse(entries)
+		}
 
-				var blockSB strings.Builder
-				if renderErrs := core.Render(&newCtx, &blockSB, blockContent); len(renderErrs) > 0 {
-					errs = append(errs, renderErrs...)
-				}
-				sb.WriteString(blockSB.String())
+		if len(entries) == 0 {
+			for _, branch := range node.Branches {
+				errs = append(errs, core.Execute(ctx, w, branch.Children)...)
+			}
+			return errs
+		}
+
+		outer, _ := ctx.Lookup("loop")
+		parent, _ := outer.(map[string]any)
+		for i, entry := range entries {
+			vars := map[string]any{valueVar: entry.value}
+			if keyVar != "" {
+				vars[keyVar] = entry.key
+			}
+			loop := map[string]any{
+				"index":  i + 1,
+				"index0": i,
+				"first":  i == 0,
+				"last":   i == len(entries)-1,
+				"length": len(entries),
 			}
+			if parent != nil {
+				loop["parent"] = parent
+			}
+			vars["loop"] = loop
+
+			// each iteration gets its own scope, the request and registries stay shared
+			ctx.PushScope(vars)
+			errs = append(errs, core.Execute(ctx, w, node.Children)...)
+			ctx.PopScope()
 
-		default:
-			errs = append(errs, fmt.Errorf("cannot iterate over %T", collection))
+			signal := ctx.LoopSignal
+			ctx.LoopSignal = structure.LoopNone
+			if signal == structure.LoopBreak || ctx.Halted {
+				break
+			}
 		}
 
-		return endTagStart + endTagLength, errs
+		return errs
 	},
 }
+
+// Break stops the innermost "each" loop
+var BreakTag = TemplateTag{
+	Name: "break",
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
+		return signalLoop(ctx, structure.LoopBreak)
+	},
+}
+
+// Continue skips to the next iteration of the innermost "each" loop
+var ContinueTag = TemplateTag{
+	Name: "continue",
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
+		return signalLoop(ctx, structure.LoopContinue)
+	},
+}
+
+func signalLoop(ctx *structure.RenderCtx, signal structure.LoopSignal) []error {
+	if loop, _ := ctx.Lookup("loop"); loop == nil {
+		return []error{fmt.Errorf("%q used outside of an each loop", map[structure.LoopSignal]string{structure.LoopBreak: "break", structure.LoopContinue: "continue"}[signal])}
+	}
+	ctx.LoopSignal = signal
+	return nil
+}
+
+// parseLoopVariables reads "item" or "key, value"
+func parseLoopVariables(vars string) (keyVar, valueVar string, err error) {
+	names := strings.Split(vars, ",")
+	if len(names) > 2 {
+		return "", "", fmt.Errorf("invalid each syntax: expected at most two loop variables, got %q", vars)
+	}
+	for i := range names {
+		names[i] = strings.TrimPrefix(strings.TrimSpace(names[i]), ".")
+		if !loopVariable.MatchString(names[i]) {
+			return "", "", fmt.Errorf("invalid each loop variable %q", names[i])
+		}
+	}
+	if len(names) == 2 {
+		return names[0], names[1], nil
+	}
+	return "", names[0], nil
+}
+
+// resolveLoopEntries evaluates the collection, lists keep their order and maps are sorted by key
+func resolveLoopEntries(ctx *structure.RenderCtx, source string) (entries []loopEntry, errs []error) {
+	if bounds, ok := strings.CutPrefix(source, "range "); ok {
+		entry, err := resolveRange(ctx, bounds)
+		if err != nil {
+			return nil, []error{err}
+		}
+		return entry, nil
+	}
+
+	collection, errs := core.EvaluateExpression(ctx, source)
+	if collection == nil {
+		return nil, errs
+	}
+	collValue := reflect.ValueOf(collection)
+	switch collValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		entries = make([]loopEntry, collValue.Len())
+		for i := range entries {
+			entries[i] = loopEntry{key: i, value: collValue.Index(i).Interface()}
+		}
+	case reflect.Map:
+		keys := collValue.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return core.Compare(a.Interface(), b.Interface())
+		})
+		entries = make([]loopEntry, len(keys))
+		for i, key := range keys {
+			entries[i] = loopEntry{key: key.Interface(), value: collValue.MapIndex(key).Interface()}
+		}
+	default:
+		errs = append(errs, fmt.Errorf("cannot iterate over %T", collection))
+	}
+	return entries, errs
+}
+
+// maximum number of items a range literal may produce
+const maxRange = 100_000
+
+// largest whole number a range bound may be, 2^53
+const maxExactInt = 1 << 53
+
+// resolveRange reads "1..10" or ".from..(.to)", both ends are included and ranges may count down
+func resolveRange(ctx *structure.RenderCtx, bounds string) ([]loopEntry, error) {
+	from, to, ok := strings.Cut(bounds, "..")
+	if !ok {
+		return nil, fmt.Errorf("invalid range %q: expected {START}..{END}", bounds)
+	}
+	start, err := resolveLoopInt(ctx, from)
+	if err != nil {
+		return nil, fmt.Errorf("range start: %w", err)
+	}
+	end, err := resolveLoopInt(ctx, to)
+	if err != nil {
+		return nil, fmt.Errorf("range end: %w", err)
+	}
+	// bounds are within ±2^53 so the span can't overflow
+	span := end - start
+	step := 1
+	if span < 0 {
+		span, step = -span, -1
+	}
+	if span >= maxRange {
+		return nil, fmt.Errorf("range %d..%d has more than %d items", start, end, maxRange)
+	}
+	count := span + 1
+	entries := make([]loopEntry, count)
+	for i := range entries {
+		entries[i] = loopEntry{key: i, value: start + i*step}
+	}
+	return entries, nil
+}
+
+func resolveLoopInt(ctx *structure.RenderCtx, expr string) (int, error) {
+	value, errs := core.EvaluateExpression(ctx, strings.TrimSpace(expr))
+	if len(errs) > 0 {
+		return 0, errs[0]
+	}
+	f, ok := core.ToFloat(value)
+	if !ok || f != math.Trunc(f) {
+		return 0, fmt.Errorf("%q is not a whole number", core.Stringify(value))
+	}
+	// larger numbers are not exact as float64
+	if math.Abs(f) > maxExactInt {
+		return 0, fmt.Errorf("%q is out of range", core.Stringify(value))
+	}
+	return int(f), nil
+}
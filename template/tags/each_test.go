@@ -0,0 +1,89 @@
+package tags_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kato-studio/wispy/template"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+func render(t *testing.T, src string, data map[string]any) string {
+	t.Helper()
+	engine := template.StartDefaultEngine()
+	ctx := engine.InitCtx("", &structure.SiteStructure{}, data)
+	var out strings.Builder
+	if errs := template.Render(ctx, &out, src); len(errs) > 0 {
+		t.Fatalf("Render(%q) errors: %v", src, errs)
+	}
+	return out.String()
+}
+
+func TestEach(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"list", `{% each x in .list %}{% .x %}{% end-each %}`, "abc"},
+		{"loop metadata", `{% each x in .list %}{% .loop.index %}/{% .loop.length %}{% if .loop.last %}.{% else %},{% end-if %}{% end-each %}`, "1/3,2/3,3/3."},
+		{"outer variables", `{% each x in .list %}{% .name %}{% end-each %}`, "AnnAnnAnn"},
+		{"nested loops", `{% each x in .nums %}{% each y in .nums %}{% .loop.parent.index %}{% .y %} {% end-each %}{% end-each %}`, "11 12 21 22 "},
+		{"shadowing", `{% each name in .list %}{% .name %}{% end-each %}{% .name %}`, "abcAnn"},
+		{"assign is scoped", `{% each x in .list %}{% assign name = .x %}{% end-each %}{% .name %}`, "Ann"},
+		{"nested assign is scoped", `{% each x in .list %}{% assign .user.name = .x %}{% .user.name %}{% end-each %}{% .user.name %}{% .user.role %}`, "abcBobadmin"},
+		{"assign before loop", `{% assign total = 0 %}{% each x in .nums %}{% .total + .x %}{% end-each %}`, "12"},
+		{"break", `{% each x in .list %}{% if .x == "b" %}{% break %}{% end-if %}{% .x %}{% end-each %}`, "a"},
+		{"continue", `{% each x in .list %}{% if .x == "b" %}{% continue %}{% end-if %}{% .x %}{% end-each %}`, "ac"},
+		{"empty", `{% each x in .empty %}{% .x %}{% else %}none{% end-each %}`, "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string]any{
+				"name":  "Ann",
+				"list":  []any{"a", "b", "c"},
+				"nums":  []any{1, 2},
+				"empty": []any{},
+				"user":  map[string]any{"name": "Bob", "role": "admin"},
+			}
+			if got := render(t, tt.src, data); got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEachRange(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+		err  string
+	}{
+		{"up", `{% each i in range 1..3 %}{% .i %}{% end-each %}`, "123", ""},
+		{"down", `{% each i in range 3..1 %}{% .i %}{% end-each %}`, "321", ""},
+		{"variables", `{% each i in range .from..(.to) %}{% .i %}{% end-each %}`, "-101", ""},
+		{"too many items", `{% each i in range 0..100000 %}{% .i %}{% end-each %}`, "", "has more than 100000 items"},
+		{"overflow", `{% each i in range 0..9223372036854775807 %}{% .i %}{% end-each %}`, "", "out of range"},
+		{"overflow down", `{% each i in range 9007199254740992..(-9007199254740992) %}{% .i %}{% end-each %}`, "", "has more than 100000 items"},
+		{"overflow from query", `{% each i in range .huge..(.to) %}{% .i %}{% end-each %}`, "", "out of range"},
+		{"fraction", `{% each i in range 0..1.5 %}{% .i %}{% end-each %}`, "", "is not a whole number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := template.StartDefaultEngine()
+			ctx := engine.InitCtx("", &structure.SiteStructure{}, map[string]any{"from": -1, "to": 1, "huge": 1e300})
+			var out strings.Builder
+			errs := template.Render(ctx, &out, tt.src)
+			if tt.err == "" {
+				if len(errs) > 0 || out.String() != tt.want {
+					t.Errorf("Render(%q) = %q, %v, want %q", tt.src, out.String(), errs, tt.want)
+				}
+				return
+			}
+			if len(errs) == 0 || !strings.Contains(errs[0].Error(), tt.err) {
+				t.Errorf("Render(%q) errors = %v, want %q", tt.src, errs, tt.err)
+			}
+		})
+	}
+}
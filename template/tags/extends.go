@@ -2,7 +2,7 @@ package tags
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"path/filepath"
 	"strings"
 
@@ -13,111 +13,81 @@ import (
 // ExtendsTag allows a template to extend another template and override its blocks
 var ExtendsTag = TemplateTag{
 	Name: "extends",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (new_pos int, errs []error) {
+	// The closing tag is optional as extends might be at the top with content following
+	Kind: structure.KindRest,
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
 		// Extract the parent template name from the tag contents
-		parentName := strings.Trim(tag_contents, " \"'")
+		parentName := strings.Trim(node.Content, " \"'")
 		if parentName == "" {
 			errs = append(errs, fmt.Errorf("extends tag is missing the parent template name"))
-			return pos, errs
+			return errs
 		}
 
-		// Find the closing tag for the entire content (if any)
-		// This is optional as extends might be at the top with content following
-		closingTag := delimWrap(ctx, "end-extends")
-		closingPos := strings.Index(raw[pos:], closingTag)
-		if closingPos != -1 {
-			closingPos += pos
-		} else {
-			closingPos = len(raw)
-		}
-
-		// Get the child content (blocks to override)
-		childContent := raw[pos:closingPos]
-
 		// Read the parent template
-		sitePartialsPath := ctx.ScopedDirectory //filepath.Join(ctx.ScopedDirectory, "")
-		parentFilePath := filepath.Join(sitePartialsPath, parentName+".hstm")
-
-		parentContentAsBytes, err := os.ReadFile(parentFilePath)
-		if err != nil {
-			parentFilePath = filepath.Join(sitePartialsPath, parentName, "index.hstm")
-			parentContentAsBytes, err = os.ReadFile(parentFilePath)
-		}
-
+		parentTemplate, err := loadParent(ctx, parentName)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("failed to read layout template file %s: %v", parentFilePath, err))
-			return pos, errs
+			errs = append(errs, err)
+			return errs
 		}
 
 		// Update for use in asset imports
-		ctx.CurrentTemplatePath = parentFilePath
-
-		// Parse the child content to find block definitions
-		slotStartTag := delimWrap(ctx, "slot ")
-		slotEndTag := delimWrap(ctx, "end-slot")
-
-		var rawContent strings.Builder
-		childPos := 0
-		for childPos < len(childContent) {
-			startPos := strings.Index(childContent[childPos:], slotStartTag)
-			if startPos == -1 {
-				// catch content if no slot tags or trailing content after all slots have been captured
-				rawContent.WriteString(childContent[childPos:])
-				break
-			}
-			// handle any content between slot tags
-			rawContent.WriteString(childContent[childPos:startPos])
-
-			// update active pos
-			startPos += childPos
-
-			endPos := strings.Index(childContent[startPos:], slotEndTag)
-			if endPos == -1 {
-				errs = append(errs, fmt.Errorf("unclosed slot block in child template"))
-				break
+		ctx.CurrentTemplatePath = parentTemplate.Path
+
+		// Store slot blocks, everything else is passed to the parent template
+		var passed []*structure.Node
+		for _, child := range node.Children {
+			if child.Type == structure.TagNode && child.Name == SlotTag.Name {
+				slotName := strings.TrimSpace(child.Content)
+				ctx.Slots[slotName] = &structure.Slot{Nodes: child.Children, Scope: ctx.CurrentScope()}
+				continue
 			}
-			endPos += startPos
-
-			// Extract slot name (after "define ")
-			slotNameStart := startPos + len(slotStartTag)
-			slotNameEnd := strings.IndexAny(childContent[slotNameStart:], " \t\n\r")
-			if slotNameEnd == -1 {
-				slotNameEnd = endPos
-			} else {
-				slotNameEnd += slotNameStart
-			}
-
-			slotName := strings.TrimSpace(childContent[slotNameStart:slotNameEnd])
-			slotContent := childContent[slotNameEnd:endPos]
-
-			// Store the block content
-			ctx.Slots[slotName] = slotContent
-
-			childPos = endPos + len(slotEndTag)
+			passed = append(passed, child)
 		}
 
-		var renderErrs []error
-		// Render contents passed to layout
-		var tempBuilder strings.Builder
-		pased := strings.TrimSpace(rawContent.String())
-		if len(pased) > 0 {
-			renderErrs = core.Render(ctx, &tempBuilder, pased)
-			if len(renderErrs) > 0 {
-				errs = append(errs, renderErrs...)
-			}
-			ctx.Passed = tempBuilder.String()
+		// Contents are rendered where the parent places "passed", without content the passed content of an
+		// enclosing layout is kept
+		if hasContent(passed) {
+			ctx.Passed = &structure.Slot{Nodes: passed, Scope: ctx.CurrentScope()}
 		}
 
 		// Render the parent template with the child blocks
-		renderErrs = core.Render(ctx, sb, string(parentContentAsBytes))
-		if len(renderErrs) > 0 {
-			errs = append(errs, renderErrs...)
+		return append(errs, core.ExecuteTemplate(ctx, w, parentTemplate)...)
+	},
+	Lint: func(ctx *structure.RenderCtx, node *structure.Node) (errs []error) {
+		parentName := strings.Trim(node.Content, " \"'")
+		if parentName == "" {
+			return append(errs, fmt.Errorf("extends tag is missing the parent template name"))
+		}
+		if _, err := loadParent(ctx, parentName); err != nil {
+			errs = append(errs, err)
 		}
+		return errs
+	},
+}
+
+// loadParent loads the template extended by "extends", relative to the site directory
+func loadParent(ctx *structure.RenderCtx, name string) (*structure.Template, error) {
+	parentFilePath := filepath.Join(ctx.ScopedDirectory, name+".hstm")
+	parentTemplate, err := core.LoadFirstTemplate(ctx.Engine, core.SiteKey(ctx),
+		parentFilePath,
+		filepath.Join(ctx.ScopedDirectory, name, "index.hstm"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layout template file %s: %v", parentFilePath, err)
+	}
+	return parentTemplate, nil
+}
 
-		// Return position after the closing tag (or end of input)
-		if closingPos == len(raw) {
-			return closingPos, errs
+// SlotTag marks named content inside an extends or component tag, the content is stored in ctx.Slots
+var SlotTag = TemplateTag{
+	Name: "slot",
+	Kind: structure.KindBlock,
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
+		slotName := strings.TrimSpace(node.Content)
+		if slotName == "" {
+			return []error{fmt.Errorf("slot tag is missing the slot name")}
 		}
-		return closingPos + len(closingTag), errs
+		ctx.Slots[slotName] = &structure.Slot{Nodes: node.Children, Scope: ctx.CurrentScope()}
+		return errs
 	},
 }
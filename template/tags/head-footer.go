@@ -1,43 +1,45 @@
 package tags
 
 import (
+	"io"
 	"strings"
 
 	"github.com/kato-studio/wispy/template/core"
 	"github.com/kato-studio/wispy/wispy_common/structure"
 )
 
+// root-head, root-css and root-js are filled once the page is rendered so tags anywhere in the page can still add to them
 var HeadTag = TemplateTag{
 	Name: "root-head",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, _, _ string, pos int) (int, []error) {
-		sb.WriteString(ctx.HeadTags.Render())
-		return pos, nil
+	Render: func(ctx *structure.RenderCtx, w io.Writer, _ *structure.Node) []error {
+		structure.DeferOrWrite(w, ctx.HeadTags.Render)
+		return nil
 	},
 }
 
 var CssAssetsTag = TemplateTag{
 	Name: "root-css",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, _, _ string, pos int) (int, []error) {
-		sb.WriteString(ctx.AssetRegistry.Render(structure.CSS))
-		return pos, nil
+	Render: func(ctx *structure.RenderCtx, w io.Writer, _ *structure.Node) []error {
+		structure.DeferOrWrite(w, func() string { return ctx.AssetRegistry.Render(structure.CSS) })
+		return nil
 	},
 }
 
 var TitleTag = TemplateTag{
 	Name: "title",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (int, []error) {
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) []error {
 		ctx.HeadTags.Add(&structure.HeadTag{
 			TagName: "title",
-			Content: strings.Trim(tag_contents, "\""),
+			Content: strings.Trim(node.Content, "\""),
 		})
-		return pos, nil
+		return nil
 	},
 }
 
 var MetaTag = TemplateTag{
 	Name: "meta",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (int, []error) {
-		options := core.SplitRespectQuotes(tag_contents)
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) []error {
+		options := core.SplitRespectQuotes(node.Content)
 
 		tag := structure.HeadTag{
 			TagName:    "meta",
@@ -45,14 +47,14 @@ var MetaTag = TemplateTag{
 		}
 
 		ctx.HeadTags.Add(&tag)
-		return pos, nil
+		return nil
 	},
 }
 
 var JsAssetsTag = TemplateTag{
 	Name: "root-js",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, _, _ string, pos int) (int, []error) {
-		sb.WriteString(ctx.AssetRegistry.Render(structure.JS))
-		return pos, nil
+	Render: func(ctx *structure.RenderCtx, w io.Writer, _ *structure.Node) []error {
+		structure.DeferOrWrite(w, func() string { return ctx.AssetRegistry.Render(structure.JS) })
+		return nil
 	},
 }
@@ -1,35 +1,42 @@
 package tags
 
 import (
-	"fmt"
-	"strings"
+	"io"
 
 	"github.com/kato-studio/wispy/template/core"
 	"github.com/kato-studio/wispy/wispy_common/structure"
 )
 
-// If take only show content if a value is true
+// If take only show content if a value is true,
+// otherwise the first "else-if" branch with a true value or the "else" branch is shown
 var IfTag = TemplateTag{
-	Name: "if",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (new_pos int, errs []error) {
-
-		endTag := delimWrap(ctx, "end-if")
-		endTagStart, endTagLength := core.SeekIndexAndLength(raw, endTag, pos)
-		if endTagStart == -1 {
-			errs = append(errs, fmt.Errorf("could not find end tag for %s", endTag))
-			return pos, errs
-		}
-		content := raw[pos:endTagStart]
-		newEndPos := endTagStart + endTagLength
-
-		value, condition_errors := core.ResolveCondition(ctx, tag_contents)
+	Name:    "if",
+	Kind:    structure.KindBlock,
+	Clauses: []string{"else-if", "else"},
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
+		value, condition_errors := core.ResolveCondition(ctx, node.Content)
 
 		if len(condition_errors) > 0 {
 			errs = append(errs, condition_errors...)
 		}
 		if value {
-			core.Render(ctx, sb, content)
+			errs = append(errs, core.Execute(ctx, w, node.Children)...)
+			return errs
+		}
+
+		for _, branch := range node.Branches {
+			if branch.Name == "else-if" {
+				value, condition_errors = core.ResolveCondition(ctx, branch.Content)
+				if len(condition_errors) > 0 {
+					errs = append(errs, condition_errors...)
+				}
+				if !value {
+					continue
+				}
+			}
+			errs = append(errs, core.Execute(ctx, w, branch.Children)...)
+			break
 		}
-		return newEndPos, errs
+		return errs
 	},
 }
@@ -0,0 +1,59 @@
+package tags_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kato-studio/wispy/template"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+func TestIfBranches(t *testing.T) {
+	const chain = `{% if .n == 1 %}one{% else-if .n == 2 %}two{% else-if .n > 2 %}many{% else %}none{% end-if %}`
+	tests := []struct {
+		name string
+		src  string
+		n    int
+		want string
+	}{
+		{"if", chain, 1, "one"},
+		{"first else-if", chain, 2, "two"},
+		{"second else-if", chain, 5, "many"},
+		{"else", chain, 0, "none"},
+		{"first true else-if wins", `{% if false %}a{% else-if .n > 0 %}b{% else-if .n > 1 %}c{% end-if %}`, 3, "b"},
+		{"no branch taken", `{% if .n == 1 %}one{% else-if .n == 2 %}two{% end-if %}`, 3, ""},
+		{"else only", `{% if .n == 1 %}one{% else %}other{% end-if %}`, 1, "one"},
+		{"nested", `{% if .n > 0 %}{% if .n > 5 %}big{% else %}small{% end-if %}{% else %}none{% end-if %}`, 3, "small"},
+		{"nested in else", `{% if .n > 5 %}big{% else %}{% if .n == 0 %}zero{% else-if .n == 3 %}three{% end-if %}{% end-if %}`, 3, "three"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := render(t, tt.src, map[string]any{"n": tt.n}); got != tt.want {
+				t.Errorf("Render(%q) with n = %d = %q, want %q", tt.src, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIfBranchErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{"else-if after else", `{% if .n %}a{% else %}b{% else-if .n %}c{% end-if %}`, `"else-if" after "else" in "if"`},
+		{"else after else", `{% if .n %}a{% else %}b{% else %}c{% end-if %}`, `"else" after "else" in "if"`},
+		{"unclosed", `{% if .n %}a{% else %}b`, `could not find end tag for "end-if"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := template.StartDefaultEngine()
+			ctx := engine.InitCtx("", &structure.SiteStructure{}, map[string]any{"n": 1})
+			var out strings.Builder
+			errs := template.Render(ctx, &out, tt.src)
+			if len(errs) == 0 || !strings.Contains(errs[0].Error(), tt.err) {
+				t.Errorf("Render(%q) errors = %v, want %q", tt.src, errs, tt.err)
+			}
+		})
+	}
+}
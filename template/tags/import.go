@@ -2,6 +2,7 @@ package tags
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -13,49 +14,29 @@ import (
 // relative import for adjacent files
 var ImportTag = TemplateTag{
 	Name: "import",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (int, []error) {
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) []error {
 		var errs []error
-		// Remove all line breaks before parsing options
-		cleaned := strings.ReplaceAll(tag_contents, "\n", "")
-		cleaned = strings.ReplaceAll(cleaned, "\r", "")
-		var options = parseAssetTagOptions(cleaned)
-		var path = strings.ReplaceAll(options["path"], " ", "")
+		options, path, external := importOptions(node)
 		var _type = options["type"]
-		var external = options["external"] == "true"
 		var isInline = options["inline"] == "true"
 		var contentStr = ""
 
-		if strings.HasPrefix(path, "https://") {
-			external = true
-		} else if options["inline"] != "true" {
+		if !strings.HasPrefix(path, "https://") && options["inline"] != "true" {
 			isInline = true
 		}
 
-		switch {
-		case strings.HasPrefix(path, "~/"):
-			external = false
-			isInline = true
-			// Relative to current template
-			baseDir := filepath.Dir(ctx.CurrentTemplatePath)
-			path = filepath.Join(baseDir, strings.TrimPrefix(path, "~/"))
-
-			// Read file
-			content, err := os.ReadFile(path)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("import error: %v", err))
-				return pos, errs
+		if localPath, local := localImportPath(ctx, path, external); local {
+			if strings.HasPrefix(path, "~/") {
+				external = false
+				isInline = true
 			}
-			// Determine type and process
-			contentStr = string(content)
-		case external == false:
-			baseDir := filepath.Dir("./")
-			path = filepath.Join(baseDir, ctx.ScopedDirectory, path)
+			path = localPath
 
 			// Read file
 			content, err := os.ReadFile(path)
 			if err != nil {
 				errs = append(errs, fmt.Errorf("import error: %v", err))
-				return pos, errs
+				return errs
 			}
 			// Determine type and process
 			contentStr = string(content)
@@ -102,9 +83,44 @@ var ImportTag = TemplateTag{
 		default:
 			// Directly include other file types
 			fmt.Println("could not determine asset type of, " + path)
-			sb.WriteString(contentStr)
+			io.WriteString(w, contentStr)
 		}
 
-		return pos, errs
+		return errs
 	},
+	Lint: func(ctx *structure.RenderCtx, node *structure.Node) (errs []error) {
+		_, path, external := importOptions(node)
+		if path == "" {
+			return append(errs, fmt.Errorf("import tag is missing a path"))
+		}
+		if localPath, local := localImportPath(ctx, path, external); local {
+			if _, err := os.Stat(localPath); err != nil {
+				errs = append(errs, fmt.Errorf("import %q not found at %s", path, localPath))
+			}
+		}
+		return errs
+	},
+}
+
+// importOptions reads the options of an import tag along with its path and whether it is external
+func importOptions(node *structure.Node) (options map[string]string, path string, external bool) {
+	// Remove all line breaks before parsing options
+	cleaned := strings.ReplaceAll(node.Content, "\n", "")
+	cleaned = strings.ReplaceAll(cleaned, "\r", "")
+	options = parseAssetTagOptions(cleaned)
+	path = strings.ReplaceAll(options["path"], " ", "")
+	external = options["external"] == "true" || strings.HasPrefix(path, "https://")
+	return options, path, external
+}
+
+// localImportPath resolves the file read by an import, "~/" paths are relative to the current template
+// and other local paths to the site directory. External imports are not read
+func localImportPath(ctx *structure.RenderCtx, path string, external bool) (string, bool) {
+	switch {
+	case strings.HasPrefix(path, "~/"):
+		return filepath.Join(filepath.Dir(ctx.CurrentTemplatePath), strings.TrimPrefix(path, "~/")), true
+	case !external:
+		return filepath.Join(ctx.ScopedDirectory, path), true
+	}
+	return path, false
 }
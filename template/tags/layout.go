@@ -2,7 +2,7 @@ package tags
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"path/filepath"
 	"strings"
 
@@ -13,63 +13,65 @@ import (
 // LayoutTag allows a template to specify a layout template that wraps its content
 var LayoutTag = TemplateTag{
 	Name: "layout",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (new_pos int, errs []error) {
+	// Everything following the tag is the content wrapped by the layout
+	Kind: structure.KindRest,
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
 		skipLayout := ctx.Request.Header.Get("HX-Skip-Layout")
 		hxBoosted := ctx.Request.Header.Get("HX-Boosted")
 
-		closingPos := len(raw)
 		if strings.ToLower(skipLayout) == "true" && strings.ToLower(hxBoosted) != "true" {
-			renderErrs := core.Render(ctx, sb, raw[pos:closingPos])
+			renderErrs := core.Execute(ctx, w, node.Children)
 			if len(renderErrs) > 0 {
 				errs = append(errs, renderErrs...)
 			}
 
-			return pos, errs
+			return errs
 		}
 
 		// Extract the layout template name from the tag contents
-		layoutName := strings.Trim(tag_contents, " \"'")
+		layoutName := strings.Trim(node.Content, " \"'")
 		if layoutName == "" {
 			errs = append(errs, fmt.Errorf("layout tag is missing the layout template name"))
-			return pos, errs
-		}
-
-		// Get the content that will be wrapped by the layout
-		content := raw[pos:closingPos]
-
-		sitePartialsPath := filepath.Join(ctx.ScopedDirectory, "layouts")
-		layoutFilePath := filepath.Join(sitePartialsPath, layoutName+".hstm")
-
-		layoutContentAsBytes, err := os.ReadFile(layoutFilePath)
-		if err != nil {
-			layoutFilePath = filepath.Join(sitePartialsPath, layoutName, "index.hstm")
-			layoutContentAsBytes, err = os.ReadFile(layoutFilePath)
+			return errs
 		}
 
+		layoutTemplate, err := loadLayout(ctx, layoutName)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("failed to read layout template file %s: %v", layoutFilePath, err))
-			return pos, errs
+			errs = append(errs, err)
+			return errs
 		}
 
-		// Render contents pass to layout
-		var tempBuilder strings.Builder
-		renderErrs := core.Render(ctx, &tempBuilder, content)
-		if len(renderErrs) > 0 {
-			errs = append(errs, renderErrs...)
-		}
-		ctx.Passed = tempBuilder.String()
+		// Contents are rendered where the layout places "passed", streaming with the layout
+		ctx.Passed = &structure.Slot{Nodes: node.Children, Scope: ctx.CurrentScope()}
 
 		// Update for use in asset imports
-		// prevTemplatePath := ctx.CurrentTemplatePath
-		ctx.CurrentTemplatePath = layoutFilePath
+		ctx.CurrentTemplatePath = layoutTemplate.Path
 
 		// Render the layout template
-		renderErrs = core.Render(ctx, sb, string(layoutContentAsBytes))
-		if len(renderErrs) > 0 {
-			errs = append(errs, renderErrs...)
+		return append(errs, core.ExecuteTemplate(ctx, w, layoutTemplate)...)
+	},
+	Lint: func(ctx *structure.RenderCtx, node *structure.Node) (errs []error) {
+		layoutName := strings.Trim(node.Content, " \"'")
+		if layoutName == "" {
+			return append(errs, fmt.Errorf("layout tag is missing the layout template name"))
 		}
-
-		// Return position after the closing tag
-		return closingPos, errs
+		if _, err := loadLayout(ctx, layoutName); err != nil {
+			errs = append(errs, err)
+		}
+		return errs
 	},
 }
+
+// loadLayout loads "layouts/name.hstm" or "layouts/name/index.hstm" of the current site
+func loadLayout(ctx *structure.RenderCtx, name string) (*structure.Template, error) {
+	siteLayoutsPath := filepath.Join(ctx.ScopedDirectory, "layouts")
+	layoutFilePath := filepath.Join(siteLayoutsPath, name+".hstm")
+	layoutTemplate, err := core.LoadFirstTemplate(ctx.Engine, core.SiteKey(ctx),
+		layoutFilePath,
+		filepath.Join(siteLayoutsPath, name, "index.hstm"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layout template file %s: %v", layoutFilePath, err)
+	}
+	return layoutTemplate, nil
+}
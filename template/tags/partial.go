@@ -2,57 +2,90 @@ package tags
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"path/filepath"
-	"strings"
 
 	"github.com/kato-studio/wispy/template/core"
 	"github.com/kato-studio/wispy/wispy_common/structure"
 )
 
 // PartialTag is a template tag that loads and renders a partial template.
-// It expects the tag_contents to be the name of the partial file (without extension).
-// The partial file should be located in the site's partials directory.
-// The partial file is read, rendered, and the result is written to the string builder.
+// It expects the tag_contents to be the name of the partial file (without extension) followed by optional arguments,
+// {% partial "card" title=.post.title url="/x" %} renders partials/card.hstm with the arguments in Props.
+// The "only" keyword hides the caller's Data from the partial so it can only see its arguments.
+// The partial template is loaded from the engine cache and rendered straight to the writer.
 var PartialTag = TemplateTag{
 	Name: "partial",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (new_pos int, errs []error) {
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
+		args, err := core.ParseTagArgs(node.Content)
+		if err != nil {
+			return append(errs, fmt.Errorf("partial %w", err))
+		}
 
 		// Extract the partial name from the tag contents
-		partialName := strings.Trim(tag_contents, " \"'")
+		partialName := args.Name()
 		if partialName == "" {
 			errs = append(errs, fmt.Errorf("partial tag is missing the partial name"))
-			return pos, errs
+			return errs
+		}
+		for _, extra := range args.Positional[1:] {
+			if extra != "only" {
+				errs = append(errs, fmt.Errorf("partial %q has an unexpected argument %q, expected name=value", partialName, extra))
+			}
 		}
 
-		sitePartialsPath := filepath.Join(ctx.ScopedDirectory, "partials")
-		partialFilePath := filepath.Join(sitePartialsPath, partialName+".hstm")
-
-		partialContentAsBytes, err := os.ReadFile(partialFilePath)
+		partialTemplate, err := loadPartial(ctx, partialName)
 		if err != nil {
-			partialFilePath = filepath.Join(sitePartialsPath, partialName, "index.hstm")
-			partialContentAsBytes, err = os.ReadFile(partialFilePath)
+			return append(errs, err)
 		}
 
-		if err != nil {
-			errs = append(errs, fmt.Errorf("failed to read layout template file %s: %v", partialFilePath, err))
-			return pos, errs
+		// Arguments are evaluated in the caller's scope
+		props, propErrs := args.Props(ctx)
+		if len(propErrs) > 0 {
+			errs = append(errs, propErrs...)
 		}
 
-		var partialSB strings.Builder
+		// The caller's props, data and template path are restored once the partial is rendered
+		defer ctx.RestoreScope(ctx.CurrentScope())
+		ctx.Props = props
+		if args.Has("only") {
+			ctx.ResetData(make(map[string]any))
+		}
 
 		// Update for use in asset imports
-		ctx.CurrentTemplatePath = partialFilePath
+		ctx.CurrentTemplatePath = partialTemplate.Path
 
-		renderErrs := core.Render(ctx, &partialSB, string(partialContentAsBytes))
-		if len(renderErrs) > 0 {
-			errs = append(errs, renderErrs...)
-			return pos, errs
-		}
+		// Output is kept when the partial has errors, strict mode stops the render through ctx.Halted
+		return append(errs, core.ExecuteTemplate(ctx, w, partialTemplate)...)
+	},
+	Lint: lintPartialName,
+}
 
-		sb.WriteString(partialSB.String())
+// lintPartialName checks that the partial named by a partial or component tag exists
+func lintPartialName(ctx *structure.RenderCtx, node *structure.Node) (errs []error) {
+	args, err := core.ParseTagArgs(node.Content)
+	if err != nil {
+		return append(errs, fmt.Errorf("%s %w", node.Name, err))
+	}
+	if args.Name() == "" {
+		return append(errs, fmt.Errorf("%s tag is missing the partial name", node.Name))
+	}
+	if _, err := loadPartial(ctx, args.Name()); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
 
-		// Return the new position (which is the same as the input pos since we didn't handle any content beyond the tag_contents)
-		return pos, errs
-	},
+// loadPartial loads "partials/name.hstm" or "partials/name/index.hstm" of the current site
+func loadPartial(ctx *structure.RenderCtx, name string) (*structure.Template, error) {
+	sitePartialsPath := filepath.Join(ctx.ScopedDirectory, "partials")
+	partialFilePath := filepath.Join(sitePartialsPath, name+".hstm")
+	partialTemplate, err := core.LoadFirstTemplate(ctx.Engine, core.SiteKey(ctx),
+		partialFilePath,
+		filepath.Join(sitePartialsPath, name, "index.hstm"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read partial template file %s: %v", partialFilePath, err)
+	}
+	return partialTemplate, nil
 }
@@ -0,0 +1,77 @@
+package tags_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kato-studio/wispy/template"
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// renderSite renders src in a site folder holding the given partials
+func renderSite(t *testing.T, mode structure.UndefinedMode, partials map[string]string, src string, data map[string]any) (string, *structure.RenderCtx, []error) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "partials"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range partials {
+		if err := os.WriteFile(filepath.Join(dir, "partials", name+".hstm"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine := template.StartDefaultEngine()
+	engine.Undefined = mode
+	site := template.NewSiteStructure(filepath.Base(dir))
+	ctx := engine.InitCtx(dir, &site, data)
+	var out strings.Builder
+	errs := template.Render(ctx, &out, src)
+	return out.String(), ctx, errs
+}
+
+func TestPartial(t *testing.T) {
+	partials := map[string]string{
+		"card":   `<b>{% .title %}</b>`,
+		"scoped": `{% .title %}-{% .name %}`,
+		"broken": `<b>{% .title %}</b>{% .missing.value %}<i>after</i>`,
+	}
+	tests := []struct {
+		name    string
+		src     string
+		want    string
+		wantErr bool
+	}{
+		{"props", `{% partial "card" title="Hi" %}`, "<b>Hi</b>", false},
+		{"props from data", `{% partial "card" title=.name %}`, "<b>Ann</b>", false},
+		{"caller data", `{% partial "scoped" title="Hi" %}`, "Hi-Ann", false},
+		{"caller props restored", `{% partial "card" title="A" %}{% .name %}`, "<b>A</b>Ann", false},
+		{"only", `{% partial "scoped" title="Hi" only %}`, "Hi-", true},
+		{"output kept on errors", `{% partial "broken" title="Hi" %}!`, "<b>Hi</b><i>after</i>!", true},
+		{"missing partial", `{% partial "nope" %}!`, "!", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, errs := renderSite(t, structure.UndefinedLenient, partials, tt.src, map[string]any{"name": "Ann"})
+			if (len(errs) > 0) != tt.wantErr {
+				t.Errorf("Render(%q) errors = %v, want errors: %v", tt.src, errs, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+// Strict mode stops the render at the first error of the partial
+func TestPartialStrict(t *testing.T) {
+	partials := map[string]string{"broken": `<b>{% .missing %}</b><i>after</i>`}
+	out, ctx, errs := renderSite(t, structure.UndefinedStrict, partials, `{% partial "broken" %}!`, map[string]any{})
+	if len(errs) == 0 || !ctx.Halted {
+		t.Fatalf("strict render errors = %v, halted = %v", errs, ctx.Halted)
+	}
+	if strings.Contains(out, "after") || strings.Contains(out, "!") {
+		t.Errorf("strict render kept going: %q", out)
+	}
+}
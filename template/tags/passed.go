@@ -1,29 +1,31 @@
 package tags
 
 import (
-	"strings"
+	"io"
 
 	"github.com/kato-studio/wispy/template/core"
 	"github.com/kato-studio/wispy/wispy_common/structure"
 )
 
-// "passed" currently used by extend & layout tags to render passed content
+// "passed" renders the content wrapped by a layout or extends tag in place, in the scope it was written in
 var PassedTag = TemplateTag{
 	Name: "passed",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (new_pos int, errs []error) {
-		if ctx.Passed == "" {
-			return pos, errs
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
+		passed := ctx.Passed
+		if passed == nil {
+			return errs
 		}
+		// the content is rendered once, layouts it uses pass their own
+		ctx.Passed = nil
 
-		// Render the layout template
-		renderErrs := core.Render(ctx, sb, string(ctx.Passed))
-		if len(renderErrs) > 0 {
-			errs = append(errs, renderErrs...)
-		}
-		// reset/clear Passed context
-		ctx.Passed = ""
+		caller := ctx.CurrentScope()
+		ctx.RestoreScope(passed.Scope)
+		errs = core.Execute(ctx, w, passed.Nodes)
+		ctx.RestoreScope(caller)
 
-		// Return position after the closing tag
-		return pos, errs
+		if passed.Rendered != nil {
+			passed.Rendered()
+		}
+		return errs
 	},
 }
@@ -2,6 +2,7 @@ package tags
 
 import (
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/kato-studio/wispy/wispy_common/structure"
@@ -9,14 +10,14 @@ import (
 
 var RedirectTag = TemplateTag{
 	Name: "redirect",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (int, []error) {
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) []error {
 		// var errs []error
 
 		// Parse tag options
-		options := parseAssetTagOptions(tag_contents)
+		options := parseAssetTagOptions(node.Content)
 		redirect := strings.TrimSpace(options["redirect"])
 		fmt.Print(redirect)
 
-		return pos, nil
+		return nil
 	},
 }
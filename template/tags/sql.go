@@ -3,6 +3,7 @@ package tags
 import (
 	"database/sql"
 	"fmt"
+	"io"
 	"path/filepath"
 	"strings"
 
@@ -12,11 +13,12 @@ import (
 
 var SQLiteTag = TemplateTag{
 	Name: "sqlite",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (int, []error) {
+	Kind: structure.KindBlock,
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) []error {
 		var errs []error
 
 		// Parse tag options
-		options := parseAssetTagOptions(tag_contents)
+		options := parseAssetTagOptions(node.Content)
 		query := strings.TrimSpace(options["query"])
 		dbPath := strings.TrimSpace(options["path"])
 
@@ -32,30 +34,18 @@ var SQLiteTag = TemplateTag{
 		// Validate required parameters
 		if query == "" {
 			errs = append(errs, fmt.Errorf("sqlite tag requires a query parameter"))
-			return pos, errs
+			return errs
 		}
 		if dbPath == "" {
 			errs = append(errs, fmt.Errorf("sqlite tag requires a path parameter"))
-			return pos, errs
+			return errs
 		}
 
-		// Find the end tag
-		endTag := delimWrap(ctx, "end-sqlite")
-		endTagStart, endTagLength := core.SeekIndexAndLength(raw, endTag, pos)
-		if endTagStart == -1 {
-			errs = append(errs, fmt.Errorf("could not find end tag for %s", endTag))
-			return pos, errs
-		}
-
-		// Extract content between tags
-		content := raw[pos:endTagStart]
-		newEndPos := endTagStart + endTagLength
-
 		// Open database connection
 		db, err := sql.Open("libsql", "file:"+dbPath)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("failed to open database at %s: %v", dbPath, err))
-			return newEndPos, errs
+			return errs
 		}
 		defer db.Close()
 
@@ -63,7 +53,7 @@ var SQLiteTag = TemplateTag{
 		stmt, err := db.Prepare(query)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("failed to prepare query: %v", err))
-			return newEndPos, errs
+			return errs
 		}
 		defer stmt.Close()
 
@@ -90,7 +80,7 @@ var SQLiteTag = TemplateTag{
 		rows, err := stmt.Query(params...)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("failed to execute query: %v", err))
-			return newEndPos, errs
+			return errs
 		}
 		defer rows.Close()
 
@@ -98,7 +88,7 @@ var SQLiteTag = TemplateTag{
 		columns, err := rows.Columns()
 		if err != nil {
 			errs = append(errs, fmt.Errorf("failed to get column names: %v", err))
-			return newEndPos, errs
+			return errs
 		}
 
 		// Process query results
@@ -151,7 +141,7 @@ var SQLiteTag = TemplateTag{
 		}
 
 		// Execute the inner content with the new context
-		contentErrs := core.Render(ctx, sb, content)
+		contentErrs := core.Execute(ctx, w, node.Children)
 		if errs != nil {
 			errs = append(errs, contentErrs...)
 		}
@@ -159,7 +149,7 @@ var SQLiteTag = TemplateTag{
 		// Remove query results
 		ctx.Data["query"] = nil
 
-		return newEndPos, errs
+		return errs
 	},
 }
 
@@ -170,7 +160,7 @@ var SQLiteTag = TemplateTag{
 // ```
 // var ImportTag = TemplateTag{
 //     Name: "import",
-//     Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (int, []error) {
+//     Render: func(ctx *structure.RenderCtx, w io.Writer, tag_contents, raw string, pos int) (int, []error) {
 //         var errs []error
 //         path := strings.TrimSpace(tag_contents)
 
@@ -217,7 +207,7 @@ var SQLiteTag = TemplateTag{
 
 // var IfTag = TemplateTag{
 // 	Name: "if",
-// 	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (new_pos int, errs []error) {
+// 	Render: func(ctx *structure.RenderCtx, w io.Writer, tag_contents, raw string, pos int) (new_pos int, errs []error) {
 // 		endTag := delimWrap(ctx, "end-if")
 // 		endTagStart, endTagLength := core.SeekIndexAndLength(raw, endTag, pos)
 // 		if endTagStart == -1 {
@@ -232,9 +222,9 @@ var SQLiteTag = TemplateTag{
 // 			errs = append(errs, condition_errors...)
 // 		}
 // 		if value {
-// 			sb.WriteString(content)
+// 			io.WriteString(w, content)
 // 		}
-// 		return newEndPos, errs
+// 		return errs
 // 	},
 // }
 
@@ -2,6 +2,8 @@ package tags
 
 import (
 	"fmt"
+	"io"
+	"maps"
 	"strings"
 
 	"github.com/kato-studio/wispy/template/core"
@@ -11,10 +13,6 @@ import (
 
 type TemplateTag = structure.TemplateTag
 
-func delimWrap(ctx *structure.RenderCtx, value string) string {
-	return strings.Join([]string{ctx.Engine.DelimStart, value, ctx.Engine.DelimEnd}, " ")
-}
-
 // parseAssetTagOptions handles the full parsing including the path edge case
 // and guarantees path variable is return
 func parseAssetTagOptions(input string) map[string]string {
@@ -35,52 +33,42 @@ func parseAssetTagOptions(input string) map[string]string {
 	return options
 }
 
-// insertNestedValue uses maps.Insert to set values in nested structures
-func insertNestedValue(root map[string]interface{}, path []string, value interface{}) error {
+// setNestedValue returns current with value set at path, the maps along the path are copied rather than modified
+// so data shared with other scopes and requests, such as .Site.Data and collection entries, stays as it was
+func setNestedValue(current any, name string, path []string, value any) (any, error) {
 	if len(path) == 0 {
-		return fmt.Errorf("empty path")
+		return value, nil
 	}
-
-	// For single segment paths, just do direct assignment
-	if len(path) == 1 {
-		root[path[0]] = value
-		return nil
+	var updated map[string]any
+	switch current := current.(type) {
+	case nil:
+		updated = make(map[string]any)
+	case map[string]any:
+		updated = maps.Clone(current)
+	default:
+		return nil, fmt.Errorf("path segment '%s' is not a map", name)
 	}
-
-	// Create the nested structure if needed
-	current := root
-	for i := 0; i < len(path)-1; i++ {
-		part := path[i]
-		if next, exists := current[part]; exists {
-			if nextMap, ok := next.(map[string]interface{}); ok {
-				current = nextMap
-			} else {
-				return fmt.Errorf("path segment '%s' is not a map", part)
-			}
-		} else {
-			newMap := make(map[string]interface{})
-			current[part] = newMap
-			current = newMap
-		}
+	child, err := setNestedValue(updated[path[0]], path[0], path[1:], value)
+	if err != nil {
+		return nil, err
 	}
-
-	// Set the final value
-	current[path[len(path)-1]] = value
-	return nil
+	updated[path[0]] = child
+	return updated, nil
 }
 
 // used to skip content that should not be parsed
 var CommentTag = TemplateTag{
 	Name: "comment",
-	Render: func(ctx *structure.RenderCtx, sb *strings.Builder, tag_contents, raw string, pos int) (new_pos int, errs []error) {
-		endTag := delimWrap(ctx, "end-comment")
-		endTagStart, endTagLength := core.SeekIndexAndLength(raw, endTag, pos)
-		if endTagStart == -1 {
-			errs = append(errs, fmt.Errorf("could not find end tag for %s", endTag))
-			return pos, errs
-		}
-		newEndPos := endTagStart + endTagLength
-
-		return newEndPos, errs
+	Kind: structure.KindRaw,
+	Render: func(ctx *structure.RenderCtx, w io.Writer, node *structure.Node) (errs []error) {
+		return errs
 	},
 }
+
+// rawBody returns the unparsed body of a structure.KindRaw tag
+func rawBody(node *structure.Node) string {
+	if len(node.Children) == 0 {
+		return ""
+	}
+	return node.Children[0].Content
+}
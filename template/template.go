@@ -1,20 +1,13 @@
 package template
 
 import (
-	"crypto/tls"
-	"log"
 	"log/slog"
-	"maps"
-	"net/http"
 	"os"
-	"strings"
 
 	"github.com/kato-studio/wispy/template/core"
 	"github.com/kato-studio/wispy/template/filters"
 	"github.com/kato-studio/wispy/template/tags"
 	"github.com/kato-studio/wispy/wispy_common/structure"
-	"golang.org/x/crypto/acme"
-	"golang.org/x/crypto/acme/autocert"
 )
 
 // var SiteMap = map[string]*structure.SiteStructure{}
@@ -53,11 +46,47 @@ var DefaultTemplateFilters = []structure.TemplateFilter{
 	filters.StripFilter,
 	filters.TruncateFilter,
 	filters.SliceFilter,
+	filters.RawFilter,
+	filters.DefaultFilter,
+	filters.ReplaceFilter,
+	filters.SizeFilter,
+	filters.PluralizeFilter,
+	filters.SlugifyFilter,
+	// collections
+	filters.JoinFilter,
+	filters.SplitFilter,
+	filters.FirstFilter,
+	filters.LastFilter,
+	filters.SortFilter,
+	filters.SortByFilter,
+	filters.ReverseFilter,
+	filters.UniqFilter,
+	filters.WhereFilter,
+	filters.MapFilter,
+	// numbers
+	filters.AbsFilter,
+	filters.RoundFilter,
+	filters.CeilFilter,
+	filters.FloorFilter,
+	filters.NumberFormatFilter,
+	filters.CurrencyFilter,
+	// dates
+	filters.DateFilter,
+	filters.TimeFormatFilter,
+	// encoding
+	filters.JSONFilter,
+	filters.URLEncodeFilter,
+	filters.EscapeFilter,
+	filters.Base64Filter,
+	filters.Base64DecodeFilter,
+	filters.MarkdownFilter,
 }
 
 var DefaultTemplateTags = []structure.TemplateTag{
 	tags.IfTag,
 	tags.EachTag,
+	tags.BreakTag,
+	tags.ContinueTag,
 	tags.CommentTag,
 	tags.DefineTag,
 	tags.BlockTag,
@@ -66,11 +95,16 @@ var DefaultTemplateTags = []structure.TemplateTag{
 var DefaultEngineTags = []structure.TemplateTag{
 	tags.IfTag,
 	tags.EachTag,
+	tags.BreakTag,
+	tags.ContinueTag,
 	tags.PartialTag,
 	tags.CommentTag,
 	tags.DefineTag,
 	tags.BlockTag,
 	tags.ExtendsTag,
+	tags.SlotTag,
+	tags.ComponentTag,
+	tags.RenderSlotTag,
 	tags.LayoutTag,
 	tags.PassedTag,
 	//
@@ -83,6 +117,8 @@ var DefaultEngineTags = []structure.TemplateTag{
 	tags.JSTag,
 	tags.ImportTag,
 	tags.AssignTag,
+	tags.CSRFFieldTag,
+	tags.CSRFTokenTag,
 }
 
 func StartDefaultEngine() *structure.TemplateEngine {
@@ -90,75 +126,4 @@ func StartDefaultEngine() *structure.TemplateEngine {
 	return engine.Init(DefaultEngineTags, DefaultTemplateFilters)
 }
 
-func StartHttpServer(r http.Handler, engine structure.TemplateEngine) {
-	// Autocert manager
-	var domainWhiteList = []string{}
-	for domain := range maps.Keys(engine.SiteMap) {
-		if strings.Contains(domain, "localhost:") {
-			continue
-		}
-		domainWhiteList = append(domainWhiteList, domain)
-		dotCount := strings.Count(domain, ".")
-		if dotCount == 1 {
-			domainWhiteList = append(domainWhiteList, "www."+domain)
-		}
-	}
-
-	m := &autocert.Manager{
-		Prompt:     autocert.AcceptTOS,
-		HostPolicy: autocert.HostWhitelist(domainWhiteList...),
-		Email:      os.Getenv("ACME_CONTACT_EMAIL"),
-		Cache:      autocert.DirCache("/var/www/.cache"),
-		Client: &acme.Client{
-			DirectoryURL: os.Getenv("ACME_DIRECTORY_URL"),
-			HTTPClient: &http.Client{
-				Transport: &http.Transport{
-					TLSClientConfig: &tls.Config{
-						InsecureSkipVerify: true,
-					},
-				},
-			},
-		},
-	}
-
-	ENV := os.Getenv("ENV")
-	if strings.ToLower(ENV) == "PROD" {
-		// ---------------
-		//  PRODUCTION
-		// ---------------
-		// HTTP server for ACME challenges
-		go func() {
-			log.Println("Starting HTTP server on :80")
-			err := http.ListenAndServe(":80", m.HTTPHandler(http.NotFoundHandler()))
-			if err != nil {
-				log.Fatalf("HTTP server error: %v", err)
-			}
-		}()
-
-		// HTTPS server
-		srv := &http.Server{
-			Addr:    ":443",
-			Handler: r,
-			TLSConfig: &tls.Config{
-				GetCertificate: m.GetCertificate,
-				MinVersion:     tls.VersionTLS12,
-			},
-		}
-		log.Println("Running in PROD mode")
-		log.Println("Starting HTTPS server on :443")
-		log.Fatal(srv.ListenAndServeTLS("", ""))
-	} else {
-		// ---------------
-		//  Develop / Local
-		// ---------------
-		srv := &http.Server{
-			Addr:    ":8080",
-			Handler: r,
-		}
-		log.Println("Running in DEV mode")
-		log.Println("Starting HTTPS server on :8080")
-		log.Fatal(srv.ListenAndServe())
-	}
-}
-
 var Render = core.Render
@@ -0,0 +1,105 @@
+package template
+
+import (
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// fileState is what the watcher compares between polls
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// WatchSites polls the sites directory for development. Sites with added, changed or removed files are rebuilt
+// in engine.Sites, new site folders are added and deleted ones removed, then browsers showing the site reload.
+// Polling keeps it free of platform specific file events. Call the returned function to stop watching
+func WatchSites(engine *structure.TemplateEngine, interval time.Duration) (stop func()) {
+	snapshots := snapshotSites(engine)
+	done := make(chan struct{})
+	LiveReload.setActive(true)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			current := snapshotSites(engine)
+			for domain, files := range current {
+				previous, known := snapshots[domain]
+				if known && maps.Equal(previous, files) {
+					continue
+				}
+				slog.Info("Rebuilding site", "domain", domain)
+				RebuildSite(engine, domain)
+				LiveReload.Reload(domain)
+			}
+			for domain := range snapshots {
+				if _, exists := current[domain]; !exists {
+					slog.Info("Removing site", "domain", domain)
+					engine.Sites.Remove(domain)
+					engine.Templates.InvalidateSite(domain)
+					engine.Pages.PurgeSite(domain)
+				}
+			}
+			snapshots = current
+		}
+	}()
+
+	return func() {
+		LiveReload.setActive(false)
+		close(done)
+	}
+}
+
+// RebuildSite reads a site folder again and swaps it into engine.Sites with its templates parsed anew.
+// Cached pages of the site are purged, a site whose folder or config is gone is removed
+func RebuildSite(engine *structure.TemplateEngine, domain string) {
+	site, ok := buildSite(engine, domain)
+	if !ok {
+		engine.Sites.Remove(domain)
+		engine.Templates.InvalidateSite(domain)
+		engine.Pages.PurgeSite(domain)
+		return
+	}
+	engine.Sites.Set(site)
+	engine.Pages.PurgeSite(domain)
+}
+
+// snapshotSites records the files of every site folder
+func snapshotSites(engine *structure.TemplateEngine) map[string]map[string]fileState {
+	snapshots := make(map[string]map[string]fileState)
+	entries, err := os.ReadDir(engine.SITES_DIR)
+	if err != nil {
+		slog.Error("Failed to read sites directory", "path", engine.SITES_DIR, "error", err)
+		return snapshots
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		files := make(map[string]fileState)
+		siteFolderPath := filepath.Join(engine.SITES_DIR, entry.Name())
+		filepath.WalkDir(siteFolderPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				files[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+			}
+			return nil
+		})
+		snapshots[entry.Name()] = files
+	}
+	return snapshots
+}
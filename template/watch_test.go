@@ -0,0 +1,125 @@
+package template
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitFor polls check until it holds or the watcher had plenty of time to act
+func waitFor(t *testing.T, what string, check func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatchSites(t *testing.T) {
+	// production keeps parsed templates until they are invalidated, so changes show only through the rebuild
+	t.Setenv("ENV", "production")
+	engine := buildTestSite(t, "example.com", map[string]string{
+		"config.toml":        `domain = "example.com"`,
+		"layouts/root.hstm":  `{% passed %}`,
+		"partials/card.hstm": `card`,
+		"pages/page.hstm":    `home {% partial "card" %}`,
+	})
+	render := func(domain string) string {
+		var out strings.Builder
+		if _, err := renderTestRoute(t, engine, domain, "/", &out); err != nil {
+			return err.Error()
+		}
+		return out.String()
+	}
+	write := func(name, content string) {
+		path := filepath.Join(engine.SITES_DIR, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// a later modification time, so the change is seen without waiting for the clock
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(path, later, later)
+	}
+	if got := render("example.com"); got != "home card" {
+		t.Fatalf("page = %q", got)
+	}
+
+	// a browser showing the site
+	events := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LiveReload.ServeSite(w, r, "example.com")
+	}))
+	defer events.Close()
+	res, err := http.Get(events.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	stream := bufio.NewReader(res.Body)
+	if line, err := stream.ReadString('\n'); err != nil || line != ": connected\n" {
+		t.Fatalf("live reload stream = %q, %v", line, err)
+	}
+
+	stop := WatchSites(engine, 10*time.Millisecond)
+	defer func() { stop() }()
+	if !LiveReload.Active() {
+		t.Errorf("live reload is not active while watching")
+	}
+
+	// a changed partial rebuilds the site, its cached templates are parsed again and the browser reloads
+	write("example.com/partials/card.hstm", `new card`)
+	reloaded := make(chan string, 1)
+	go func() {
+		for {
+			line, err := stream.ReadString('\n')
+			if err != nil || strings.HasPrefix(line, "event: ") {
+				reloaded <- line
+				return
+			}
+		}
+	}()
+	select {
+	case line := <-reloaded:
+		if line != "event: reload\n" {
+			t.Errorf("live reload event = %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload event after a change")
+	}
+	waitFor(t, "the changed partial", func() bool { return render("example.com") == "home new card" })
+
+	// new site folders are added and deleted ones removed
+	write("other.com/config.toml", `domain = "other.com"`)
+	write("other.com/layouts/root.hstm", `{% passed %}`)
+	write("other.com/pages/page.hstm", `other`)
+	waitFor(t, "the new site", func() bool {
+		_, ok := engine.Sites.Get("other.com")
+		return ok
+	})
+	if got := render("other.com"); got != "other" {
+		t.Errorf("new site page = %q", got)
+	}
+	if err := os.RemoveAll(filepath.Join(engine.SITES_DIR, "other.com")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the deleted site to be removed", func() bool {
+		_, ok := engine.Sites.Get("other.com")
+		return !ok
+	})
+
+	stop()
+	stop = func() {}
+	if LiveReload.Active() {
+		t.Errorf("live reload is still active after stop")
+	}
+}
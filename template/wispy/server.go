@@ -0,0 +1,213 @@
+// Package wispy serves the sites of a template engine over HTTP through a chain of stages.
+//
+//	server := wispy.NewServer(engine)
+//	server.Replace(wispy.StageSessions, auth.Sessions(sessionsDB, usersDB))
+//	server.Use(wispy.Stage{Name: "log", Middleware: logRequests})
+//	server.HandleFunc("example.com", "POST /api/subscribe", subscribe)
+//	template.StartHttpServer(server, engine)
+package wispy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/kato-studio/wispy/wispy_common/structure"
+)
+
+// Names of the built-in stages, in the order requests pass them
+const (
+	// Recovers panics of later stages and answers with the 500 error page of the site
+	StageErrors = "errors"
+	// Finds the site of the request host, unknown hosts get a 404
+	StageHost = "host"
+	// Serves files of the site's public folder
+	StageStatic = "static"
+	// Attaches the session of the visitor, replaced by a stage such as auth.Sessions
+	StageSessions = "sessions"
+	// Rejects unsafe requests without the CSRF token of the visitor
+	StageCSRF = "csrf"
+	// Runs handlers mounted with Handle, or renders the page of the route
+	StageRender = "render"
+)
+
+// Stage is one step of the request chain, Middleware calls next to hand the request on
+type Stage struct {
+	Name       string
+	Middleware func(next http.Handler) http.Handler
+}
+
+// Server is an http.Handler serving the sites of an engine through its stages
+type Server struct {
+	Engine *structure.TemplateEngine
+
+	mu     sync.RWMutex
+	stages []Stage
+	// Go handlers mounted per domain, "" for every site
+	mounts map[string]*http.ServeMux
+	// the stages composed, built again when they change
+	handler http.Handler
+}
+
+// NewServer returns a Server with the built-in stages. The sessions stage attaches no session until it is replaced
+func NewServer(engine *structure.TemplateEngine) *Server {
+	server := &Server{Engine: engine, mounts: make(map[string]*http.ServeMux)}
+	server.stages = []Stage{
+		{StageErrors, server.recoverErrors},
+		{StageHost, server.resolveHost},
+		{StageStatic, server.serveStatic},
+		{StageSessions, func(next http.Handler) http.Handler { return next }},
+		{StageCSRF, server.checkCSRF},
+		{StageRender, server.render},
+	}
+	server.build()
+	return server
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mu.RLock()
+	handler := server.handler
+	server.mu.RUnlock()
+	handler.ServeHTTP(w, r)
+}
+
+// Stages returns the names of the stages in the order requests pass them
+func (server *Server) Stages() []string {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	names := make([]string, len(server.stages))
+	for i, stage := range server.stages {
+		names[i] = stage.Name
+	}
+	return names
+}
+
+// Use adds a stage right before the render stage, after the session and CSRF checks
+func (server *Server) Use(stage Stage) {
+	if err := server.InsertBefore(StageRender, stage); err != nil {
+		// the render stage was removed, the stage goes last
+		server.mu.Lock()
+		server.stages = append(server.stages, stage)
+		server.build()
+		server.mu.Unlock()
+	}
+}
+
+// InsertBefore adds a stage in front of the named stage
+func (server *Server) InsertBefore(name string, stage Stage) error {
+	return server.edit(name, func(i int) { server.stages = slices.Insert(server.stages, i, stage) })
+}
+
+// InsertAfter adds a stage behind the named stage
+func (server *Server) InsertAfter(name string, stage Stage) error {
+	return server.edit(name, func(i int) { server.stages = slices.Insert(server.stages, i+1, stage) })
+}
+
+// Replace swaps the named stage for another, such as the sessions stage for auth.Sessions
+func (server *Server) Replace(name string, stage Stage) error {
+	return server.edit(name, func(i int) { server.stages[i] = stage })
+}
+
+// Remove drops the named stage, such as the CSRF check for a site only serving an API with bearer tokens
+func (server *Server) Remove(name string) error {
+	return server.edit(name, func(i int) { server.stages = slices.Delete(server.stages, i, i+1) })
+}
+
+// edit changes the stages at the position of the named stage and composes them again
+func (server *Server) edit(name string, change func(i int)) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	i := slices.IndexFunc(server.stages, func(stage Stage) bool { return stage.Name == name })
+	if i < 0 {
+		return fmt.Errorf("no stage named %q", name)
+	}
+	change(i)
+	server.build()
+	return nil
+}
+
+// build composes the stages so the first stage sees requests first
+func (server *Server) build() {
+	var handler http.Handler = http.NotFoundHandler()
+	for _, stage := range slices.Backward(server.stages) {
+		handler = stage.Middleware(handler)
+	}
+	server.handler = handler
+}
+
+// Handle mounts a Go handler at a pattern of a site, next to its .hstm pages. Patterns follow http.ServeMux,
+// such as "/api/" or "POST /api/items/{id}", and take precedence over pages. An empty domain mounts it on every site
+func (server *Server) Handle(domain, pattern string, handler http.Handler) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	mux, ok := server.mounts[domain]
+	if !ok {
+		mux = http.NewServeMux()
+		server.mounts[domain] = mux
+	}
+	mux.Handle(pattern, handler)
+}
+
+// HandleFunc mounts a handler function, see Handle
+func (server *Server) HandleFunc(domain, pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	server.Handle(domain, pattern, http.HandlerFunc(handler))
+}
+
+// mounted returns the mux with a handler for the request, handlers of the site win over those of every site.
+// The mux serves the request itself so the handler gets the path values of its pattern
+func (server *Server) mounted(domain string, r *http.Request) (http.Handler, bool) {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	for _, key := range []string{domain, ""} {
+		if mux, ok := server.mounts[key]; ok {
+			if _, pattern := mux.Handler(r); pattern != "" {
+				return mux, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Session is the visitor of a request as attached by the sessions stage
+type Session struct {
+	// Empty for visitors who are not logged in
+	UserID string
+	// Roles of the user, filled when a page is cached per role
+	Roles []string
+	// Database the user comes from, used by tags such as restricted-by-role
+	UsersDB *sql.DB
+}
+
+type requestKey int
+
+const (
+	siteKey requestKey = iota
+	sessionKey
+	csrfKey
+)
+
+// RequestSite returns the site resolved by the host stage
+func RequestSite(r *http.Request) (*structure.SiteStructure, bool) {
+	site, ok := r.Context().Value(siteKey).(*structure.SiteStructure)
+	return site, ok
+}
+
+// RequestSession returns the session attached by the sessions stage, the zero Session for visitors without one
+func RequestSession(r *http.Request) Session {
+	session, _ := r.Context().Value(sessionKey).(Session)
+	return session
+}
+
+// WithSession attaches a session to a request, for use by sessions stages
+func WithSession(r *http.Request, session Session) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionKey, session))
+}
+
+// CSRFToken returns the CSRF token of the visitor set by the csrf stage
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfKey).(string)
+	return token
+}
@@ -0,0 +1,229 @@
+package wispy_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kato-studio/wispy/template"
+	"github.com/kato-studio/wispy/template/tags"
+	"github.com/kato-studio/wispy/template/wispy"
+)
+
+// newTestServer builds example.com and other.com from files and serves them with the built-in stages
+func newTestServer(t *testing.T) *wispy.Server {
+	t.Helper()
+	sitesDir := t.TempDir()
+	files := map[string]string{
+		"example.com/config.toml":          `domain = "example.com"`,
+		"example.com/layouts/root.hstm":    `{% passed %}`,
+		"example.com/pages/page.hstm":      `home`,
+		"example.com/public/robots.txt":    "User-agent: *",
+		"example.com/secret.txt":           "top secret contents",
+		"other.com/config.toml":            `domain = "other.com"`,
+		"other.com/layouts/root.hstm":      `{% passed %}`,
+		"other.com/pages/page.hstm":        `other home`,
+		"other.com/pages/api/page.hstm":    `other api page`,
+		"example.com/pages/form/page.hstm": `{% csrf-field %}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(sitesDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine := template.StartDefaultEngine()
+	engine.SITES_DIR = sitesDir
+	template.BuildSiteMap(engine)
+	return wispy.NewServer(engine)
+}
+
+func serve(server *wispy.Server, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	return w
+}
+
+// trace returns a stage that records its name in calls before handing the request on
+func trace(name string, calls *[]string) wispy.Stage {
+	return wispy.Stage{Name: name, Middleware: func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*calls = append(*calls, name)
+			next.ServeHTTP(w, r)
+		})
+	}}
+}
+
+func TestServerStages(t *testing.T) {
+	server := newTestServer(t)
+	want := []string{wispy.StageErrors, wispy.StageHost, wispy.StageStatic, wispy.StageSessions, wispy.StageCSRF, wispy.StageRender}
+	if got := server.Stages(); !slices.Equal(got, want) {
+		t.Fatalf("Stages() = %v, want %v", got, want)
+	}
+
+	var calls []string
+	server.Use(trace("used", &calls))
+	if err := server.InsertBefore(wispy.StageHost, trace("before-host", &calls)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.InsertAfter(wispy.StageHost, trace("after-host", &calls)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Replace(wispy.StageSessions, trace("sessions", &calls)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Remove(wispy.StageStatic); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"errors", "before-host", "host", "after-host", "sessions", "csrf", "used", "render"}
+	if got := server.Stages(); !slices.Equal(got, want) {
+		t.Errorf("Stages() after edits = %v, want %v", got, want)
+	}
+
+	// requests pass the stages in order
+	w := serve(server, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "home") {
+		t.Errorf("GET / = %d %q", w.Code, w.Body.String())
+	}
+	if want := []string{"before-host", "after-host", "sessions", "used"}; !slices.Equal(calls, want) {
+		t.Errorf("stages called = %v, want %v", calls, want)
+	}
+
+	// unknown hosts end at the host stage
+	calls = nil
+	if w := serve(server, httptest.NewRequest(http.MethodGet, "http://missing.com/", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("GET of an unknown host = %d, want 404", w.Code)
+	}
+	if want := []string{"before-host"}; !slices.Equal(calls, want) {
+		t.Errorf("stages called for an unknown host = %v, want %v", calls, want)
+	}
+
+	for _, err := range []error{
+		server.InsertBefore("missing", trace("x", &calls)),
+		server.InsertAfter("missing", trace("x", &calls)),
+		server.Replace("missing", trace("x", &calls)),
+		server.Remove("missing"),
+	} {
+		if err == nil || !strings.Contains(err.Error(), `no stage named "missing"`) {
+			t.Errorf("edit of a missing stage error = %v", err)
+		}
+	}
+}
+
+func TestServerHandle(t *testing.T) {
+	server := newTestServer(t)
+	server.HandleFunc("example.com", "GET /api/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "item "+r.PathValue("id"))
+	})
+	server.HandleFunc("", "GET /api/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "every site")
+	})
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://example.com/api/items/7", "item 7"},
+		{"http://example.com/api/other", "every site"},
+		{"http://other.com/api/items/7", "every site"},
+		// mounted handlers win over pages
+		{"http://other.com/api/", "every site"},
+		{"http://example.com/", "home"},
+		{"http://other.com/", "other home"},
+	}
+	for _, tt := range tests {
+		w := serve(server, httptest.NewRequest(http.MethodGet, tt.url, nil))
+		if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != tt.want {
+			t.Errorf("GET %s = %d %q, want %q", tt.url, w.Code, w.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestServeStatic(t *testing.T) {
+	server := newTestServer(t)
+	w := serve(server, httptest.NewRequest(http.MethodGet, "http://example.com/robots.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "User-agent: *" {
+		t.Errorf("GET /robots.txt = %d %q", w.Code, w.Body.String())
+	}
+
+	// paths are cleaned so they can't leave the public folder
+	for _, path := range []string{"/../secret.txt", "/%2e%2e/secret.txt", "/..%2fsecret.txt", "/a/../../secret.txt"} {
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		r.URL = &url.URL{Path: mustUnescape(t, path), RawPath: path}
+		w := serve(server, r)
+		if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "top secret contents") {
+			t.Errorf("GET %s served a file outside the public folder: %d %q", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func mustUnescape(t *testing.T, path string) string {
+	t.Helper()
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return unescaped
+}
+
+func TestServerCSRF(t *testing.T) {
+	server := newTestServer(t)
+	server.HandleFunc("example.com", "POST /submit", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "sent")
+	})
+
+	// GET passes and sets the token cookie the form field carries
+	w := serve(server, httptest.NewRequest(http.MethodGet, "http://example.com/form", nil))
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Name != wispy.CSRFCookieName {
+		t.Fatalf("GET /form = %d, cookies %v", w.Code, cookies)
+	}
+	token := cookies[0].Value
+	if !strings.Contains(w.Body.String(), `name="`+tags.CSRFFieldName+`" value="`+token+`"`) {
+		t.Errorf("form field = %q, want the token of the cookie", w.Body.String())
+	}
+
+	post := func(cookie, header string, form url.Values) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "http://example.com/submit", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: wispy.CSRFCookieName, Value: cookie})
+		}
+		if header != "" {
+			r.Header.Set(wispy.CSRFHeaderName, header)
+		}
+		return r
+	}
+	tests := []struct {
+		name   string
+		r      *http.Request
+		status int
+	}{
+		{"no token", post(token, "", nil), http.StatusForbidden},
+		{"no cookie", post("", token, nil), http.StatusForbidden},
+		{"header", post(token, token, nil), http.StatusOK},
+		{"form field", post(token, "", url.Values{tags.CSRFFieldName: {token}}), http.StatusOK},
+		{"mismatched cookie", post("other", token, nil), http.StatusForbidden},
+		{"mismatched form field", post(token, "", url.Values{tags.CSRFFieldName: {"other"}}), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if w := serve(server, tt.r); w.Code != tt.status {
+			t.Errorf("POST with %s = %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+
+	// without the csrf stage unsafe requests are not checked
+	server.Remove(wispy.StageCSRF)
+	if w := serve(server, post("", "", nil)); w.Code != http.StatusOK {
+		t.Errorf("POST without the csrf stage = %d, want 200", w.Code)
+	}
+}
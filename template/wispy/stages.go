@@ -0,0 +1,165 @@
+package wispy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/kato-studio/wispy/template"
+	"github.com/kato-studio/wispy/template/core"
+	"github.com/kato-studio/wispy/template/tags"
+	common "github.com/kato-studio/wispy/wispy_common"
+)
+
+const (
+	// Cookie holding the CSRF token of the visitor
+	CSRFCookieName = "wispy_csrf"
+	// Header scripts send the CSRF token in, forms use the csrf_token field written by {% csrf-field %}
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// recoverErrors answers a request whose stages panicked with the 500 error page of its site
+func (server *Server) recoverErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				slog.Error("Request failed", "host", r.Host, "path", r.URL.Path, "error", recovered)
+				site, ok := server.Engine.Sites.Lookup(r.Host)
+				if !ok {
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+				ctx := server.Engine.InitCtx(filepath.Join(server.Engine.SITES_DIR, site.Domain), site, nil)
+				ctx.Request, ctx.ResponseWriter = r, &w
+				template.WriteErrorPage(ctx, w, http.StatusInternalServerError, fmt.Errorf("%v", recovered))
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// resolveHost finds the site of the request host, browsers of watched sites are answered with reload events
+func (server *Server) resolveHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site, exists := server.Engine.Sites.Lookup(r.Host)
+		if !exists {
+			http.Error(w, fmt.Sprintf("domain %s not found", r.Host), http.StatusNotFound)
+			return
+		}
+		// Pages rendered while sites are watched listen here for rebuilds
+		if r.URL.Path == template.LiveReloadPath && template.LiveReload.Active() {
+			template.LiveReload.ServeSite(w, r, site.Domain)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), siteKey, site)))
+	})
+}
+
+// serveStatic serves files of the public folder for paths with an extension, and the essential files
+// such as favicon.ico from public/essential at any path
+func (server *Server) serveStatic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site, _ := RequestSite(r)
+		if site == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		publicDir := filepath.Join(server.Engine.SITES_DIR, site.Domain, site.Config.Assets.PublicDir)
+		// cleaned as an absolute path so it can't leave the public folder
+		requestPath := path.Clean("/" + r.URL.Path)
+
+		target := ""
+		if _, essential := core.ESSENTIAL_SERVE[path.Base(requestPath)]; essential {
+			target = filepath.Join(publicDir, "essential", path.Base(requestPath))
+		} else if path.Ext(requestPath) != "" {
+			target = filepath.Join(publicDir, filepath.FromSlash(requestPath))
+		}
+		if target != "" {
+			if info, err := os.Stat(target); err == nil && !info.IsDir() {
+				if site.Config.Cache.Public != "" {
+					w.Header().Set("Cache-Control", site.Config.Cache.Public)
+				}
+				http.ServeFile(w, r, target)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkCSRF gives every visitor a CSRF token cookie and rejects POST, PUT, PATCH and DELETE requests
+// that don't send it back in the X-CSRF-Token header or the csrf_token form field
+func (server *Server) checkCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if cookie, err := r.Cookie(CSRFCookieName); err == nil && cookie.Value != "" {
+			token = cookie.Value
+		} else {
+			token = newCSRFToken()
+			http.SetCookie(w, &http.Cookie{
+				Name:     CSRFCookieName,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   common.IsProduction(),
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		default:
+			sent := r.Header.Get(CSRFHeaderName)
+			if sent == "" {
+				sent = r.PostFormValue(tags.CSRFFieldName)
+			}
+			if sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				http.Error(w, "invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfKey, token)))
+	})
+}
+
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// render runs the handler mounted for the request, or renders the page of the route with the session and CSRF token
+func (server *Server) render(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site, ok := RequestSite(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if handler, ok := server.mounted(site.Domain, r); ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		engine := server.Engine
+		data := map[string]any{}
+		ctx := engine.InitCtx(filepath.Join(engine.SITES_DIR, site.Domain), site, data)
+		session := RequestSession(r)
+		ctx.UserID, ctx.UserRoles, ctx.UsersDB = session.UserID, session.Roles, session.UsersDB
+		ctx.CSRFToken = CSRFToken(r)
+
+		if err := template.ServeRoute(engine, ctx, data, w, r); err != nil {
+			slog.Error("Failed to render route", "host", r.Host, "path", r.URL.Path, "error", err)
+		}
+	})
+}
@@ -54,24 +54,48 @@ func ParseKeyValuePairs(pairs []string) map[string]string {
 	return options
 }
 
+// ParseDataPath walks a dotted path through nested maps and lists, numeric parts index into lists.
+// returns nil when any part of the path does not exist
 func ParseDataPath(parts []string, value any) any {
-	var current_val any
-	var exists bool
 	for _, part := range parts {
 		if part == "" {
 			continue // Skip empty parts (e.g., leading dot).
 		}
-		// Check if the current value is a map.
-		if m, ok := value.(map[string]any); ok {
-			if current_val, exists = m[part]; exists {
-				value = current_val
-			} else {
-				// Variable not found in Props, fall back to Data.
+		switch current := value.(type) {
+		case map[string]any:
+			next, exists := current[part]
+			if !exists {
+				return nil
+			}
+			value = next
+		case []any:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(current) {
+				return nil
+			}
+			value = current[index]
+		default:
+			// Fall back to reflection for typed maps and slices (e.g. []map[string]any from queries)
+			rv := reflect.ValueOf(value)
+			switch rv.Kind() {
+			case reflect.Map:
+				if rv.Type().Key().Kind() != reflect.String {
+					return nil
+				}
+				next := rv.MapIndex(reflect.ValueOf(part).Convert(rv.Type().Key()))
+				if !next.IsValid() {
+					return nil
+				}
+				value = next.Interface()
+			case reflect.Slice, reflect.Array:
+				index, err := strconv.Atoi(part)
+				if err != nil || index < 0 || index >= rv.Len() {
+					return nil
+				}
+				value = rv.Index(index).Interface()
+			default:
 				return nil
 			}
-		} else {
-			// Invalid path in Props, fall back to Data.
-			return nil
 		}
 	}
 	return value
@@ -0,0 +1,137 @@
+package structure
+
+import (
+	"sync"
+	"time"
+)
+
+// NodeType identifies what a parsed template node represents.
+type NodeType int
+
+const (
+	// Literal text written to the output as-is
+	TextNode NodeType = iota
+	// Output statements such as "{% .title | upcase %}"
+	OutputNode
+	// Tag statements such as "{% partial "nav" %}", block tags hold their body in Children
+	TagNode
+)
+
+// TagKind tells the parser how the body of a tag is collected.
+type TagKind int
+
+const (
+	// Tags without a body, "{% name ... %}"
+	KindInline TagKind = iota
+	// Tags with a parsed body closed by "{% end-name %}"
+	KindBlock
+	// Tags with a body that is kept as unparsed text until "{% end-name %}" (comment, css, js)
+	KindRaw
+	// Tags whose body runs to "{% end-name %}" when present, otherwise to the end of the enclosing body (layout, extends)
+	KindRest
+	// Tags with a parsed body closed by "{% end-name %}" when present, otherwise they have no body (render-slot)
+	KindOptional
+)
+
+// EscapeContext is where an output node sits in the surrounding HTML, which decides how its value is escaped.
+type EscapeContext int
+
+const (
+	// Element text such as "<p>{% .name %}</p>"
+	EscapeHTML EscapeContext = iota
+	// Quoted attribute values such as class="{% .class %}"
+	EscapeAttr
+	// Unquoted attribute values, whitespace is escaped as well
+	EscapeAttrUnquoted
+	// The start of a URL attribute (href, src, ...), unsafe schemes such as "javascript:" are rejected
+	EscapeURL
+	// The query string of a URL attribute
+	EscapeURLQuery
+	// Inside a quoted string in a script or an event handler attribute
+	EscapeJSString
+	// A bare value in a script, written as JSON
+	EscapeJSValue
+	// Inside a style element
+	EscapeCSS
+)
+
+// SafeHTML marks trusted content that is written without escaping, returned by the "raw" filter.
+type SafeHTML string
+
+// EscapedHTML is text already escaped for HTML, returned by the "escape" filter. Auto-escaping writes it as the
+// original text escaped for where it lands, so it is escaped once in HTML and never trusted in URLs or scripts
+type EscapedHTML string
+
+// Node is a single element of a parsed template.
+type Node struct {
+	Type NodeType
+	// Tag name, empty for text and output nodes
+	Name string
+	// Literal text, the output expression or the tag contents following the tag name
+	Content string
+	// Byte offset of the node within the template source
+	Pos int
+	// Template the node was parsed from, used to locate errors
+	Template *Template
+	// How the value of an output node is escaped
+	Escape EscapeContext
+	// Body of block tags, raw tags hold a single text node
+	Children []*Node
+	// Clauses splitting the body of a block tag such as "else-if" and "else", each with their own Children
+	Branches []*Node
+}
+
+// Template is the parsed form of a template file.
+type Template struct {
+	Path   string
+	Source string
+	Nodes  []*Node
+	// Errors found while parsing, reported every time the template is executed
+	Errors []error
+	// Modification time of the source file when it was parsed
+	ModTime time.Time
+}
+
+// TemplateCache stores parsed templates per site so they are only read and parsed once.
+type TemplateCache struct {
+	mu    sync.RWMutex
+	sites map[string]map[string]*Template
+}
+
+func NewTemplateCache() *TemplateCache {
+	return &TemplateCache{sites: make(map[string]map[string]*Template)}
+}
+
+// Get returns the cached template for the given site and file path.
+func (c *TemplateCache) Get(site, path string) (*Template, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	tmpl, ok := c.sites[site][path]
+	return tmpl, ok
+}
+
+// Set stores a parsed template for the given site, keyed by its path.
+func (c *TemplateCache) Set(site string, tmpl *Template) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	templates, ok := c.sites[site]
+	if !ok {
+		templates = make(map[string]*Template)
+		c.sites[site] = templates
+	}
+	templates[tmpl.Path] = tmpl
+}
+
+// Invalidate drops a single template from a site's cache.
+func (c *TemplateCache) Invalidate(site, path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sites[site], path)
+}
+
+// InvalidateSite drops every cached template of a site.
+func (c *TemplateCache) InvalidateSite(site string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sites, site)
+}
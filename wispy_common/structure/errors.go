@@ -0,0 +1,189 @@
+package structure
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors wrapped by references to things that do not exist, handled according to the UndefinedMode
+var (
+	ErrUndefinedVariable = errors.New("undefined variable")
+	ErrUnknownFilter     = errors.New("unknown filter")
+	ErrUnknownTag        = errors.New("unknown tag")
+)
+
+// IsUndefined reports whether err is an undefined variable, unknown filter or unknown tag error
+func IsUndefined(err error) bool {
+	return errors.Is(err, ErrUndefinedVariable) || errors.Is(err, ErrUnknownFilter) || errors.Is(err, ErrUnknownTag)
+}
+
+// UndefinedMode controls how undefined variables, unknown filters and unknown tags are handled
+type UndefinedMode int
+
+const (
+	// Report the error and keep rendering, undefined values render empty
+	UndefinedLenient UndefinedMode = iota
+	// Abort the render, the request is answered with the 500 error page of the site
+	UndefinedStrict
+	// Render undefined values empty without reporting anything
+	UndefinedSilent
+)
+
+func (mode UndefinedMode) String() string {
+	switch mode {
+	case UndefinedStrict:
+		return "strict"
+	case UndefinedSilent:
+		return "silent"
+	}
+	return "lenient"
+}
+
+// UnmarshalText reads "strict", "lenient" or "silent" so the mode can be set in config.toml
+func (mode *UndefinedMode) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "lenient", "":
+		*mode = UndefinedLenient
+	case "strict":
+		*mode = UndefinedStrict
+	case "silent":
+		*mode = UndefinedSilent
+	default:
+		return fmt.Errorf("invalid undefined mode %q, expected strict, lenient or silent", text)
+	}
+	return nil
+}
+
+// TemplateError is an error raised while parsing or rendering a template, located in the template source.
+type TemplateError struct {
+	Path   string
+	Line   int
+	Column int
+	// Name of the tag that failed, empty for output statements
+	Tag string
+	// Source lines around the error with a caret under the column
+	Snippet string
+	// Templates the failing one was included from, innermost first (partial -> layout -> page)
+	Chain []TemplateFrame
+	Err   error
+}
+
+// TemplateFrame is a tag that included another template, such as a partial, layout or component.
+type TemplateFrame struct {
+	Path   string
+	Line   int
+	Column int
+	Tag    string
+}
+
+// NewTemplateError locates err at the byte offset pos of a parsed template
+func NewTemplateError(tmpl *Template, pos int, tag string, err error) *TemplateError {
+	te := &TemplateError{Tag: tag, Err: err}
+	if tmpl == nil {
+		return te
+	}
+	te.Path = tmpl.Path
+	te.Line, te.Column = tmpl.Location(pos)
+	te.Snippet = snippet(tmpl.Source, te.Line, te.Column)
+	return te
+}
+
+// Location converts a byte offset into a 1-based line and column, columns count characters
+func (tmpl *Template) Location(pos int) (line, column int) {
+	pos = min(max(pos, 0), len(tmpl.Source))
+	before := tmpl.Source[:pos]
+	line = strings.Count(before, "\n") + 1
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	return line, utf8.RuneCountInString(before[lineStart:]) + 1
+}
+
+func (e *TemplateError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Where())
+	sb.WriteString(": ")
+	if e.Tag != "" {
+		sb.WriteString(e.Tag + ": ")
+	}
+	if e.Err != nil {
+		sb.WriteString(e.Err.Error())
+	}
+	return sb.String()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// Where returns "path:line:column"
+func (e *TemplateError) Where() string {
+	path := e.Path
+	if path == "" {
+		path = "<template>"
+	}
+	if e.Line == 0 {
+		return path
+	}
+	return path + ":" + strconv.Itoa(e.Line) + ":" + strconv.Itoa(e.Column)
+}
+
+// IncludedFrom adds the tag that included the failing template to the chain
+func (e *TemplateError) IncludedFrom(frame TemplateFrame) {
+	e.Chain = append(e.Chain, frame)
+}
+
+// Detail returns the error followed by the source snippet and the include chain
+func (e *TemplateError) Detail() string {
+	var sb strings.Builder
+	sb.WriteString(e.Error())
+	if e.Snippet != "" {
+		sb.WriteString("\n")
+		sb.WriteString(e.Snippet)
+	}
+	for _, frame := range e.Chain {
+		fmt.Fprintf(&sb, "\n  included by %q at %s:%d:%d", frame.Tag, frame.Path, frame.Line, frame.Column)
+	}
+	return sb.String()
+}
+
+// snippet returns the line before, the failing line and a caret under the column
+func snippet(source string, line, column int) string {
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	first := max(line-1, 1)
+	width := len(strconv.Itoa(line))
+	var sb strings.Builder
+	for n := first; n <= line; n++ {
+		fmt.Fprintf(&sb, "%*d | %s\n", width, n, strings.TrimRight(lines[n-1], "\r"))
+	}
+	// keep tabs so the caret lines up with the source
+	prefix := []rune(lines[line-1])[:min(column-1, utf8.RuneCountInString(lines[line-1]))]
+	var indent strings.Builder
+	for _, r := range prefix {
+		if r == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteByte(' ')
+		}
+	}
+	fmt.Fprintf(&sb, "%*s | %s^", width, "", indent.String())
+	return sb.String()
+}
+
+// StatusError ends a request with an HTTP error status, answered with the error page of the status
+type StatusError struct {
+	Status int
+	Err    error
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
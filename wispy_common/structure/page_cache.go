@@ -0,0 +1,224 @@
+package structure
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// CachedPage is a rendered page stored by the PageCache
+type CachedPage struct {
+	// Cache key built from the route and the parts of the request the page varies on
+	Key    string
+	Domain string
+	// Request path the page was rendered for, used by PurgeRoute
+	Route string
+	// Names used by PurgeTag, such as "blog"
+	Tags []string
+	Body []byte
+	// The page is fresh until Expires, then served stale while it is rendered again until StaleUntil
+	Expires    time.Time
+	StaleUntil time.Time
+}
+
+// Fresh reports whether the page can be served without rendering it again
+func (page *CachedPage) Fresh(now time.Time) bool {
+	return now.Before(page.Expires)
+}
+
+// Usable reports whether the page can still be served, fresh or stale
+func (page *CachedPage) Usable(now time.Time) bool {
+	return now.Before(page.StaleUntil)
+}
+
+// PageCache stores rendered pages in memory, and optionally on disk so they survive restarts.
+type PageCache struct {
+	mu    sync.RWMutex
+	pages map[string]*CachedPage
+	// keys being rendered again in the background
+	revalidating map[string]bool
+	// Directory of the disk tier, pages stored with disk set are written to Dir/<domain>/
+	Dir string
+	// Memory entries kept before the ones expiring first are evicted
+	MaxEntries int
+}
+
+func NewPageCache(dir string) *PageCache {
+	return &PageCache{
+		pages:        make(map[string]*CachedPage),
+		revalidating: make(map[string]bool),
+		Dir:          dir,
+		MaxEntries:   10000,
+	}
+}
+
+// Get returns a usable page from memory, disk also looks for it in the disk tier when it is not in memory,
+// the same as the disk of the Set that stored it
+func (c *PageCache) Get(domain, key string, disk bool) (*CachedPage, bool) {
+	now := time.Now()
+	c.mu.RLock()
+	page, ok := c.pages[key]
+	c.mu.RUnlock()
+	if ok && page.Usable(now) {
+		return page, true
+	}
+	if !disk {
+		return nil, false
+	}
+
+	page, ok = c.readDisk(domain, key)
+	if !ok || !page.Usable(now) {
+		return nil, false
+	}
+	c.mu.Lock()
+	c.setMemory(page)
+	c.mu.Unlock()
+	return page, true
+}
+
+// Set stores a page, disk also writes it to the disk tier when Dir is set
+func (c *PageCache) Set(page *CachedPage, disk bool) {
+	c.mu.Lock()
+	c.setMemory(page)
+	c.mu.Unlock()
+	if disk && c.Dir != "" {
+		c.writeDisk(page)
+	}
+}
+
+// setMemory stores a page in memory, making room by dropping pages that are no longer usable or expire first
+func (c *PageCache) setMemory(page *CachedPage) {
+	if _, exists := c.pages[page.Key]; !exists && c.MaxEntries > 0 && len(c.pages) >= c.MaxEntries {
+		now := time.Now()
+		var first *CachedPage
+		for key, cached := range c.pages {
+			if !cached.Usable(now) {
+				delete(c.pages, key)
+			} else if first == nil || cached.StaleUntil.Before(first.StaleUntil) {
+				first = cached
+			}
+		}
+		if len(c.pages) >= c.MaxEntries && first != nil {
+			delete(c.pages, first.Key)
+		}
+	}
+	c.pages[page.Key] = page
+}
+
+// StartRevalidate claims the background render of a stale page, false when it is already running
+func (c *PageCache) StartRevalidate(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.revalidating[key] {
+		return false
+	}
+	c.revalidating[key] = true
+	return true
+}
+
+// EndRevalidate releases a key claimed with StartRevalidate
+func (c *PageCache) EndRevalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.revalidating, key)
+}
+
+// PurgeRoute drops every cached variant of a request path, such as "/blog/first-post"
+func (c *PageCache) PurgeRoute(domain, route string) int {
+	return c.purge(domain, func(page *CachedPage) bool { return page.Domain == domain && page.Route == route })
+}
+
+// PurgeSite drops every cached page of a site
+func (c *PageCache) PurgeSite(domain string) int {
+	return c.purge(domain, func(page *CachedPage) bool { return page.Domain == domain })
+}
+
+// PurgeTag drops the cached pages of every site stored with the tag
+func (c *PageCache) PurgeTag(tag string) int {
+	return c.purge("", func(page *CachedPage) bool { return slices.Contains(page.Tags, tag) })
+}
+
+// purge drops the pages in memory and on disk matched by drop, only the folder of domain is read from disk when set
+func (c *PageCache) purge(domain string, drop func(page *CachedPage) bool) (purged int) {
+	c.mu.Lock()
+	for key, page := range c.pages {
+		if drop(page) {
+			delete(c.pages, key)
+			purged++
+		}
+	}
+	c.mu.Unlock()
+
+	if c.Dir == "" {
+		return purged
+	}
+	root := c.Dir
+	if domain != "" {
+		root = filepath.Join(c.Dir, domain)
+	}
+	filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		page, ok := readPageFile(path)
+		if ok && drop(page) {
+			os.Remove(path)
+		}
+		return nil
+	})
+	return purged
+}
+
+// diskPath is where a page is stored on disk, keys are hashed as they hold paths and query values
+func (c *PageCache) diskPath(domain, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.Dir, filepath.Base(domain), hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *PageCache) readDisk(domain, key string) (*CachedPage, bool) {
+	if c.Dir == "" {
+		return nil, false
+	}
+	page, ok := readPageFile(c.diskPath(domain, key))
+	if !ok || page.Key != key {
+		return nil, false
+	}
+	return page, true
+}
+
+func (c *PageCache) writeDisk(page *CachedPage) {
+	path := c.diskPath(page.Domain, page.Key)
+	encoded, err := json.Marshal(page)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	}
+	if err == nil {
+		// written next to the target and renamed so readers never see half a page
+		err = os.WriteFile(path+".tmp", encoded, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		slog.Error("Failed to write cached page", "path", path, "error", err)
+	}
+}
+
+func readPageFile(path string) (*CachedPage, bool) {
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var page CachedPage
+	if err := json.Unmarshal(encoded, &page); err != nil {
+		return nil, false
+	}
+	return &page, true
+}
@@ -0,0 +1,130 @@
+package structure
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testPage(key, route string, ttl time.Duration, tags ...string) *CachedPage {
+	now := time.Now()
+	return &CachedPage{
+		Key:        key,
+		Domain:     "example.com",
+		Route:      route,
+		Tags:       tags,
+		Body:       []byte("<p>" + key + "</p>"),
+		Expires:    now.Add(ttl),
+		StaleUntil: now.Add(2 * ttl),
+	}
+}
+
+func TestPageCacheGet(t *testing.T) {
+	c := NewPageCache(t.TempDir())
+	c.Set(testPage("/a", "/a", time.Minute), false)
+
+	if page, ok := c.Get("example.com", "/a", false); !ok || string(page.Body) != "<p>/a</p>" {
+		t.Errorf("Get(/a) = %v, %v", page, ok)
+	}
+	if _, ok := c.Get("example.com", "/missing", false); ok {
+		t.Errorf("Get(/missing) found a page")
+	}
+
+	// stale pages are served until StaleUntil, then dropped
+	stale := testPage("/stale", "/stale", time.Minute)
+	stale.Expires = time.Now().Add(-time.Second)
+	c.Set(stale, false)
+	if page, ok := c.Get("example.com", "/stale", false); !ok || page.Fresh(time.Now()) {
+		t.Errorf("stale page: %v, %v", page, ok)
+	}
+	stale.StaleUntil = time.Now().Add(-time.Second)
+	if _, ok := c.Get("example.com", "/stale", false); ok {
+		t.Errorf("expired page was served")
+	}
+}
+
+func TestPageCacheDisk(t *testing.T) {
+	dir := t.TempDir()
+	c := NewPageCache(dir)
+	c.Set(testPage("/disk", "/disk", time.Minute), true)
+	c.Set(testPage("/memory", "/memory", time.Minute), false)
+
+	// a new cache, such as after a restart, finds pages on disk only when asked to
+	restarted := NewPageCache(dir)
+	if _, ok := restarted.Get("example.com", "/disk", false); ok {
+		t.Errorf("Get without disk read the disk tier")
+	}
+	if page, ok := restarted.Get("example.com", "/disk", true); !ok || string(page.Body) != "<p>/disk</p>" {
+		t.Errorf("Get(/disk) from disk = %v, %v", page, ok)
+	}
+	if _, ok := restarted.Get("example.com", "/memory", true); ok {
+		t.Errorf("page stored in memory only was found on disk")
+	}
+
+	// a cache without a directory never touches the disk
+	NewPageCache("").Set(testPage("/none", "/none", time.Minute), true)
+	if entries, _ := os.ReadDir(filepath.Join(dir, "example.com")); len(entries) != 1 {
+		t.Errorf("disk tier holds %d pages, want 1", len(entries))
+	}
+}
+
+func TestPageCacheEviction(t *testing.T) {
+	c := NewPageCache("")
+	c.MaxEntries = 2
+	c.Set(testPage("/long", "/long", time.Hour), false)
+	c.Set(testPage("/short", "/short", time.Minute), false)
+	c.Set(testPage("/new", "/new", time.Hour), false)
+
+	// the page expiring first makes room
+	if _, ok := c.Get("example.com", "/short", false); ok {
+		t.Errorf("page expiring first was kept")
+	}
+	for _, key := range []string{"/long", "/new"} {
+		if _, ok := c.Get("example.com", key, false); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+}
+
+func TestPageCachePurge(t *testing.T) {
+	dir := t.TempDir()
+	c := NewPageCache(dir)
+	c.Set(testPage("/blog/a|role=", "/blog/a", time.Minute, "blog"), true)
+	c.Set(testPage("/blog/a|role=admin", "/blog/a", time.Minute, "blog"), true)
+	c.Set(testPage("/blog/b", "/blog/b", time.Minute, "blog"), false)
+	c.Set(testPage("/about", "/about", time.Minute), true)
+
+	if n := c.PurgeRoute("example.com", "/blog/a"); n != 2 {
+		t.Errorf("PurgeRoute purged %d pages from memory, want 2", n)
+	}
+	if _, ok := NewPageCache(dir).Get("example.com", "/blog/a|role=admin", true); ok {
+		t.Errorf("purged route is still on disk")
+	}
+	if n := c.PurgeTag("blog"); n != 1 {
+		t.Errorf("PurgeTag purged %d pages, want 1", n)
+	}
+	if _, ok := c.Get("example.com", "/about", true); !ok {
+		t.Errorf("page without the tag was purged")
+	}
+	if n := c.PurgeSite("example.com"); n != 1 {
+		t.Errorf("PurgeSite purged %d pages, want 1", n)
+	}
+	if _, ok := NewPageCache(dir).Get("example.com", "/about", true); ok {
+		t.Errorf("purged site is still on disk")
+	}
+}
+
+func TestPageCacheRevalidate(t *testing.T) {
+	c := NewPageCache("")
+	if !c.StartRevalidate("/a") {
+		t.Fatalf("first StartRevalidate was refused")
+	}
+	if c.StartRevalidate("/a") {
+		t.Errorf("second StartRevalidate of a running key succeeded")
+	}
+	c.EndRevalidate("/a")
+	if !c.StartRevalidate("/a") {
+		t.Errorf("StartRevalidate after EndRevalidate was refused")
+	}
+}
@@ -0,0 +1,249 @@
+package structure
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SiteConfig is the typed form of a site's config.toml.
+//
+//	domain = "example.com"
+//	aliases = ["www.example.com"]
+//	default_locale = "en"
+//	default_layout = "main"
+//	root_layout = "root"
+//	auto_escape = true
+//	undefined = "strict"
+//
+//	[error_pages]
+//	404 = "pages/_errors/404.hstm"
+//
+//	[assets]
+//	public_dir = "public"
+//
+//	[cache]
+//	pages = "public, max-age=60"
+//	public = "public, max-age=86400"
+//
+//	[[cache.routes]]
+//	path = "/blog/*"
+//	ttl = "5m"
+//	stale_while_revalidate = "1h"
+//	query = ["page"]
+//	tags = ["blog"]
+//
+//	[auth]
+//	required = true
+//	login_path = "/login"
+//	public = ["/login", "/blog/*"]
+//
+//	[export]
+//	skip = ["/account"]
+//
+//	[site]
+//	name = "Example"    # available to templates as .Site.name
+type SiteConfig struct {
+	// Domain of the site, must match the name of the site folder when set
+	Domain string `toml:"domain"`
+	// Alternate domains served by the site, such as "www.example.com"
+	Aliases []string `toml:"aliases"`
+	// Locale of requests that ask for none the site has, its data files fill in what other locales leave out. Defaults to "en"
+	DefaultLocale string `toml:"default_locale"`
+	// Other locales of the site, picked by a "/<locale>/" path prefix, the wispy_locale cookie or Accept-Language
+	Locales []string `toml:"locales"`
+	// Layout in layouts/ wrapped around pages that don't use a layout or extends tag, empty for none
+	DefaultLayout string `toml:"default_layout"`
+	// Layout in layouts/ wrapped around every rendered page. Defaults to "root"
+	RootLayout string `toml:"root_layout"`
+	// Templates rendered for error statuses keyed by status code, relative to the site directory.
+	// Statuses not listed use pages/_errors/<status>.hstm when it exists
+	ErrorPages map[string]string `toml:"error_pages"`
+	// Overrides TemplateEngine.AutoEscape for this site when set
+	AutoEscape *bool `toml:"auto_escape"`
+	// Overrides TemplateEngine.Undefined for this site when set, "strict", "lenient" or "silent"
+	Undefined *UndefinedMode `toml:"undefined"`
+	Assets    SiteAssets     `toml:"assets"`
+	Cache     SiteCache      `toml:"cache"`
+	Auth      SiteAuth       `toml:"auth"`
+	Export    SiteExport     `toml:"export"`
+	// Content collections keyed by their folder in content/, folders without a table use the defaults
+	Collections map[string]SiteCollection `toml:"collections"`
+	// Custom values available to templates as .Site
+	Data map[string]any `toml:"site"`
+}
+
+// SiteAssets configures the static files of a site
+type SiteAssets struct {
+	// Folder of the site served as static files from "/". Defaults to "public"
+	PublicDir string `toml:"public_dir"`
+}
+
+// SiteCache sets the Cache-Control headers of responses, empty values send no header
+type SiteCache struct {
+	// Cache-Control of rendered pages, such as "public, max-age=60"
+	Pages string `toml:"pages"`
+	// Cache-Control of files served from the public folder
+	Public string `toml:"public"`
+	// Routes whose rendered pages are kept by the page cache, the first rule matching a route applies
+	Routes []PageCacheRule `toml:"routes"`
+}
+
+// PageCacheRule caches the rendered pages of matching routes. Requests of logged-in users render
+// the page themselves unless it is Shareable
+type PageCacheRule struct {
+	// Route pattern such as "/" or "/blog/*" (see path.Match)
+	Path string `toml:"path"`
+	// How long a rendered page is served from the cache, such as "5m"
+	TTL time.Duration `toml:"ttl"`
+	// How long an expired page is still served while it is rendered again in the background
+	StaleWhileRevalidate time.Duration `toml:"stale_while_revalidate"`
+	// Query parameters that select a different page, other parameters are ignored
+	Query []string `toml:"query"`
+	// Keep a page per user role
+	Role bool `toml:"role"`
+	// Keep a page per locale
+	Locale bool `toml:"locale"`
+	// Serve the cached page to logged-in users too, only for pages that show nothing of the user
+	Shareable bool `toml:"shareable"`
+	// Names to purge the pages by when their data changes, see PageCache.PurgeTag
+	Tags []string `toml:"tags"`
+	// Also keep the pages in the .wispy directory so they survive restarts
+	Disk bool `toml:"disk"`
+}
+
+// SiteAuth requires a session for the routes of a site, enforced by the auth route handler
+type SiteAuth struct {
+	// Send requests without a valid session to LoginPath
+	Required bool `toml:"required"`
+	// Where requests without a session are redirected. Defaults to "/login"
+	LoginPath string `toml:"login_path"`
+	// Routes reachable without a session, such as "/" or "/blog/*". LoginPath is always public
+	Public []string `toml:"public"`
+}
+
+// SiteExport configures the static export of a site
+type SiteExport struct {
+	// Routes that need dynamic data and are left out of the export, such as "/account" or "/dashboard/*"
+	Skip []string `toml:"skip"`
+}
+
+// SiteCollection configures a content collection
+type SiteCollection struct {
+	// Template in layouts/ entries render through, "blog" is layouts/blog.hstm or layouts/blog/index.hstm.
+	// Defaults to the collection name, without it the collection has no routes
+	Layout string `toml:"layout"`
+	// Route of the entries with a [slug] or [...slug] segment. Defaults to "/<collection>/[...slug]"
+	Route string `toml:"route"`
+	// Sort entries by "date" (newest first, the default), "title", "weight", "slug" or another front matter key
+	SortBy string `toml:"sort_by"`
+	// Reverse the order
+	Reverse bool `toml:"reverse"`
+}
+
+var (
+	hostName   = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?(:[0-9]+)?$`)
+	localeName = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{2,8})*$`)
+	layoutName = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_./-]*$`)
+)
+
+// Defaults fills in the settings left empty in config.toml
+func (config *SiteConfig) Defaults() {
+	if config.DefaultLocale == "" {
+		config.DefaultLocale = "en"
+	}
+	if config.RootLayout == "" {
+		config.RootLayout = "root"
+	}
+	if config.Assets.PublicDir == "" {
+		config.Assets.PublicDir = "public"
+	}
+	if config.Auth.LoginPath == "" {
+		config.Auth.LoginPath = "/login"
+	}
+}
+
+// Validate checks the values of the settings, files referenced by the config are checked when the site is loaded
+func (config *SiteConfig) Validate(folder string) (errs []error) {
+	if config.Domain != "" && config.Domain != folder {
+		errs = append(errs, fmt.Errorf("domain %q does not match the site folder %q", config.Domain, folder))
+	}
+	for _, alias := range config.Aliases {
+		if !hostName.MatchString(alias) {
+			errs = append(errs, fmt.Errorf("aliases: %q is not a valid domain", alias))
+		} else if alias == folder {
+			errs = append(errs, fmt.Errorf("aliases: %q is the domain of the site itself", alias))
+		}
+	}
+	if !localeName.MatchString(config.DefaultLocale) {
+		errs = append(errs, fmt.Errorf("default_locale: %q is not a locale such as \"en\" or \"pt-BR\"", config.DefaultLocale))
+	}
+	for _, locale := range config.Locales {
+		if !localeName.MatchString(locale) {
+			errs = append(errs, fmt.Errorf("locales: %q is not a locale such as \"en\" or \"pt-BR\"", locale))
+		}
+	}
+	if config.DefaultLayout != "" && !layoutName.MatchString(config.DefaultLayout) {
+		errs = append(errs, fmt.Errorf("default_layout: %q is not a layout name", config.DefaultLayout))
+	}
+	if !layoutName.MatchString(config.RootLayout) {
+		errs = append(errs, fmt.Errorf("root_layout: %q is not a layout name", config.RootLayout))
+	}
+	for _, status := range slices.Sorted(maps.Keys(config.ErrorPages)) {
+		page := config.ErrorPages[status]
+		if code, err := strconv.Atoi(status); err != nil || code < 400 || code > 599 {
+			errs = append(errs, fmt.Errorf("error_pages: %q is not an error status such as 404", status))
+		}
+		if page == "" {
+			errs = append(errs, fmt.Errorf("error_pages: %s has no template", status))
+		}
+	}
+	if strings.Contains(config.Assets.PublicDir, "..") {
+		errs = append(errs, fmt.Errorf("assets.public_dir: %q must stay inside the site folder", config.Assets.PublicDir))
+	}
+	if !strings.HasPrefix(config.Auth.LoginPath, "/") {
+		errs = append(errs, fmt.Errorf("auth.login_path: %q must start with \"/\"", config.Auth.LoginPath))
+	}
+	for i, rule := range config.Cache.Routes {
+		if rule.Path == "" {
+			errs = append(errs, fmt.Errorf("cache.routes[%d]: path is required", i))
+		}
+		if rule.TTL <= 0 {
+			errs = append(errs, fmt.Errorf("cache.routes[%d]: ttl must be a positive duration such as \"5m\"", i))
+		}
+		if rule.StaleWhileRevalidate < 0 {
+			errs = append(errs, fmt.Errorf("cache.routes[%d]: stale_while_revalidate must not be negative", i))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(config.Collections)) {
+		collection := config.Collections[name]
+		if collection.Layout != "" && !layoutName.MatchString(collection.Layout) {
+			errs = append(errs, fmt.Errorf("collections.%s.layout: %q is not a layout name", name, collection.Layout))
+		}
+		if collection.Route != "" && (!strings.HasPrefix(collection.Route, "/") ||
+			!strings.Contains(collection.Route, "[slug]") && !strings.Contains(collection.Route, "[...slug]")) {
+			errs = append(errs, fmt.Errorf("collections.%s.route: %q must start with \"/\" and hold a [slug] or [...slug] segment", name, collection.Route))
+		}
+	}
+	var cachePaths []string
+	for _, rule := range config.Cache.Routes {
+		cachePaths = append(cachePaths, rule.Path)
+	}
+	for _, pattern := range slices.Concat(config.Auth.Public, config.Export.Skip, cachePaths) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid route pattern %q: %v", pattern, err))
+		}
+	}
+	return errs
+}
+
+// ErrorPage returns the template configured for a status, if any
+func (config *SiteConfig) ErrorPage(status int) (string, bool) {
+	page, ok := config.ErrorPages[strconv.Itoa(status)]
+	return page, ok
+}
@@ -0,0 +1,82 @@
+package structure
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSiteConfigDefaults(t *testing.T) {
+	var config SiteConfig
+	config.Defaults()
+	if config.DefaultLocale != "en" || config.RootLayout != "root" || config.Assets.PublicDir != "public" || config.Auth.LoginPath != "/login" {
+		t.Errorf("Defaults() = %+v", config)
+	}
+	if errs := config.Validate("example.com"); len(errs) > 0 {
+		t.Errorf("Validate of the defaults = %v", errs)
+	}
+
+	// set values are kept
+	config = SiteConfig{DefaultLocale: "fr", RootLayout: "base"}
+	config.Defaults()
+	if config.DefaultLocale != "fr" || config.RootLayout != "base" {
+		t.Errorf("Defaults() replaced set values: %+v", config)
+	}
+}
+
+func TestSiteConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(config *SiteConfig)
+		// substring of the single expected error, empty when the config is valid
+		want string
+	}{
+		{"valid", func(config *SiteConfig) {
+			config.Domain = "example.com"
+			config.Aliases = []string{"example.org", "localhost:8080"}
+			config.Locales = []string{"fr", "pt-BR", "zh_Hant"}
+			config.DefaultLayout = "docs/main"
+			config.ErrorPages = map[string]string{"404": "errors/missing"}
+			config.Collections = map[string]SiteCollection{"blog": {Layout: "post", Route: "/blog/[slug]"}}
+			config.Cache.Routes = []PageCacheRule{{Path: "/blog/*", TTL: time.Minute}}
+		}, ""},
+		{"domain of another folder", func(config *SiteConfig) { config.Domain = "other.com" }, `domain "other.com" does not match the site folder "example.com"`},
+		{"invalid alias", func(config *SiteConfig) { config.Aliases = []string{"exa mple.org"} }, `aliases: "exa mple.org" is not a valid domain`},
+		{"alias of the site", func(config *SiteConfig) { config.Aliases = []string{"example.com"} }, `aliases: "example.com" is the domain of the site itself`},
+		{"invalid default locale", func(config *SiteConfig) { config.DefaultLocale = "english!" }, `default_locale: "english!" is not a locale`},
+		{"invalid locale", func(config *SiteConfig) { config.Locales = []string{"e"} }, `locales: "e" is not a locale`},
+		{"invalid default layout", func(config *SiteConfig) { config.DefaultLayout = "../up" }, `default_layout: "../up" is not a layout name`},
+		{"invalid root layout", func(config *SiteConfig) { config.RootLayout = "/root" }, `root_layout: "/root" is not a layout name`},
+		{"error page status", func(config *SiteConfig) { config.ErrorPages = map[string]string{"200": "ok"} }, `error_pages: "200" is not an error status`},
+		{"error page template", func(config *SiteConfig) { config.ErrorPages = map[string]string{"500": ""} }, `error_pages: 500 has no template`},
+		{"public dir outside the site", func(config *SiteConfig) { config.Assets.PublicDir = "../shared" }, `assets.public_dir: "../shared" must stay inside the site folder`},
+		{"relative login path", func(config *SiteConfig) { config.Auth.LoginPath = "login" }, `auth.login_path: "login" must start with "/"`},
+		{"cache rule path", func(config *SiteConfig) { config.Cache.Routes = []PageCacheRule{{TTL: time.Minute}} }, `cache.routes[0]: path is required`},
+		{"cache rule ttl", func(config *SiteConfig) { config.Cache.Routes = []PageCacheRule{{Path: "/a"}} }, `cache.routes[0]: ttl must be a positive duration`},
+		{"cache rule stale", func(config *SiteConfig) {
+			config.Cache.Routes = []PageCacheRule{{Path: "/a", TTL: time.Minute, StaleWhileRevalidate: -time.Minute}}
+		}, `cache.routes[0]: stale_while_revalidate must not be negative`},
+		{"collection layout", func(config *SiteConfig) { config.Collections = map[string]SiteCollection{"blog": {Layout: "../x"}} }, `collections.blog.layout: "../x" is not a layout name`},
+		{"collection route", func(config *SiteConfig) {
+			config.Collections = map[string]SiteCollection{"blog": {Route: "/blog/[id]"}}
+		}, `collections.blog.route: "/blog/[id]" must start with "/" and hold a [slug] or [...slug] segment`},
+		{"route pattern", func(config *SiteConfig) { config.Export.Skip = []string{"/a/["} }, `invalid route pattern "/a/["`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config SiteConfig
+			config.Defaults()
+			tt.change(&config)
+			errs := config.Validate("example.com")
+			if tt.want == "" {
+				if len(errs) > 0 {
+					t.Errorf("Validate = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.want) {
+				t.Errorf("Validate = %v, want one error with %q", errs, tt.want)
+			}
+		})
+	}
+}
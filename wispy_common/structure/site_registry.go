@@ -0,0 +1,110 @@
+package structure
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// SiteRegistry holds the sites served by an engine. Readers load an immutable snapshot without locking,
+// writers build a new snapshot and swap it in, so sites can be added, rebuilt or removed while serving requests.
+// Sites returned by the registry are shared between requests and must not be modified
+type SiteRegistry struct {
+	// serializes writers, readers never wait
+	mu       sync.Mutex
+	snapshot atomic.Pointer[siteSnapshot]
+}
+
+// siteSnapshot is never modified once it is stored in the registry
+type siteSnapshot struct {
+	sites map[string]*SiteStructure
+	// alternate domains from the site configs mapped to the domain of their site
+	aliases map[string]string
+}
+
+func NewSiteRegistry() *SiteRegistry {
+	registry := &SiteRegistry{}
+	registry.snapshot.Store(&siteSnapshot{
+		sites:   make(map[string]*SiteStructure),
+		aliases: make(map[string]string),
+	})
+	return registry
+}
+
+// Lookup returns the site serving a host, by its domain or one of its aliases
+func (r *SiteRegistry) Lookup(host string) (*SiteStructure, bool) {
+	snapshot := r.snapshot.Load()
+	if site, ok := snapshot.sites[host]; ok {
+		return site, true
+	}
+	if domain, ok := snapshot.aliases[host]; ok {
+		site, ok := snapshot.sites[domain]
+		return site, ok
+	}
+	return nil, false
+}
+
+// Get returns the site of a domain, aliases are not considered
+func (r *SiteRegistry) Get(domain string) (*SiteStructure, bool) {
+	site, ok := r.snapshot.Load().sites[domain]
+	return site, ok
+}
+
+// Domains returns the domains of every site, sorted
+func (r *SiteRegistry) Domains() []string {
+	return slices.Sorted(maps.Keys(r.snapshot.Load().sites))
+}
+
+// Len returns the number of sites
+func (r *SiteRegistry) Len() int {
+	return len(r.snapshot.Load().sites)
+}
+
+// Set adds or replaces a site and maps the aliases of every site again
+func (r *SiteRegistry) Set(site SiteStructure) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sites := maps.Clone(r.snapshot.Load().sites)
+	sites[site.Domain] = &site
+	r.snapshot.Store(newSiteSnapshot(sites))
+}
+
+// Remove drops a site and its aliases
+func (r *SiteRegistry) Remove(domain string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sites := maps.Clone(r.snapshot.Load().sites)
+	delete(sites, domain)
+	r.snapshot.Store(newSiteSnapshot(sites))
+}
+
+// newSiteSnapshot points the aliases of every site at its domain, aliases claimed twice are reported on the site.
+// Sites gaining an error are copied as the previous snapshot may still be in use
+func newSiteSnapshot(sites map[string]*SiteStructure) *siteSnapshot {
+	aliases := make(map[string]string)
+	for _, domain := range slices.Sorted(maps.Keys(sites)) {
+		site := sites[domain]
+		for _, alias := range site.Config.Aliases {
+			owner, claimed := aliases[alias]
+			if _, isSite := sites[alias]; isSite {
+				owner, claimed = alias, true
+			}
+			if claimed {
+				err := fmt.Errorf("aliases: %q is already served by %s", alias, owner)
+				if !slices.ContainsFunc(site.ConfigErrors, func(e error) bool { return e.Error() == err.Error() }) {
+					slog.Error("Invalid site config", "domain", domain, "error", err)
+					updated := *site
+					updated.ConfigErrors = append(slices.Clip(site.ConfigErrors), err)
+					site = &updated
+					sites[domain] = site
+				}
+				continue
+			}
+			aliases[alias] = domain
+		}
+	}
+	return &siteSnapshot{sites: sites, aliases: aliases}
+}
@@ -0,0 +1,132 @@
+package structure
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func testSite(domain string, aliases ...string) SiteStructure {
+	return SiteStructure{Domain: domain, Config: SiteConfig{Aliases: aliases}}
+}
+
+func TestSiteRegistryLookup(t *testing.T) {
+	r := NewSiteRegistry()
+	r.Set(testSite("example.com", "www.example.com", "example.org"))
+	r.Set(testSite("other.com"))
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{"www.example.com", "example.com"},
+		{"example.org", "example.com"},
+		{"other.com", "other.com"},
+		{"missing.com", ""},
+	}
+	for _, tt := range tests {
+		site, ok := r.Lookup(tt.host)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("Lookup(%q) = %q, want no site", tt.host, site.Domain)
+			}
+			continue
+		}
+		if !ok || site.Domain != tt.want {
+			t.Errorf("Lookup(%q) = %v, %v, want %q", tt.host, site, ok, tt.want)
+		}
+	}
+
+	// Get ignores aliases
+	if _, ok := r.Get("www.example.com"); ok {
+		t.Errorf("Get found a site by its alias")
+	}
+	if got := r.Domains(); !slices.Equal(got, []string{"example.com", "other.com"}) {
+		t.Errorf("Domains() = %v", got)
+	}
+	if r.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", r.Len())
+	}
+}
+
+func TestSiteRegistrySetAndRemove(t *testing.T) {
+	r := NewSiteRegistry()
+	r.Set(testSite("example.com", "www.example.com"))
+	before, _ := r.Get("example.com")
+
+	// a rebuilt site replaces the old one and its aliases, readers holding the old one are unaffected
+	r.Set(testSite("example.com", "example.org"))
+	if _, ok := r.Lookup("www.example.com"); ok {
+		t.Errorf("alias of the replaced site is still served")
+	}
+	if site, ok := r.Lookup("example.org"); !ok || site.Domain != "example.com" {
+		t.Errorf("alias of the new site is not served")
+	}
+	if !slices.Equal(before.Config.Aliases, []string{"www.example.com"}) {
+		t.Errorf("previous site was modified: %v", before.Config.Aliases)
+	}
+
+	r.Remove("example.com")
+	for _, host := range []string{"example.com", "example.org"} {
+		if _, ok := r.Lookup(host); ok {
+			t.Errorf("Lookup(%q) found a removed site", host)
+		}
+	}
+	r.Remove("missing.com")
+}
+
+func TestSiteRegistryAliasConflicts(t *testing.T) {
+	r := NewSiteRegistry()
+	r.Set(testSite("a.com", "shared.com", "b.com"))
+	r.Set(testSite("b.com", "shared.com"))
+
+	// the first site by domain keeps the alias, a domain of another site can't be an alias
+	if site, _ := r.Lookup("shared.com"); site.Domain != "a.com" {
+		t.Errorf("shared.com is served by %s, want a.com", site.Domain)
+	}
+	if site, _ := r.Lookup("b.com"); site.Domain != "b.com" {
+		t.Errorf("b.com is served by %s, want b.com", site.Domain)
+	}
+	a, _ := r.Get("a.com")
+	b, _ := r.Get("b.com")
+	if len(a.ConfigErrors) != 1 || !strings.Contains(a.ConfigErrors[0].Error(), `"b.com" is already served by b.com`) {
+		t.Errorf("a.com config errors = %v", a.ConfigErrors)
+	}
+	if len(b.ConfigErrors) != 1 || !strings.Contains(b.ConfigErrors[0].Error(), `"shared.com" is already served by a.com`) {
+		t.Errorf("b.com config errors = %v", b.ConfigErrors)
+	}
+
+	// errors are not added again when the snapshot is rebuilt
+	r.Set(testSite("c.com"))
+	if a, _ := r.Get("a.com"); len(a.ConfigErrors) != 1 {
+		t.Errorf("a.com config errors after rebuild = %v", a.ConfigErrors)
+	}
+}
+
+func TestSiteRegistryConcurrent(t *testing.T) {
+	r := NewSiteRegistry()
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				r.Set(testSite(fmt.Sprintf("site%d-%d.com", i, j)))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				r.Lookup("site0-0.com")
+				r.Domains()
+			}
+		}()
+	}
+	wg.Wait()
+	if r.Len() != 8*50 {
+		t.Errorf("Len() = %d, want %d", r.Len(), 8*50)
+	}
+}
@@ -1,5 +1,7 @@
 package structure
 
+import "time"
+
 // WispyConfig holds configuration options for the engine.
 type WispyConfig struct {
 	SITE_DIR         string
@@ -18,11 +20,22 @@ var Wispy = &WispyConfig{
 
 // SiteStructure represents a single site, with its pages, layouts, and partials.
 type SiteStructure struct {
-	Domain   string
-	Routes   map[string]PageRoutes
-	Layouts  map[string]string
-	Partials map[string]string
-	// Add other fields as needed (e.g., site-specific config settings)
+	Domain string
+	Routes map[string]PageRoutes
+	// Keys of Routes with parameters such as "blog/[slug]", in the order they are matched
+	DynamicRoutes []string
+	Layouts       map[string]string
+	Partials      map[string]string
+	// Settings decoded from the site's config.toml
+	Config SiteConfig
+	// Problems found while loading config.toml, the site is still served with the valid settings
+	ConfigErrors []error
+	// Collections of the content/ folder by name
+	Collections map[string]*ContentCollection
+	// Files of the data/ folder by locale, "" holds the files without a locale. Exposed to templates as .Site.Data
+	Data map[string]map[string]any
+	// Problems found while loading content and data files, files that failed are left out
+	ContentErrors []error
 }
 
 // PageRoutes holds information about a page.
@@ -33,6 +46,10 @@ type PageRoutes struct {
 	Path     string
 	Template string
 	MetaTags MetaTags
+	// Path segments of dynamic routes, "[slug]" matches one segment and "[...path]" the rest of the path. Nil for static routes
+	Pattern []string
+	// Content entry of a route generated by a collection, Path is then the collection's layout
+	Entry *SiteContent
 }
 
 // MetaTags holds metadata information for a page.
@@ -45,22 +62,83 @@ type MetaTags struct {
 	OgUrl         string
 }
 
+// ContentChange is an entry of the "changes" front matter of content, keyed by version or date
 type ContentChange struct {
 	Author  string
 	Date    string
 	Changes map[string]string
 }
 
+// SiteContent is an entry of a content collection, a Markdown file with front matter in content/<collection>/
 type SiteContent struct {
+	// Name of the collection, the folder in content/
+	Collection string
+	// Path of the file in its collection without extension, "guides/setup" for content/docs/guides/setup.md
 	Name        string
 	Title       string
 	Description string
-	Slug        string
-	Category    string
-	Tags        string
-	Author      string
-	LastUpdate  string
-	Changes     map[string]ContentChange
+	// Identifies the entry in the route of its collection, defaults to Name
+	Slug string
+	// Path of the generated route of the entry, empty when the collection has no routes
+	URL        string
+	Categories []string
+	Tags       []string
+	Author     string
+	// Publish date, entries dated later are hidden in production until then
+	Date       time.Time
+	LastUpdate time.Time
+	// Drafts are hidden in production
+	Draft bool
+	// Order of entries in collections sorted by "weight"
+	Weight int
+	// HTML of the front matter summary, the part before <!--more--> or the first paragraph
+	Summary SafeHTML
+	// HTML rendered from the Markdown
+	Body SafeHTML
+	// Every front matter key as written
+	Params  map[string]any
+	Changes map[string]ContentChange
+	// File the entry was read from
+	Path string
+	// The entry as exposed to templates, see ContentCollection
+	Values map[string]any
+}
+
+// Published reports whether an entry is live at a time, neither a draft nor dated later
+func (entry *SiteContent) Published(now time.Time) bool {
+	return !entry.Draft && !entry.Date.After(now)
+}
+
+// ContentCollection holds the entries of a folder of content/, exposed to templates as .Collections.<name>
+type ContentCollection struct {
+	Name string
+	// Template in layouts/ entries render through, empty when the collection has no routes
+	Layout string
+	// Segments of the route of entries such as ["blog", "[slug]"], nil when the collection has no routes
+	Pattern []string
+	// Every entry, drafts and entries dated later included, in the order of the collection
+	Entries []*SiteContent
+	slugs   map[string]*SiteContent
+}
+
+// NewContentCollection indexes entries by slug, later entries with a taken slug are returned as duplicates
+func NewContentCollection(name string, entries []*SiteContent) (collection *ContentCollection, duplicates []*SiteContent) {
+	collection = &ContentCollection{Name: name, slugs: make(map[string]*SiteContent, len(entries))}
+	for _, entry := range entries {
+		if _, taken := collection.slugs[entry.Slug]; taken {
+			duplicates = append(duplicates, entry)
+			continue
+		}
+		collection.slugs[entry.Slug] = entry
+		collection.Entries = append(collection.Entries, entry)
+	}
+	return collection, duplicates
+}
+
+// Entry returns the entry with a slug
+func (collection *ContentCollection) Entry(slug string) (*SiteContent, bool) {
+	entry, ok := collection.slugs[slug]
+	return entry, ok
 }
 
 // ----------------------
@@ -0,0 +1,83 @@
+package structure
+
+import "io"
+
+// SlotWriter streams rendered output to an io.Writer while leaving deferred slots to be filled once their content is known.
+// Output is held back until Resolve fills the slots deferred so far, such as the head tags and CSS of "root-head" and
+// "root-css", after that it is written through until another slot is deferred. Nothing is sent before the first Resolve,
+// so a render that ends early, like a redirect of restricted-by-role, can still be answered with its own status
+type SlotWriter struct {
+	w io.Writer
+	// output held back behind unresolved slots, in order
+	pending []deferredSegment
+	// set by Resolve, output is written through while no slot is pending
+	streaming bool
+	err       error
+}
+
+// deferredSegment is either held back output or a slot filled by Resolve
+type deferredSegment struct {
+	output []byte
+	fill   func() string
+}
+
+func NewSlotWriter(w io.Writer) *SlotWriter {
+	return &SlotWriter{w: w}
+}
+
+// Write sends p to the underlying writer, or holds it back until the next Resolve
+func (sw *SlotWriter) Write(p []byte) (int, error) {
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	if sw.streaming && len(sw.pending) == 0 {
+		n, err := sw.w.Write(p)
+		sw.err = err
+		return n, err
+	}
+	if len(sw.pending) == 0 || sw.pending[len(sw.pending)-1].fill != nil {
+		sw.pending = append(sw.pending, deferredSegment{})
+	}
+	last := &sw.pending[len(sw.pending)-1]
+	last.output = append(last.output, p...)
+	return len(p), nil
+}
+
+// Defer reserves a slot at the current position, fill is called by Resolve to produce its content
+func (sw *SlotWriter) Defer(fill func() string) {
+	sw.pending = append(sw.pending, deferredSegment{fill: fill})
+}
+
+// Resolve fills the slots deferred so far and writes the held back output, later output is written through
+// until another slot is deferred
+func (sw *SlotWriter) Resolve() error {
+	for i := range sw.pending {
+		if sw.err != nil {
+			break
+		}
+		segment := &sw.pending[i]
+		if segment.fill != nil {
+			_, sw.err = io.WriteString(sw.w, segment.fill())
+		} else {
+			_, sw.err = sw.w.Write(segment.output)
+		}
+	}
+	sw.pending = nil
+	sw.streaming = true
+	return sw.err
+}
+
+// Flush resolves the remaining slots, call it once rendering is done
+func (sw *SlotWriter) Flush() error {
+	return sw.Resolve()
+}
+
+// DeferOrWrite defers fill when w is a SlotWriter and writes its content right away otherwise,
+// such as when a tag renders into a buffer of its own
+func DeferOrWrite(w io.Writer, fill func() string) {
+	if sw, ok := w.(*SlotWriter); ok {
+		sw.Defer(fill)
+		return
+	}
+	io.WriteString(w, fill())
+}
@@ -0,0 +1,54 @@
+package structure
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSlotWriter(t *testing.T) {
+	var out strings.Builder
+	sw := NewSlotWriter(&out)
+	head := "title"
+
+	io.WriteString(sw, "<head>")
+	sw.Defer(func() string { return "<" + head + ">" })
+	io.WriteString(sw, "</head><body>")
+	if out.Len() != 0 {
+		t.Fatalf("output sent before Resolve: %q", out.String())
+	}
+
+	// slots are filled with what was added until Resolve
+	head = "late"
+	sw.Resolve()
+	if out.String() != "<head><late></head><body>" {
+		t.Fatalf("after Resolve = %q", out.String())
+	}
+
+	// output streams until another slot is deferred
+	io.WriteString(sw, "<main>")
+	if out.String() != "<head><late></head><body><main>" {
+		t.Fatalf("output after Resolve was held back: %q", out.String())
+	}
+	scripts := "a.js"
+	sw.Defer(func() string { return "<" + scripts + ">" })
+	io.WriteString(sw, "</body>")
+	if strings.Contains(out.String(), "</body>") {
+		t.Fatalf("output after a deferred slot was sent: %q", out.String())
+	}
+	scripts = "b.js"
+	if err := sw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "<head><late></head><body><main><b.js></body>" {
+		t.Errorf("after Flush = %q", out.String())
+	}
+}
+
+func TestDeferOrWrite(t *testing.T) {
+	var out strings.Builder
+	DeferOrWrite(&out, func() string { return "now" })
+	if out.String() != "now" {
+		t.Errorf("DeferOrWrite on a plain writer = %q", out.String())
+	}
+}
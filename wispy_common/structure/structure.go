@@ -2,26 +2,27 @@ package structure
 
 import (
 	"database/sql"
+	"io"
 	"net/http"
+	"slices"
 	"strings"
 )
 
 // RenderCtx represents the rendering context.
 type RenderCtx struct {
 	// Reference to the TemplateEngine.
-	Engine TemplateEngine // *TemplateEngine
+	Engine *TemplateEngine
 	// Data available during rendering.
 	Data map[string]any
 	// Props passed to the component.
 	Props map[string]any
 	// Defined block for in file partials.
-	Blocks map[string]string
-	// "Passed" stores ->
-	// The layout content needs to be render first to ensure all operations are handled
-	// so meta tags as well as import tags can be resolved and duped
-	Passed string
-	// Slots for block content.
-	Slots map[string]string
+	Blocks map[string][]*Node
+	// Content wrapped by a layout, rendered where the layout places "passed" so it streams with the layout.
+	// Head tags and assets it adds still reach root-head, root-css and root-js as those slots are deferred
+	Passed *Slot
+	// Slots for block content, passed by extends and component tags.
+	Slots map[string]*Slot
 	// The current directory the template engine should scan for sub folders like partials
 	// This will be set to the site directory if using the wispy-engine but is being set as a string option to allow
 	// few changes to support template engine use outside of the wispy-engine context
@@ -36,14 +37,115 @@ type RenderCtx struct {
 	ResponseWriter *http.ResponseWriter
 	// If User is logged in auth middleware can set their ID Here
 	UserID string
+	// Roles of the logged-in user, set by auth middleware when a page is cached per role
+	UserRoles []string
+	// Locale the page is rendered in, set by RenderRoute
+	Locale string
+	// Token forms send back to pass the CSRF check, set by the csrf stage of wispy.Server
+	CSRFToken string
+	// Set by tags whose output is specific to the visitor, such as csrf-field, so the page is never cached
+	Private bool
 	// The database to fetch user data from such as roles for role access tags
 	UsersDB *sql.DB
 	// Stores assets to either dynamically imported or inline into the page
 	AssetRegistry *AssetRegistry
 	// Tags to be dynamically rendered into the page head
 	HeadTags *HeadTagRegistry
+	// Template errors raised while rendering the route, set by RenderRoute
+	Errors []error
+	// Set by tags that end the render early (e.g. after a redirect), remaining nodes are skipped
+	Halted bool
+	// Error status set by tags that halt the render, such as restricted-by-role, the error page of the status is served instead
+	Status int
+	// Set by "break" and "continue", remaining nodes of the loop body are skipped until the loop handles it
+	LoopSignal LoopSignal
+	// Data of the enclosing scopes, see PushScope
+	scopes []map[string]any
 }
 
+// PushScope starts a child scope holding vars, which becomes Data while enclosing scopes stay on a stack.
+// Lookup searches the stack so nothing is copied, variables set inside the scope are dropped by PopScope,
+// while the request, registries, slots and blocks stay shared so tags inside loops behave like anywhere else.
+func (ctx *RenderCtx) PushScope(vars map[string]any) {
+	if vars == nil {
+		vars = make(map[string]any)
+	}
+	ctx.scopes = append(ctx.scopes, ctx.Data)
+	ctx.Data = vars
+}
+
+// PopScope restores Data of the enclosing scope
+func (ctx *RenderCtx) PopScope() {
+	last := len(ctx.scopes) - 1
+	if last < 0 {
+		return
+	}
+	ctx.Data = ctx.scopes[last]
+	ctx.scopes = ctx.scopes[:last]
+}
+
+// Lookup finds a variable in Data, then in the enclosing scopes from the innermost out
+func (ctx *RenderCtx) Lookup(key string) (any, bool) {
+	if value, ok := ctx.Data[key]; ok {
+		return value, true
+	}
+	for i := len(ctx.scopes) - 1; i >= 0; i-- {
+		if value, ok := ctx.scopes[i][key]; ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// ResetData replaces Data and drops the enclosing scopes, used by partials and components rendered with "only"
+func (ctx *RenderCtx) ResetData(data map[string]any) {
+	ctx.Data = data
+	ctx.scopes = nil
+}
+
+// Scope is the part of a render context that belongs to the template being rendered.
+// Slot content keeps the scope it was written in so it renders the same wherever it is placed
+type Scope struct {
+	Data         map[string]any
+	scopes       []map[string]any
+	Props        map[string]any
+	Slots        map[string]*Slot
+	TemplatePath string
+}
+
+// Slot is content passed to a component or parent template, rendered by "render-slot"
+type Slot struct {
+	Nodes []*Node
+	Scope Scope
+	// Called once the slot has been rendered, the root layout sends the held back page once its content is done
+	Rendered func()
+}
+
+// CurrentScope captures the data, props, slots and template path of the template being rendered
+func (ctx *RenderCtx) CurrentScope() Scope {
+	// the stack is copied at its length so later pushes never overwrite the captured scopes
+	scopes := slices.Clip(slices.Clone(ctx.scopes))
+	return Scope{Data: ctx.Data, scopes: scopes, Props: ctx.Props, Slots: ctx.Slots, TemplatePath: ctx.CurrentTemplatePath}
+}
+
+// RestoreScope switches to a scope captured with CurrentScope
+func (ctx *RenderCtx) RestoreScope(scope Scope) {
+	ctx.Data = scope.Data
+	ctx.scopes = scope.scopes
+	ctx.Props = scope.Props
+	ctx.Slots = scope.Slots
+	ctx.CurrentTemplatePath = scope.TemplatePath
+}
+
+// LoopSignal tells a loop how to carry on after its body stopped early
+type LoopSignal int
+
+const (
+	LoopNone LoopSignal = iota
+	LoopBreak
+	LoopContinue
+)
+
 // represents the settings/presets of the current template engine instances
 type TemplateEngine struct {
 	// starting deliminator - default "{%"
@@ -62,7 +164,20 @@ type TemplateEngine struct {
 	FILE_EXT         string
 	SITE_CONFIG_NAME string
 
-	SiteMap map[string]SiteStructure
+	// Escape output values based on where they appear in the HTML, sites can override it with "auto_escape" in their config
+	AutoEscape bool
+	// How undefined variables, unknown filters and unknown tags are handled, sites can override it with "undefined" in their config
+	Undefined UndefinedMode
+	// Template rendered with an .Error when strict mode aborts a render, relative to the site directory (e.g. "pages/_strict.hstm").
+	// Used when the site has no 500 error page, see template.WriteErrorPage
+	StrictErrorPage string
+
+	// Sites served by the engine, safe to update while requests are rendered
+	Sites *SiteRegistry
+	// Parsed templates cached per site
+	Templates *TemplateCache
+	// Rendered pages of the routes listed in the [cache] routes of site configs
+	Pages *PageCache
 }
 
 // Base function to create TemplateEngine instance used to to control base template settings
@@ -77,10 +192,13 @@ func (eng *TemplateEngine) Init(tagsMap []TemplateTag, filterMap []TemplateFilte
 	// Engine Config
 	eng.DelimStart = "{%"
 	eng.DelimEnd = "%}"
+	eng.AutoEscape = true
 	//
 	eng.TagMap = map[string]TemplateTag{}
 	//
-	eng.SiteMap = make(map[string]SiteStructure)
+	eng.Sites = NewSiteRegistry()
+	eng.Templates = NewTemplateCache()
+	eng.Pages = NewPageCache(".wispy/pages")
 	//
 	for _, tag := range tagsMap {
 		eng.TagMap[tag.Name] = tag
@@ -95,11 +213,10 @@ func (eng *TemplateEngine) Init(tagsMap []TemplateTag, filterMap []TemplateFilte
 
 func (engine *TemplateEngine) InitCtx(scopedDirectory string, site *SiteStructure, data map[string]any) *RenderCtx {
 	return &RenderCtx{
-		Engine:          *engine,
+		Engine:          engine,
 		Data:            data,
-		Slots:           make(map[string]string),
-		Passed:          "",
-		Blocks:          make(map[string]string),
+		Slots:           make(map[string]*Slot),
+		Blocks:          make(map[string][]*Node),
 		Props:           make(map[string]any),
 		Site:            site,
 		ScopedDirectory: scopedDirectory,
@@ -128,7 +245,7 @@ func (engine *TemplateEngine) InitCtx(scopedDirectory string, site *SiteStructur
 
 // Resolves variables from the RenderCtx's Data map.
 func (eng *TemplateEngine) GetData(ctx *RenderCtx, key string) any {
-	if val, ok := ctx.Data[key]; ok {
+	if val, ok := ctx.Lookup(key); ok {
 		return val
 	}
 	return ""
@@ -149,31 +266,68 @@ func (eng *TemplateEngine) GenCutSet(initial_cutset string) {
 	eng.CutSet = string(cutset)
 }
 
+// FilterArgType is the type a filter argument is converted to before the handler is called.
+type FilterArgType int
+
+const (
+	// Passed through as evaluated
+	ArgAny FilterArgType = iota
+	// Any value, converted with Stringify
+	ArgString
+	// Integers, floats without a fraction and numeric strings
+	ArgInt
+	// Any number or numeric string
+	ArgFloat
+	// Booleans and the strings "true" and "false"
+	ArgBool
+	// Slices and arrays, converted to []any
+	ArgList
+	// Maps with string keys, converted to map[string]any
+	ArgMap
+)
+
+// FilterArg describes a single argument of a filter, "{% .title | truncate 20 %}"
+type FilterArg struct {
+	Name string
+	Type FilterArgType
+	// Optional arguments may be left out, Default is passed in their place
+	Optional bool
+	Default  any
+}
+
 // Universal template data filters function struct
 type TemplateFilter struct {
-	Name    string
-	Handler func(pipedValue any, args []string) (value any, err error)
+	Name string
+	// Arguments in the order they follow the filter name, they can be literals or variables
+	Args []FilterArg
+	// Undefined piped values are passed as nil without reporting an error, used by "default"
+	AllowUndefined bool
+	// Handler receives one value per entry in Args, converted to its declared type
+	Handler func(pipedValue any, args []any) (value any, err error)
 }
 
 // Universal template tag function struct
 type TemplateTag struct {
 	Name string
-	// render tag with given context and args, and children if a RequiresClosingTag is set
+	// How the parser collects the body of the tag, defaults to KindInline
+	Kind TagKind
+	// Tag names that split the body of a block tag into node.Branches (e.g. "else-if", "else")
+	Clauses []string
+	// render tag with given context and its parsed node
 	Render func(
-		// Executes expected logic writes results to strings.Builder and returns new index from to continue rendering
+		// Executes expected logic and writes results to the io.Writer
 		// - Reference to the template engine struct
 		// - Partials map,
 		// - Data map fetched via eng.GetFunc(ctx *structure.RenderCtx, key string)
 		ctx *RenderCtx,
-		// Finalized output is written to the string building
-		sb *strings.Builder,
-		// The inner contexts of the tag being parsed
+		// Finalized output is written to the writer
+		w io.Writer,
+		// The parsed tag, node.Content holds the inner contents of the tag
 		// Example: "{% exampleTag ... ... ... %}"
-		// (tags using closing tag for inner content are expected to resolve the closing tag and content then return update POS int)
-		tag_contents,
-		// entire input string mainly used if tag handles closing child_content + closing_tag
-		raw string,
-		// the current position within the raw input string
-		pos int,
-	) (new_pos int, errs []error)
+		// (block tags find their parsed body in node.Children)
+		node *Node,
+	) (errs []error)
+	// Optional static check run by template.Lint on every use of the tag, such as whether the files it loads exist.
+	// ctx holds the engine, site and template path but no request or data
+	Lint func(ctx *RenderCtx, node *Node) (errs []error)
 }
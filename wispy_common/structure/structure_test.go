@@ -0,0 +1,65 @@
+package structure
+
+import "testing"
+
+func TestScopes(t *testing.T) {
+	ctx := &RenderCtx{Data: map[string]any{"a": 1, "b": 1}}
+
+	ctx.PushScope(map[string]any{"b": 2, "c": 2})
+	ctx.PushScope(map[string]any{"c": 3})
+	ctx.Data["d"] = 3
+
+	for key, want := range map[string]any{"a": 1, "b": 2, "c": 3, "d": 3} {
+		if got, ok := ctx.Lookup(key); !ok || got != want {
+			t.Errorf("Lookup(%q) = %v, %v, want %v", key, got, ok, want)
+		}
+	}
+	if len(ctx.Data) != 2 {
+		t.Errorf("pushed scope holds %d variables, want only its own 2", len(ctx.Data))
+	}
+
+	ctx.PopScope()
+	if _, ok := ctx.Lookup("d"); ok {
+		t.Errorf("variable of a popped scope is still defined")
+	}
+	if got, _ := ctx.Lookup("c"); got != 2 {
+		t.Errorf("Lookup(c) after pop = %v, want 2", got)
+	}
+	ctx.PopScope()
+	ctx.PopScope() // popping the outermost scope is a no-op
+	if got, _ := ctx.Lookup("b"); got != 1 {
+		t.Errorf("Lookup(b) after pops = %v, want 1", got)
+	}
+	if _, ok := ctx.Lookup("missing"); ok {
+		t.Errorf("Lookup(missing) found a value")
+	}
+}
+
+// A captured scope keeps seeing the variables it was captured with after the stack changes
+func TestCurrentScopeIsStable(t *testing.T) {
+	ctx := &RenderCtx{Data: map[string]any{"a": 0}}
+	ctx.PushScope(map[string]any{"a": 1})
+	ctx.PushScope(map[string]any{"b": 1})
+	captured := ctx.CurrentScope()
+
+	ctx.PopScope()
+	ctx.PopScope()
+	ctx.PushScope(map[string]any{"a": 2})
+	ctx.PushScope(map[string]any{"b": 2})
+
+	ctx.RestoreScope(captured)
+	for key, want := range map[string]any{"a": 1, "b": 1} {
+		if got, _ := ctx.Lookup(key); got != want {
+			t.Errorf("Lookup(%q) in restored scope = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestResetData(t *testing.T) {
+	ctx := &RenderCtx{Data: map[string]any{"a": 1}}
+	ctx.PushScope(map[string]any{"b": 1})
+	ctx.ResetData(map[string]any{})
+	if _, ok := ctx.Lookup("a"); ok {
+		t.Errorf("ResetData kept the enclosing scopes")
+	}
+}